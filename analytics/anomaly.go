@@ -0,0 +1,314 @@
+package analytics
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type AnomalyConfig struct {
+	// transactions in the last days form the rolling window
+	WindowDays int
+	// min robust z-score to flag a price, 3.5 is the usual cut-off
+	ZThreshold float64
+	// min prices in the window to flag a price
+	MinSamples int
+	// min ratio of the sales in the last day over the median daily sales
+	VolumeRatio float64
+	// min sales in the last day to flag a volume spike
+	MinVolume int
+	// min sales of the same asset in the window to flag wash trades
+	WashTradeCycles int
+	// the same anomaly is not flagged again within
+	DedupeDuration time.Duration
+}
+
+var DefaultAnomalyConfig = AnomalyConfig{
+	WindowDays:      14,
+	ZThreshold:      3.5,
+	MinSamples:      5,
+	VolumeRatio:     3,
+	MinVolume:       5,
+	WashTradeCycles: 3,
+	DedupeDuration:  24 * time.Hour,
+}
+
+// RobustZScore returns the modified z-score of the value with the median absolute deviation of the window
+// @return z-score, false if the window has no deviation
+func RobustZScore(value float64, window []float64) (float64, bool) {
+	if len(window) == 0 {
+		return 0, false
+	}
+
+	median := Median(window)
+	deviations := make([]float64, len(window))
+	for i, v := range window {
+		deviations[i] = math.Abs(v - median)
+	}
+
+	mad := Median(deviations)
+	if mad > 0 {
+		return 0.6745 * (value - median) / mad, true
+	}
+
+	// more than half of the window is the same price, fall back to the mean absolute deviation
+	mean := 0.0
+	for _, d := range deviations {
+		mean += d
+	}
+	mean /= float64(len(deviations))
+	if mean > 0 {
+		return (value - median) / (1.253314 * mean), true
+	}
+	return 0, false
+}
+
+// DetectPriceAnomaly checks the price against the window of recent prices
+// @return the anomaly, nil if normal
+func DetectPriceAnomaly(name, market string, price float64, window []float64, config *AnomalyConfig) *model.Anomaly {
+	if len(window) < config.MinSamples {
+		return nil
+	}
+
+	z, ok := RobustZScore(price, window)
+	if !ok || math.Abs(z) < config.ZThreshold {
+		return nil
+	}
+
+	anomalyType := shared.ANOMALY_TYPE_PRICE_SPIKE
+	if z < 0 {
+		anomalyType = shared.ANOMALY_TYPE_PRICE_DROP
+	}
+	return &model.Anomaly{
+		Name:     name,
+		Market:   market,
+		Type:     anomalyType,
+		Score:    z,
+		Value:    price,
+		Baseline: Median(window),
+	}
+}
+
+// DetectVolumeSpike compares the sales in the last day with the median daily sales of the previous days
+func DetectVolumeSpike(name, market string, transactions []model.Transaction, now time.Time, config *AnomalyConfig) *model.Anomaly {
+	if config.WindowDays < 2 {
+		return nil
+	}
+
+	// day 0 is the last 24 hours
+	daily := make([]float64, config.WindowDays)
+	for i := range transactions {
+		day := int(now.Sub(transactions[i].CreatedAt) / (24 * time.Hour))
+		if day >= 0 && day < config.WindowDays {
+			daily[day]++
+		}
+	}
+
+	latest, baseline := daily[0], Median(daily[1:])
+	if latest < float64(config.MinVolume) || latest < config.VolumeRatio*math.Max(baseline, 1) {
+		return nil
+	}
+	return &model.Anomaly{
+		Name:     name,
+		Market:   market,
+		Type:     shared.ANOMALY_TYPE_VOLUME_SPIKE,
+		Score:    latest / math.Max(baseline, 1),
+		Value:    latest,
+		Baseline: baseline,
+	}
+}
+
+// DetectWashTrades flags the assets sold repeatedly in the window
+func DetectWashTrades(name string, transactions []model.Transaction, config *AnomalyConfig) []model.Anomaly {
+	// asset id -> transactions
+	cycles := make(map[string][]*model.Transaction)
+	for i := range transactions {
+		assetId := transactions[i].Metadata.AssetId
+		if assetId == "" {
+			continue
+		}
+		cycles[assetId] = append(cycles[assetId], &transactions[i])
+	}
+
+	var anomalies []model.Anomaly
+	for assetId, sales := range cycles {
+		if len(sales) < config.WashTradeCycles {
+			continue
+		}
+
+		prices := make([]float64, 0, len(sales))
+		for _, sale := range sales {
+			if price, err := GetNormalizedTransactionPrice(sale); err == nil {
+				prices = append(prices, price)
+			}
+		}
+		if len(prices) == 0 {
+			continue
+		}
+		anomalies = append(anomalies, model.Anomaly{
+			Name:     name,
+			Market:   sales[0].Metadata.Market,
+			Type:     shared.ANOMALY_TYPE_WASH_TRADE,
+			Score:    float64(len(sales)),
+			Value:    prices[len(prices)-1],
+			Baseline: Median(prices),
+			AssetId:  assetId,
+		})
+	}
+
+	// stable order for the callers
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].AssetId < anomalies[j].AssetId
+	})
+	return anomalies
+}
+
+// group the transactions by market, sorted by time ascending
+func groupTransactionsByMarket(transactions []model.Transaction) map[string][]model.Transaction {
+	markets := make(map[string][]model.Transaction)
+	for _, transaction := range transactions {
+		markets[transaction.Metadata.Market] = append(markets[transaction.Metadata.Market], transaction)
+	}
+	for _, sales := range markets {
+		sort.SliceStable(sales, func(i, j int) bool {
+			return sales[i].CreatedAt.Before(sales[j].CreatedAt)
+		})
+	}
+	return markets
+}
+
+func getNormalizedTransactionPrices(transactions []model.Transaction) []float64 {
+	prices := make([]float64, 0, len(transactions))
+	for i := range transactions {
+		price, err := GetNormalizedTransactionPrice(&transactions[i])
+		if err != nil {
+			continue
+		}
+		prices = append(prices, price)
+	}
+	return prices
+}
+
+// DetectTransactionAnomalies checks the latest sale price, the sales volume and wash trades of an item per market
+func DetectTransactionAnomalies(name string, transactions []model.Transaction, now time.Time, config *AnomalyConfig) []model.Anomaly {
+	var anomalies []model.Anomaly
+
+	for market, sales := range groupTransactionsByMarket(transactions) {
+		// the latest sale against the previous sales
+		prices := getNormalizedTransactionPrices(sales)
+		if len(prices) > 1 {
+			if anomaly := DetectPriceAnomaly(name, market, prices[len(prices)-1], prices[:len(prices)-1], config); anomaly != nil {
+				anomalies = append(anomalies, *anomaly)
+			}
+		}
+
+		if anomaly := DetectVolumeSpike(name, market, sales, now, config); anomaly != nil {
+			anomalies = append(anomalies, *anomaly)
+		}
+
+		anomalies = append(anomalies, DetectWashTrades(name, sales, config)...)
+	}
+	return anomalies
+}
+
+// DetectItemPriceAnomalies checks the market prices of the item against the recent sales on the same market
+func DetectItemPriceAnomalies(item *model.Item, transactions []model.Transaction, config *AnomalyConfig) []model.Anomaly {
+	markets := groupTransactionsByMarket(transactions)
+
+	var anomalies []model.Anomaly
+	for _, marketName := range shared.ITEM_MARKET_NAMES {
+		price := shared.GetMarketPrice(item, marketName)
+		if price == nil {
+			continue
+		}
+
+		normalized, err := shared.NormalizePrice(price.Price, shared.GetMarketPriceCurrency(price, marketName))
+		if err != nil {
+			continue
+		}
+
+		window := getNormalizedTransactionPrices(markets[marketName])
+		if anomaly := DetectPriceAnomaly(item.Name, marketName, normalized, window, config); anomaly != nil {
+			anomalies = append(anomalies, *anomaly)
+		}
+	}
+	return anomalies
+}
+
+// Detects anomalies of items and stores them, the anomaly repository callback broadcasts them
+type AnomalyDetector struct {
+	transactionRepo *repository.TransactionRepository
+	anomalyRepo     *repository.AnomalyRepository
+	Config          AnomalyConfig
+}
+
+func NewAnomalyDetector(repos repository.RepoFactory, config AnomalyConfig) *AnomalyDetector {
+	return &AnomalyDetector{
+		transactionRepo: repos.GetTransactionRepository(),
+		anomalyRepo:     repos.GetAnomalyRepository(),
+		Config:          config,
+	}
+}
+
+func (d *AnomalyDetector) getTransactions(name string) ([]model.Transaction, error) {
+	// synthetic sales are priced at the last ask, not the trade
+	return d.transactionRepo.FindItemByDays(d.Config.WindowDays, bson.M{"name": name, "metadata.synthetic": bson.M{"$ne": true}})
+}
+
+// CheckTransactions detects the anomalies in the recent transactions of the item
+// @return the new anomalies
+func (d *AnomalyDetector) CheckTransactions(name string) ([]model.Anomaly, error) {
+	transactions, err := d.getTransactions(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.save(DetectTransactionAnomalies(name, transactions, time.Now(), &d.Config))
+}
+
+// CheckItemPrice detects the market prices of the item far from the recent sales
+// @return the new anomalies
+func (d *AnomalyDetector) CheckItemPrice(item *model.Item) ([]model.Anomaly, error) {
+	transactions, err := d.getTransactions(item.Name)
+	if err != nil {
+		return nil, err
+	}
+	return d.save(DetectItemPriceAnomalies(item, transactions, &d.Config))
+}
+
+// ItemChangeStreamHandler checks the updated item prices, used as the item repository callback
+func (d *AnomalyDetector) ItemChangeStreamHandler(data interface{}, operationType string) {
+	item, ok := data.(*model.Item)
+	if !ok || operationType == "delete" {
+		return
+	}
+	if _, err := d.CheckItemPrice(item); err != nil {
+		log.Printf("AnomalyDetector.ItemChangeStreamHandler: %s: %v", item.Name, err)
+	}
+}
+
+// save the anomalies not flagged recently
+func (d *AnomalyDetector) save(anomalies []model.Anomaly) ([]model.Anomaly, error) {
+	since := time.Now().Add(-d.Config.DedupeDuration)
+
+	var saved []model.Anomaly
+	for i := range anomalies {
+		exists, err := d.anomalyRepo.ExistsSince(&anomalies[i], since)
+		if err != nil {
+			return saved, err
+		}
+		if exists {
+			continue
+		}
+		if _, err := d.anomalyRepo.InsertAnomaly(&anomalies[i]); err != nil {
+			return saved, err
+		}
+		saved = append(saved, anomalies[i])
+	}
+	return saved, nil
+}
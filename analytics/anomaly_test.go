@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestRobustZScore(t *testing.T) {
+	window := []float64{100, 101, 99, 100, 102, 98}
+
+	if z, ok := RobustZScore(100, window); !ok || z != 0 {
+		t.Errorf("Expected 0 for the median, got %v, %v", z, ok)
+	}
+	if z, ok := RobustZScore(150, window); !ok || z < 3.5 {
+		t.Errorf("Expected a large positive z-score, got %v, %v", z, ok)
+	}
+	// falls back to the mean absolute deviation
+	if z, ok := RobustZScore(50, []float64{100, 100, 100, 110}); !ok || z > -3.5 {
+		t.Errorf("Expected a large negative z-score, got %v, %v", z, ok)
+	}
+	if _, ok := RobustZScore(100, []float64{100, 100}); ok {
+		t.Errorf("Expected no z-score without deviation")
+	}
+}
+
+func TestDetectPriceAnomaly(t *testing.T) {
+	config := DefaultAnomalyConfig
+	window := []float64{100, 101, 99, 100, 102, 98}
+
+	anomaly := DetectPriceAnomaly("AK-47 | Redline (Field-Tested)", shared.MARKET_NAME_BUFF, 150, window, &config)
+	if anomaly == nil || anomaly.Type != shared.ANOMALY_TYPE_PRICE_SPIKE || anomaly.Baseline != 100 {
+		t.Errorf("Expected a price spike, got %+v", anomaly)
+	}
+
+	anomaly = DetectPriceAnomaly("AK-47 | Redline (Field-Tested)", shared.MARKET_NAME_BUFF, 60, window, &config)
+	if anomaly == nil || anomaly.Type != shared.ANOMALY_TYPE_PRICE_DROP {
+		t.Errorf("Expected a price drop, got %+v", anomaly)
+	}
+
+	if anomaly := DetectPriceAnomaly("AK-47 | Redline (Field-Tested)", shared.MARKET_NAME_BUFF, 103, window, &config); anomaly != nil {
+		t.Errorf("Expected no anomaly, got %+v", anomaly)
+	}
+
+	// not enough samples
+	if anomaly := DetectPriceAnomaly("AK-47 | Redline (Field-Tested)", shared.MARKET_NAME_BUFF, 150, window[:3], &config); anomaly != nil {
+		t.Errorf("Expected no anomaly, got %+v", anomaly)
+	}
+}
+
+func TestDetectVolumeSpike(t *testing.T) {
+	config := DefaultAnomalyConfig
+	now := time.Now()
+
+	var transactions []model.Transaction
+	// 1 sale per day
+	for day := 1; day < config.WindowDays; day++ {
+		transactions = append(transactions, model.Transaction{CreatedAt: now.Add(-time.Duration(day)*24*time.Hour - time.Hour)})
+	}
+	if anomaly := DetectVolumeSpike("name", shared.MARKET_NAME_BUFF, transactions, now, &config); anomaly != nil {
+		t.Errorf("Expected no anomaly, got %+v", anomaly)
+	}
+
+	// 6 sales in the last day
+	for i := 0; i < 6; i++ {
+		transactions = append(transactions, model.Transaction{CreatedAt: now.Add(-time.Duration(i) * time.Hour)})
+	}
+	anomaly := DetectVolumeSpike("name", shared.MARKET_NAME_BUFF, transactions, now, &config)
+	if anomaly == nil || anomaly.Value != 6 || anomaly.Baseline != 1 {
+		t.Errorf("Expected a volume spike, got %+v", anomaly)
+	}
+}
+
+func TestDetectWashTrades(t *testing.T) {
+	config := DefaultAnomalyConfig
+
+	var transactions []model.Transaction
+	for i := 0; i < 3; i++ {
+		transactions = append(transactions, model.Transaction{
+			Metadata: model.TransactionMetadata{Market: shared.MARKET_NAME_BUFF, AssetId: "cycled"},
+			Price:    shared.GetDecimal128(fmt.Sprint(100 + i*10)),
+		})
+	}
+	transactions = append(transactions, model.Transaction{
+		Metadata: model.TransactionMetadata{Market: shared.MARKET_NAME_BUFF, AssetId: "once"},
+		Price:    shared.GetDecimal128("100"),
+	})
+
+	anomalies := DetectWashTrades("name", transactions, &config)
+	if len(anomalies) != 1 {
+		t.Fatalf("Expected 1 anomaly, got %v", anomalies)
+	}
+	if anomalies[0].AssetId != "cycled" || anomalies[0].Score != 3 || anomalies[0].Type != shared.ANOMALY_TYPE_WASH_TRADE {
+		t.Errorf("Unexpected anomaly: %+v", anomalies[0])
+	}
+}
@@ -0,0 +1,300 @@
+package analytics
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"github.com/mikezzb/steam-trading-shared/subscription"
+)
+
+// Sends a plain message, e.g. *subscription.Notifier
+type MessageNotifier interface {
+	Notify(notiType, notiId string, message string)
+}
+
+// Buy on one market and sell on another, amounts are in shared.NORMALIZED_CURRENCY
+type ArbitrageOpportunity struct {
+	Name       string
+	BuyMarket  string
+	SellMarket string
+	// listed prices in the currency of the market
+	BuyPrice     float64
+	BuyCurrency  string
+	SellPrice    float64
+	SellCurrency string
+	// cost including the buyer fees
+	Cost float64
+	// proceeds after the seller & withdrawal fees
+	NetProceeds float64
+	Profit      float64
+	ROI         float64
+	// transactions of the item on the sell market in the liquidity window
+	Sales int64
+	// ROI weighted by liquidity, used for ranking
+	Score float64
+}
+
+type ArbitrageConfig struct {
+	// min ROI, e.g. 0.05 for 5%
+	MinROI float64
+	// min transactions on the sell market in the liquidity window
+	MinSales int64
+	// liquidity window
+	SalesDays int
+	// market prices older than this are ignored
+	MaxPriceAge time.Duration
+	// max number of opportunities returned, 0 for all
+	Limit int
+}
+
+var DefaultArbitrageConfig = ArbitrageConfig{
+	MinROI:      0.03,
+	MinSales:    1,
+	SalesDays:   7,
+	MaxPriceAge: shared.FRESH_PRICE_DURATION,
+	Limit:       20,
+}
+
+type marketAmount struct {
+	amount     float64
+	currency   string
+	normalized float64
+}
+
+// @return market -> fresh price of the item, stale prices are skipped
+func getFreshPrices(item *model.Item, maxAge time.Duration, now time.Time) map[string]marketAmount {
+	prices := make(map[string]marketAmount)
+	for _, marketName := range shared.ITEM_MARKET_NAMES {
+		price := shared.GetMarketPrice(item, marketName)
+		if price == nil || (maxAge > 0 && price.UpdatedAt.Add(maxAge).Before(now)) {
+			continue
+		}
+		amount := shared.DecToFloat(price.Price)
+		if amount <= 0 {
+			continue
+		}
+		currency := shared.GetMarketPriceCurrency(price, marketName)
+		normalized, err := shared.ConvertAmount(amount, currency, shared.NORMALIZED_CURRENCY)
+		if err != nil {
+			log.Printf("getFreshPrices: %s %s: %v", item.Name, marketName, err)
+			continue
+		}
+		prices[marketName] = marketAmount{amount, currency, normalized}
+	}
+	return prices
+}
+
+// Evaluate computes the cost, proceeds and profit of buying at BuyPrice and selling at SellPrice
+func (opp *ArbitrageOpportunity) Evaluate() error {
+	cost, err := shared.ConvertAmount(
+		shared.GetMarketFee(opp.BuyMarket).BuyerCost(opp.BuyPrice),
+		opp.BuyCurrency, shared.NORMALIZED_CURRENCY)
+	if err != nil {
+		return err
+	}
+
+	proceeds, err := shared.ConvertAmount(
+		shared.GetMarketFee(opp.SellMarket).NetProceeds(opp.SellPrice),
+		opp.SellCurrency, shared.NORMALIZED_CURRENCY)
+	if err != nil {
+		return err
+	}
+
+	opp.Cost = cost
+	opp.NetProceeds = proceeds
+	opp.Profit = proceeds - cost
+	if cost > 0 {
+		opp.ROI = opp.Profit / cost
+	}
+	return nil
+}
+
+// FindItemArbitrage returns the profitable market pairs of the item
+// @param sales market -> transactions of the item, nil to skip the liquidity check
+func FindItemArbitrage(item *model.Item, sales map[string]int64, config *ArbitrageConfig) []ArbitrageOpportunity {
+	prices := getFreshPrices(item, config.MaxPriceAge, time.Now())
+
+	var opps []ArbitrageOpportunity
+	for buyMarket, buyPrice := range prices {
+		for sellMarket, sellPrice := range prices {
+			if buyMarket == sellMarket || sellPrice.normalized <= buyPrice.normalized {
+				continue
+			}
+
+			opp := &ArbitrageOpportunity{
+				Name:         item.Name,
+				BuyMarket:    buyMarket,
+				BuyPrice:     buyPrice.amount,
+				BuyCurrency:  buyPrice.currency,
+				SellMarket:   sellMarket,
+				SellPrice:    sellPrice.amount,
+				SellCurrency: sellPrice.currency,
+			}
+			if err := opp.Evaluate(); err != nil {
+				log.Printf("FindItemArbitrage: %s: %v", item.Name, err)
+				continue
+			}
+			if opp.ROI < config.MinROI {
+				continue
+			}
+
+			if sales != nil {
+				opp.Sales = sales[sellMarket]
+				if opp.Sales < config.MinSales {
+					continue
+				}
+			}
+			opp.Score = GetArbitrageScore(opp)
+			opps = append(opps, *opp)
+		}
+	}
+	return opps
+}
+
+// FindListingArbitrage returns the profit of buying the listing and selling it at the prices of the other markets
+func FindListingArbitrage(listing *model.Listing, item *model.Item, sales map[string]int64, config *ArbitrageConfig) []ArbitrageOpportunity {
+	prices := getFreshPrices(item, config.MaxPriceAge, time.Now())
+
+	var opps []ArbitrageOpportunity
+	for sellMarket, sellPrice := range prices {
+		if sellMarket == listing.Market {
+			continue
+		}
+
+		opp := &ArbitrageOpportunity{
+			Name:         listing.Name,
+			BuyMarket:    listing.Market,
+			BuyPrice:     shared.DecToFloat(listing.Price),
+			BuyCurrency:  shared.GetListingCurrency(listing),
+			SellMarket:   sellMarket,
+			SellPrice:    sellPrice.amount,
+			SellCurrency: sellPrice.currency,
+		}
+		if err := opp.Evaluate(); err != nil {
+			log.Printf("FindListingArbitrage: %s: %v", listing.Name, err)
+			continue
+		}
+		if opp.ROI < config.MinROI {
+			continue
+		}
+
+		if sales != nil {
+			opp.Sales = sales[sellMarket]
+			if opp.Sales < config.MinSales {
+				continue
+			}
+		}
+		opp.Score = GetArbitrageScore(opp)
+		opps = append(opps, *opp)
+	}
+	return opps
+}
+
+// Score is the ROI weighted by the log of the sales, so liquid items rank first among similar ROIs
+func GetArbitrageScore(opp *ArbitrageOpportunity) float64 {
+	return opp.ROI * math.Log1p(float64(opp.Sales))
+}
+
+// RankArbitrage sorts by score, then ROI, descending
+func RankArbitrage(opps []ArbitrageOpportunity) {
+	sort.SliceStable(opps, func(i, j int) bool {
+		if opps[i].Score != opps[j].Score {
+			return opps[i].Score > opps[j].Score
+		}
+		return opps[i].ROI > opps[j].ROI
+	})
+}
+
+// FormatArbitrage renders the opportunity in the arbitrage template of the notifier type & locale
+func FormatArbitrage(templates *subscription.MessageTemplates, notiType, locale string, opp *ArbitrageOpportunity) (string, error) {
+	return templates.Render(subscription.TEMPLATE_ARBITRAGE, notiType, locale, &subscription.ArbitrageMessageData{
+		Name:         opp.Name,
+		BuyMarket:    opp.BuyMarket,
+		BuyPrice:     opp.BuyPrice,
+		BuyCurrency:  opp.BuyCurrency,
+		SellMarket:   opp.SellMarket,
+		SellPrice:    opp.SellPrice,
+		SellCurrency: opp.SellCurrency,
+		Profit:       opp.Profit,
+		ROI:          opp.ROI,
+		Sales:        opp.Sales,
+		Currency:     shared.NORMALIZED_CURRENCY,
+	})
+}
+
+// Scans the stored market prices for arbitrage
+type ArbitrageScanner struct {
+	itemRepo        *repository.ItemRepository
+	transactionRepo *repository.TransactionRepository
+	Config          ArbitrageConfig
+	// renders the emitted opportunities, the default templates if nil
+	Templates *subscription.MessageTemplates
+}
+
+func NewArbitrageScanner(repos repository.RepoFactory, config ArbitrageConfig) *ArbitrageScanner {
+	return &ArbitrageScanner{
+		itemRepo:        repos.GetItemRepository(),
+		transactionRepo: repos.GetTransactionRepository(),
+		Config:          config,
+		Templates:       subscription.DefaultMessageTemplates,
+	}
+}
+
+// Scan returns the ranked opportunities of all items
+func (s *ArbitrageScanner) Scan() ([]ArbitrageOpportunity, error) {
+	items, err := s.itemRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sales, err := s.transactionRepo.CountSalesByItem(s.Config.SalesDays)
+	if err != nil {
+		return nil, err
+	}
+
+	var opps []ArbitrageOpportunity
+	for i := range items {
+		itemSales := sales[items[i].Name]
+		if itemSales == nil {
+			itemSales = map[string]int64{}
+		}
+		opps = append(opps, FindItemArbitrage(&items[i], itemSales, &s.Config)...)
+	}
+
+	RankArbitrage(opps)
+	if s.Config.Limit > 0 && len(opps) > s.Config.Limit {
+		opps = opps[:s.Config.Limit]
+	}
+	return opps, nil
+}
+
+// Emit sends the opportunities as one message in the locale
+func (s *ArbitrageScanner) Emit(notifier MessageNotifier, notiType, notiId, locale string, opps []ArbitrageOpportunity) {
+	if len(opps) == 0 {
+		return
+	}
+
+	templates := s.Templates
+	if templates == nil {
+		templates = subscription.DefaultMessageTemplates
+	}
+
+	messages := make([]string, 0, len(opps))
+	for i := range opps {
+		message, err := FormatArbitrage(templates, notiType, locale, &opps[i])
+		if err != nil {
+			log.Printf("ArbitrageScanner.Emit: %s: %v", opps[i].Name, err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) > 0 {
+		notifier.Notify(notiType, notiId, strings.Join(messages, "\n\n"))
+	}
+}
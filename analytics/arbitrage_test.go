@@ -0,0 +1,117 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+type testNotifier struct {
+	messages []string
+}
+
+func (n *testNotifier) Notify(notiType, notiId string, message string) {
+	n.messages = append(n.messages, message)
+}
+
+func TestFindItemArbitrage(t *testing.T) {
+	defer shared.SetRateProvider(shared.GetRateProvider())
+	shared.SetRateProvider(shared.NewStaticRateProvider(shared.CURRENCY_USD, map[string]float64{shared.CURRENCY_CNY: 7}))
+
+	now := time.Now()
+	item := &model.Item{
+		Name: "AK-47 | Redline (Field-Tested)",
+		// ¥70 = $10
+		BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128("70"), UpdatedAt: now},
+		// ¥80, ¥78.41 after fees, ~12% ROI
+		UUPrice: &model.MarketPrice{Price: shared.GetDecimal128("80"), UpdatedAt: now},
+		// $20 but stale
+		SteamPrice: &model.MarketPrice{Price: shared.GetDecimal128("20"), UpdatedAt: now.Add(-48 * time.Hour)},
+	}
+
+	config := DefaultArbitrageConfig
+	config.MaxPriceAge = time.Hour
+
+	opps := FindItemArbitrage(item, map[string]int64{shared.MARKET_NAME_UU: 10}, &config)
+	if len(opps) != 1 {
+		t.Fatalf("Expected 1 opportunity, got %v", opps)
+	}
+
+	opp := opps[0]
+	if opp.BuyMarket != shared.MARKET_NAME_BUFF || opp.SellMarket != shared.MARKET_NAME_UU {
+		t.Errorf("Expected buff -> uu, got %s -> %s", opp.BuyMarket, opp.SellMarket)
+	}
+	if opp.ROI < 0.11 || opp.ROI > 0.13 {
+		t.Errorf("Expected ROI ~12%%, got %v", opp.ROI)
+	}
+
+	// not liquid enough
+	config.MinSales = 20
+	if opps := FindItemArbitrage(item, map[string]int64{shared.MARKET_NAME_UU: 10}, &config); len(opps) != 0 {
+		t.Errorf("Expected no opportunity, got %v", opps)
+	}
+
+	// with fresh steam price, selling on steam after the 15% fees is still profitable
+	config.MinSales = 0
+	item.SteamPrice.UpdatedAt = now
+	opps = FindItemArbitrage(item, nil, &config)
+	RankArbitrage(opps)
+	if len(opps) != 3 || opps[0].SellMarket != shared.MARKET_NAME_STEAM {
+		t.Errorf("Expected best to sell on steam, got %v", opps)
+	}
+}
+
+func TestRankArbitrage(t *testing.T) {
+	opps := []ArbitrageOpportunity{
+		{Name: "illiquid", ROI: 0.5, Sales: 0},
+		{Name: "liquid", ROI: 0.1, Sales: 100},
+		{Name: "less liquid", ROI: 0.1, Sales: 10},
+	}
+	for i := range opps {
+		opps[i].Score = GetArbitrageScore(&opps[i])
+	}
+
+	RankArbitrage(opps)
+
+	expected := []string{"liquid", "less liquid", "illiquid"}
+	for i, name := range expected {
+		if opps[i].Name != name {
+			t.Errorf("Expected %s at %d, got %s", name, i, opps[i].Name)
+		}
+	}
+}
+
+func TestArbitrageScanner_Emit(t *testing.T) {
+	notifier := &testNotifier{}
+	scanner := &ArbitrageScanner{}
+
+	scanner.Emit(notifier, shared.NOTI_TYPE_TELEGRAM, "1", shared.LOCALE_EN, nil)
+	if len(notifier.messages) != 0 {
+		t.Errorf("Expected no message for no opportunities")
+	}
+
+	opps := []ArbitrageOpportunity{{
+		Name:         "AK-47 | Redline (Field-Tested)",
+		BuyMarket:    shared.MARKET_NAME_BUFF,
+		BuyPrice:     70,
+		BuyCurrency:  shared.CURRENCY_CNY,
+		SellMarket:   shared.MARKET_NAME_STEAM,
+		SellPrice:    20,
+		SellCurrency: shared.CURRENCY_USD,
+		Profit:       50,
+		ROI:          0.7,
+	}}
+	scanner.Emit(notifier, shared.NOTI_TYPE_TELEGRAM, "1", shared.LOCALE_EN, opps)
+	if len(notifier.messages) != 1 || !strings.Contains(notifier.messages[0], "Sell: steam $20.00") || !strings.Contains(notifier.messages[0], "ROI +70%") {
+		t.Errorf("Unexpected messages: %v", notifier.messages)
+	}
+
+	// in the locale of the target
+	scanner.Emit(notifier, shared.NOTI_TYPE_TELEGRAM, "1", shared.LOCALE_ZH_CN, opps)
+	if len(notifier.messages) != 2 || !strings.Contains(notifier.messages[1], "卖出: steam $20.00") {
+		t.Errorf("Unexpected messages: %v", notifier.messages)
+	}
+}
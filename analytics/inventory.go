@@ -0,0 +1,263 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// placeholders of the inspect link in the inventory descriptions
+const (
+	INSPECT_LINK_OWNER_PLACEHOLDER = "%owner_steamid%"
+	INSPECT_LINK_ASSET_PLACEHOLDER = "%assetid%"
+)
+
+// Saved response of the steam inventory endpoint, /inventory/<steam id>/730/2
+type steamInventoryJson struct {
+	Assets       []steamAsset       `json:"assets"`
+	Descriptions []steamDescription `json:"descriptions"`
+	Success      int                `json:"success"`
+}
+
+type steamAsset struct {
+	AssetId    string `json:"assetid"`
+	ClassId    string `json:"classid"`
+	InstanceId string `json:"instanceid"`
+	Amount     string `json:"amount"`
+}
+
+type steamDescription struct {
+	ClassId        string `json:"classid"`
+	InstanceId     string `json:"instanceid"`
+	Name           string `json:"name"`
+	MarketName     string `json:"market_name"`
+	MarketHashName string `json:"market_hash_name"`
+	Tradable       int    `json:"tradable"`
+	Marketable     int    `json:"marketable"`
+	Actions        []struct {
+		Link string `json:"link"`
+		Name string `json:"name"`
+	} `json:"actions"`
+	Tags []struct {
+		Category         string `json:"category"`
+		LocalizedTagName string `json:"localized_tag_name"`
+	} `json:"tags"`
+}
+
+// An asset of a steam inventory
+type InventoryItem struct {
+	AssetId string
+	// Market hash name
+	Name string
+	// Buff id, empty if the name is not in the buff id map
+	ItemId string
+	// Optional, Doppler phase if the inventory names it, e.g. "... (Factory New) - Phase 2"
+	Phase       string
+	Rarity      string
+	Amount      int
+	Tradable    bool
+	InspectLink string
+}
+
+type SteamInventory struct {
+	Items []InventoryItem
+	// names of the marketable items not in the buff id map
+	Unmatched []string
+	// assets not marketable, e.g. medals, or without a description
+	Skipped int
+}
+
+func getDescriptionKey(classId, instanceId string) string {
+	return classId + "_" + instanceId
+}
+
+// @return the parsed market hash name of the description, rebuilt from the name & exterior tag if missing
+func getDescriptionName(description *steamDescription) shared.ItemName {
+	name := description.MarketHashName
+	if name == "" {
+		name = description.MarketName
+		for _, tag := range description.Tags {
+			if tag.Category == "Exterior" && !strings.HasSuffix(name, ")") {
+				name += " (" + tag.LocalizedTagName + ")"
+			}
+		}
+	}
+	if name == "" {
+		name = description.Name
+	}
+	return shared.ParseItemName(name)
+}
+
+func getDescriptionTag(description *steamDescription, category string) string {
+	for _, tag := range description.Tags {
+		if tag.Category == category {
+			return tag.LocalizedTagName
+		}
+	}
+	return ""
+}
+
+// @return the inspect link of the asset, empty if the owner is unknown
+func getInspectLink(description *steamDescription, assetId, steamId string) string {
+	for _, action := range description.Actions {
+		if !strings.Contains(action.Link, INSPECT_LINK_ASSET_PLACEHOLDER) {
+			continue
+		}
+		link := strings.ReplaceAll(action.Link, INSPECT_LINK_ASSET_PLACEHOLDER, assetId)
+		if strings.Contains(link, INSPECT_LINK_OWNER_PLACEHOLDER) {
+			if steamId == "" {
+				return ""
+			}
+			link = strings.ReplaceAll(link, INSPECT_LINK_OWNER_PLACEHOLDER, steamId)
+		}
+		return link
+	}
+	return ""
+}
+
+// ParseSteamInventory parses a saved steam inventory json, without any network access
+// @param steamId owner of the inventory to fill the inspect links, optional
+// @param buffIds item name -> buff id, e.g. shared.GetBuffIds()
+func ParseSteamInventory(data []byte, steamId string, buffIds map[string]int) (*SteamInventory, error) {
+	var inventoryJson steamInventoryJson
+	if err := json.Unmarshal(data, &inventoryJson); err != nil {
+		return nil, err
+	}
+	if inventoryJson.Success != 1 && len(inventoryJson.Assets) == 0 {
+		return nil, fmt.Errorf("unsuccessful steam inventory response")
+	}
+
+	descriptions := make(map[string]*steamDescription, len(inventoryJson.Descriptions))
+	for i := range inventoryJson.Descriptions {
+		description := &inventoryJson.Descriptions[i]
+		descriptions[getDescriptionKey(description.ClassId, description.InstanceId)] = description
+	}
+
+	inventory := &SteamInventory{}
+	unmatched := make(map[string]bool)
+	for _, asset := range inventoryJson.Assets {
+		description, ok := descriptions[getDescriptionKey(asset.ClassId, asset.InstanceId)]
+		if !ok || description.Marketable != 1 {
+			inventory.Skipped++
+			continue
+		}
+
+		itemName := getDescriptionName(description)
+		item := InventoryItem{
+			AssetId:     asset.AssetId,
+			Name:        itemName.MarketHashName(),
+			Phase:       itemName.Phase,
+			Rarity:      getDescriptionTag(description, "Rarity"),
+			Amount:      1,
+			Tradable:    description.Tradable == 1,
+			InspectLink: getInspectLink(description, asset.AssetId, steamId),
+		}
+		if amount, err := strconv.Atoi(asset.Amount); err == nil && amount > 1 {
+			item.Amount = amount
+		}
+		if buffId, ok := buffIds[item.Name]; ok {
+			item.ItemId = strconv.Itoa(buffId)
+		} else if !unmatched[item.Name] {
+			unmatched[item.Name] = true
+			inventory.Unmatched = append(inventory.Unmatched, item.Name)
+		}
+		inventory.Items = append(inventory.Items, item)
+	}
+	return inventory, nil
+}
+
+// LoadSteamInventory parses the steam inventory json file, names are matched with the buff id map
+func LoadSteamInventory(path, steamId string) (*SteamInventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSteamInventory(data, steamId, shared.GetBuffIds())
+}
+
+// GetInventoryHoldings converts the inventory to holdings of the owner
+// The cost basis is the fresh best price of the item at the import, 0 if the item has no price or is priced by phase
+// @param items item name -> item
+func GetInventoryHoldings(inventory *SteamInventory, ownerId primitive.ObjectID, items map[string]*model.Item, now time.Time) []model.Holding {
+	holdings := make([]model.Holding, len(inventory.Items))
+	for i := range inventory.Items {
+		inventoryItem := &inventory.Items[i]
+		holding := model.Holding{
+			OwnerId:       ownerId,
+			AssetId:       inventoryItem.AssetId,
+			Name:          inventoryItem.Name,
+			ItemId:        inventoryItem.ItemId,
+			Rarity:        inventoryItem.Rarity,
+			Phase:         inventoryItem.Phase,
+			Tradable:      inventoryItem.Tradable,
+			InspectLink:   inventoryItem.InspectLink,
+			PurchasePrice: shared.GetDecimal128("0"),
+			PurchasedAt:   now,
+		}
+		if inventoryItem.Amount > 1 {
+			holding.Amount = inventoryItem.Amount
+		}
+
+		item := items[inventoryItem.Name]
+		if shared.ParseItemName(inventoryItem.Name).HasPhases() {
+			item = nil
+		}
+		if bestPrice := shared.GetFreshBestPrice(item, shared.FRESH_PRICE_DURATION); bestPrice != nil {
+			for _, market := range shared.ITEM_MARKET_NAMES {
+				if shared.GetMarketPrice(item, market) == bestPrice {
+					holding.PurchaseMarket = market
+				}
+			}
+			holding.PurchasePrice = bestPrice.Price
+			holding.PurchaseCurrency = bestPrice.Currency
+		}
+		holdings[i] = holding
+	}
+	return holdings
+}
+
+// ValueSteamInventory values the inventory at the current prices of the items, without any network access
+func ValueSteamInventory(inventory *SteamInventory, items map[string]*model.Item, now time.Time) *Valuation {
+	return ValuePortfolio(GetInventoryHoldings(inventory, primitive.NilObjectID, items, now), items, now)
+}
+
+// ImportSteamInventory upserts the inventory as holdings of the owner by asset id
+// Holdings already imported keep their cost basis
+// @return the valuation of the owner after the import
+func (s *PortfolioService) ImportSteamInventory(ownerId primitive.ObjectID, inventory *SteamInventory) (*Valuation, error) {
+	held, err := s.portfolioRepo.GetHeldByOwnerId(ownerId)
+	if err != nil {
+		return nil, err
+	}
+	imported := make(map[string]bool, len(held))
+	for i := range held {
+		imported[held[i].AssetId] = true
+	}
+
+	names := make([]string, len(inventory.Items))
+	for i := range inventory.Items {
+		names[i] = inventory.Items[i].Name
+	}
+	items, err := s.getItems(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var holdings []model.Holding
+	for _, holding := range GetInventoryHoldings(inventory, ownerId, items, time.Now()) {
+		if !imported[holding.AssetId] {
+			holdings = append(holdings, holding)
+		}
+	}
+	if err := s.portfolioRepo.UpsertHoldingsByAssetId(holdings); err != nil {
+		return nil, err
+	}
+	return s.GetValuation(ownerId)
+}
@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSteamInventory = `{
+	"assets": [
+		{"appid": 730, "contextid": "2", "assetid": "101", "classid": "1", "instanceid": "0", "amount": "1"},
+		{"appid": 730, "contextid": "2", "assetid": "102", "classid": "2", "instanceid": "0", "amount": "3"},
+		{"appid": 730, "contextid": "2", "assetid": "103", "classid": "3", "instanceid": "0", "amount": "1"},
+		{"appid": 730, "contextid": "2", "assetid": "104", "classid": "4", "instanceid": "0", "amount": "1"},
+		{"appid": 730, "contextid": "2", "assetid": "105", "classid": "5", "instanceid": "0", "amount": "1"},
+		{"appid": 730, "contextid": "2", "assetid": "106", "classid": "6", "instanceid": "0", "amount": "1"}
+	],
+	"descriptions": [
+		{
+			"classid": "1", "instanceid": "0",
+			"name": "AK-47 | Redline", "market_hash_name": "AK-47 | Redline (Field-Tested)",
+			"tradable": 1, "marketable": 1,
+			"actions": [{"link": "steam://rungame/730/76561202255233023/+csgo_econ_action_preview%20S%owner_steamid%A%assetid%D123", "name": "Inspect in Game..."}],
+			"tags": [{"category": "Exterior", "localized_tag_name": "Field-Tested"}, {"category": "Rarity", "localized_tag_name": "Classified"}]
+		},
+		{
+			"classid": "2", "instanceid": "0",
+			"name": "Recoil Case", "market_hash_name": "Recoil Case",
+			"tradable": 1, "marketable": 1
+		},
+		{
+			"classid": "3", "instanceid": "0",
+			"name": "★ Karambit | Doppler", "market_name": "★ Karambit | Doppler",
+			"tradable": 0, "marketable": 1,
+			"tags": [{"category": "Exterior", "localized_tag_name": "Factory New"}]
+		},
+		{
+			"classid": "4", "instanceid": "0",
+			"name": "5 Year Veteran Coin", "market_hash_name": "5 Year Veteran Coin",
+			"tradable": 0, "marketable": 0
+		},
+		{
+			"classid": "6", "instanceid": "0",
+			"name": "★ Bayonet | Gamma Doppler", "market_hash_name": "★ Bayonet | Gamma Doppler (Minimal Wear) - Emerald",
+			"tradable": 1, "marketable": 1
+		}
+	],
+	"total_inventory_count": 6,
+	"success": 1
+}`
+
+func TestParseSteamInventory(t *testing.T) {
+	buffIds := map[string]int{
+		"AK-47 | Redline (Field-Tested)": 33815,
+		"Recoil Case":                    921379,
+	}
+
+	inventory, err := ParseSteamInventory([]byte(testSteamInventory), "76561198000000000", buffIds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the coin is not marketable & the last asset has no description
+	if len(inventory.Items) != 4 || inventory.Skipped != 2 {
+		t.Fatalf("Expected 4 items & 2 skipped, got %+v", inventory)
+	}
+
+	ak := inventory.Items[0]
+	if ak.Name != "AK-47 | Redline (Field-Tested)" || ak.ItemId != "33815" || ak.Rarity != "Classified" || !ak.Tradable {
+		t.Errorf("Expected the tradable AK with its buff id, got %+v", ak)
+	}
+	if ak.InspectLink != "steam://rungame/730/76561202255233023/+csgo_econ_action_preview%20S76561198000000000A101D123" {
+		t.Errorf("Expected the inspect link of the asset, got %s", ak.InspectLink)
+	}
+
+	if inventory.Items[1].Amount != 3 {
+		t.Errorf("Expected 3 cases, got %+v", inventory.Items[1])
+	}
+
+	// rebuilt from the name & exterior
+	knife := inventory.Items[2]
+	if knife.Name != "★ Karambit | Doppler (Factory New)" || knife.Tradable || knife.ItemId != "" {
+		t.Errorf("Expected the untradable knife without buff id, got %+v", knife)
+	}
+	if len(inventory.Unmatched) != 2 || inventory.Unmatched[0] != knife.Name {
+		t.Errorf("Expected the knives unmatched, got %v", inventory.Unmatched)
+	}
+
+	// the phase is kept apart from the market hash name
+	gamma := inventory.Items[3]
+	if gamma.Name != "★ Bayonet | Gamma Doppler (Minimal Wear)" || gamma.Phase != shared.PHASE_EMERALD {
+		t.Errorf("Expected the emerald gamma doppler, got %+v", gamma)
+	}
+
+	// no inspect link without the owner
+	inventory, _ = ParseSteamInventory([]byte(testSteamInventory), "", buffIds)
+	if inventory.Items[0].InspectLink != "" {
+		t.Errorf("Expected no inspect link, got %s", inventory.Items[0].InspectLink)
+	}
+
+	if _, err := ParseSteamInventory([]byte(`{"success": 0}`), "", buffIds); err == nil {
+		t.Errorf("Expected an error for an unsuccessful response")
+	}
+}
+
+func TestValueSteamInventory(t *testing.T) {
+	inventory, err := ParseSteamInventory([]byte(testSteamInventory), "", map[string]int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	items := map[string]*model.Item{
+		"AK-47 | Redline (Field-Tested)": {
+			Name:      "AK-47 | Redline (Field-Tested)",
+			BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128("100"), UpdatedAt: now},
+		},
+		"Recoil Case": {
+			Name:    "Recoil Case",
+			UUPrice: &model.MarketPrice{Price: shared.GetDecimal128("2"), UpdatedAt: now},
+		},
+		// the item price is not of the phase
+		"★ Bayonet | Gamma Doppler (Minimal Wear)": {
+			Name:      "★ Bayonet | Gamma Doppler (Minimal Wear)",
+			BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128("3000"), UpdatedAt: now},
+		},
+	}
+
+	holdings := GetInventoryHoldings(inventory, primitive.NewObjectID(), items, now)
+	if len(holdings) != 4 || holdings[0].AssetId != "101" || holdings[0].PurchaseMarket != shared.MARKET_NAME_BUFF || holdings[0].PurchasePrice.String() != "100" {
+		t.Errorf("Expected the AK bought at the buff price, got %+v", holdings)
+	}
+	if holdings[1].Amount != 3 || holdings[2].PurchasePrice.String() != "0" {
+		t.Errorf("Expected 3 cases & the unpriced knife at no cost, got %+v", holdings)
+	}
+	if gamma := holdings[3]; gamma.Phase != shared.PHASE_EMERALD || gamma.PurchasePrice.String() != "0" || gamma.PurchaseMarket != "" {
+		t.Errorf("Expected the phased knife at no cost, got %+v", gamma)
+	}
+
+	valuation := ValueSteamInventory(inventory, items, now)
+	if valuation.Held != 4 || valuation.Unpriced != 2 || valuation.Value != 106 || valuation.Cost != 106 {
+		t.Errorf("Expected ¥106 of priced items, got %+v", valuation)
+	}
+}
@@ -0,0 +1,185 @@
+package analytics
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const STATS_DAY_LAYOUT = "2006-01-02"
+
+type LiquidityConfig struct {
+	// days of sales in the daily sales average
+	WindowDays int
+	// number of recent sale prices kept for the median sale price
+	MaxRecentPrices int
+}
+
+var DefaultLiquidityConfig = LiquidityConfig{
+	WindowDays:      30,
+	MaxRecentPrices: 50,
+}
+
+// ApplyTransactions adds the new transactions to the stats, transactions must be newer than stats.LastTransactionAt
+// @param listedAt asset id -> creation time of the matching listing
+func ApplyTransactions(stats *model.ItemStats, transactions []model.Transaction, listedAt map[string]time.Time, config *LiquidityConfig) {
+	if stats.DailyCounts == nil {
+		stats.DailyCounts = make(map[string]int64)
+	}
+
+	totalTimeToSell := stats.AvgTimeToSell * float64(stats.MatchedSales)
+	for i := range transactions {
+		transaction := &transactions[i]
+		stats.DailyCounts[transaction.CreatedAt.UTC().Format(STATS_DAY_LAYOUT)]++
+
+		if createdAt, ok := listedAt[transaction.Metadata.AssetId]; ok && transaction.CreatedAt.After(createdAt) {
+			totalTimeToSell += transaction.CreatedAt.Sub(createdAt).Seconds()
+			stats.MatchedSales++
+		}
+
+		if price, err := GetNormalizedTransactionPrice(transaction); err == nil {
+			stats.RecentPrices = append(stats.RecentPrices, price)
+		}
+
+		if transaction.CreatedAt.After(stats.LastTransactionAt) {
+			stats.LastTransactionAt = transaction.CreatedAt
+		}
+	}
+
+	if stats.MatchedSales > 0 {
+		stats.AvgTimeToSell = totalTimeToSell / float64(stats.MatchedSales)
+	}
+	if over := len(stats.RecentPrices) - config.MaxRecentPrices; over > 0 {
+		stats.RecentPrices = stats.RecentPrices[over:]
+	}
+	stats.MedianSale = Median(stats.RecentPrices)
+}
+
+// PruneDailyCounts removes the days out of the window and recomputes the daily sales
+func PruneDailyCounts(stats *model.ItemStats, now time.Time, config *LiquidityConfig) {
+	start := now.UTC().AddDate(0, 0, -config.WindowDays+1).Format(STATS_DAY_LAYOUT)
+
+	var total int64
+	for day, count := range stats.DailyCounts {
+		// days in the layout sort as strings
+		if day < start {
+			delete(stats.DailyCounts, day)
+			continue
+		}
+		total += count
+	}
+	stats.DailySales = float64(total) / float64(config.WindowDays)
+}
+
+// SetSpread sets the lowest ask and the spread to the median sale price
+func SetSpread(stats *model.ItemStats, lowestAsk float64) {
+	stats.LowestAsk = lowestAsk
+	stats.Spread = 0
+	if lowestAsk > 0 && stats.MedianSale > 0 {
+		stats.Spread = (lowestAsk - stats.MedianSale) / lowestAsk
+	}
+}
+
+// Computes & caches the liquidity stats of items per market
+type LiquidityService struct {
+	transactionRepo *repository.TransactionRepository
+	listingRepo     *repository.ListingRepository
+	itemRepo        *repository.ItemRepository
+	statsRepo       *repository.StatsRepository
+	Config          LiquidityConfig
+}
+
+func NewLiquidityService(repos repository.RepoFactory, config LiquidityConfig) *LiquidityService {
+	return &LiquidityService{
+		transactionRepo: repos.GetTransactionRepository(),
+		listingRepo:     repos.GetListingRepository(),
+		itemRepo:        repos.GetItemRepository(),
+		statsRepo:       repos.GetStatsRepository(),
+		Config:          config,
+	}
+}
+
+// Refresh counts the transactions since the last refresh of the item on the market
+func (s *LiquidityService) Refresh(name, market string) (*model.ItemStats, error) {
+	now := time.Now()
+
+	stats, err := s.statsRepo.GetStats(name, market)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// first refresh, start from the window
+		stats = &model.ItemStats{
+			Name:              name,
+			Market:            market,
+			LastTransactionAt: now.AddDate(0, 0, -s.Config.WindowDays),
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.transactionRepo.FindTransactionsSince(name, market, stats.LastTransactionAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// match the sold assets with their listings
+	listedAt := make(map[string]time.Time)
+	if len(transactions) > 0 {
+		assetIds := make([]string, len(transactions))
+		for i := range transactions {
+			assetIds[i] = transactions[i].Metadata.AssetId
+		}
+		listings, err := s.listingRepo.FindListingsByAssetIds(market, assetIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, listing := range listings {
+			listedAt[listing.AssetId] = listing.CreatedAt
+		}
+	}
+
+	ApplyTransactions(stats, transactions, listedAt, &s.Config)
+	PruneDailyCounts(stats, now, &s.Config)
+
+	lowestAsk := 0.0
+	listing, err := s.listingRepo.GetBestListing(name, market)
+	if err == nil {
+		lowestAsk, _ = shared.NormalizePrice(listing.Price, shared.GetListingCurrency(listing))
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	SetSpread(stats, lowestAsk)
+
+	return stats, s.statsRepo.UpsertStats(stats)
+}
+
+// RefreshItem refreshes the stats of the item on all markets
+func (s *LiquidityService) RefreshItem(name string) ([]model.ItemStats, error) {
+	var stats []model.ItemStats
+	for _, market := range shared.ITEM_MARKET_NAMES {
+		marketStats, err := s.Refresh(name, market)
+		if err != nil {
+			return stats, err
+		}
+		stats = append(stats, *marketStats)
+	}
+	return stats, nil
+}
+
+// RefreshAll refreshes the stats of all items, errors of an item are logged and skipped
+func (s *LiquidityService) RefreshAll() error {
+	items, err := s.itemRepo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if _, err := s.RefreshItem(item.Name); err != nil {
+			log.Printf("LiquidityService.RefreshAll: %s: %v", item.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestApplyTransactions(t *testing.T) {
+	config := &LiquidityConfig{WindowDays: 2, MaxRecentPrices: 2}
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	newTransaction := func(assetId, price string, createdAt time.Time) model.Transaction {
+		return model.Transaction{
+			Metadata:  model.TransactionMetadata{Market: shared.MARKET_NAME_BUFF, AssetId: assetId},
+			Price:     shared.GetDecimal128(price),
+			CreatedAt: createdAt,
+		}
+	}
+
+	stats := &model.ItemStats{}
+	ApplyTransactions(stats, []model.Transaction{
+		newTransaction("1", "100", now.Add(-26*time.Hour)),
+		newTransaction("2", "110", now.Add(-2*time.Hour)),
+	}, map[string]time.Time{
+		"1": now.Add(-28 * time.Hour),
+	}, config)
+
+	if stats.MatchedSales != 1 || stats.AvgTimeToSell != 2*3600 {
+		t.Errorf("Expected 1 matched sale in 2h, got %d in %vs", stats.MatchedSales, stats.AvgTimeToSell)
+	}
+	if !stats.LastTransactionAt.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("Unexpected last transaction time: %v", stats.LastTransactionAt)
+	}
+
+	// incremental
+	ApplyTransactions(stats, []model.Transaction{
+		newTransaction("3", "120", now.Add(-time.Hour)),
+	}, map[string]time.Time{
+		"3": now.Add(-5 * time.Hour),
+	}, config)
+
+	if stats.MatchedSales != 2 || stats.AvgTimeToSell != 3*3600 {
+		t.Errorf("Expected 2 matched sales in 3h on average, got %d in %vs", stats.MatchedSales, stats.AvgTimeToSell)
+	}
+	if len(stats.RecentPrices) != 2 || stats.MedianSale != 115 {
+		t.Errorf("Expected the 2 latest prices, got %v", stats.RecentPrices)
+	}
+
+	PruneDailyCounts(stats, now, config)
+	if len(stats.DailyCounts) != 2 || stats.DailySales != 1.5 {
+		t.Errorf("Expected 3 sales in 2 days, got %v", stats.DailyCounts)
+	}
+
+	// the first day falls out of the window
+	PruneDailyCounts(stats, now.Add(24*time.Hour), config)
+	if len(stats.DailyCounts) != 1 || stats.DailySales != 1 {
+		t.Errorf("Expected 2 sales in the window, got %v", stats.DailyCounts)
+	}
+}
+
+func TestSetSpread(t *testing.T) {
+	stats := &model.ItemStats{MedianSale: 90}
+
+	SetSpread(stats, 100)
+	if math.Abs(stats.Spread-0.1) > 1e-9 {
+		t.Errorf("Expected 0.1, got %v", stats.Spread)
+	}
+
+	SetSpread(stats, 0)
+	if stats.Spread != 0 {
+		t.Errorf("Expected no spread without listings, got %v", stats.Spread)
+	}
+}
@@ -0,0 +1,271 @@
+package analytics
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Valuation of a holding, amounts in the normalized currency
+type HoldingValuation struct {
+	Holding *model.Holding
+	// purchase price of all units
+	Cost float64
+	// best market price of all units, 0 if unpriced or sold
+	Price  float64
+	Market string
+	// net proceeds of selling at the best price
+	NetValue float64
+	// net value minus cost, 0 if unpriced or sold
+	UnrealizedPnL float64
+	// net proceeds of the sale minus cost, 0 if held
+	RealizedPnL float64
+	Sold        bool
+	// false if the item has no market price, or is priced by Doppler phase
+	Priced bool
+	// the best price is older than the fresh price duration
+	Stale bool
+}
+
+// Valuation of the holdings of a user, amounts in the normalized currency
+type Valuation struct {
+	Holdings []HoldingValuation
+	// cost of the held assets, unpriced included
+	Cost float64
+	// market & net value of the priced held assets
+	Value         float64
+	NetValue      float64
+	UnrealizedPnL float64
+	RealizedPnL   float64
+	// number of held assets, and those without a price
+	Held     int
+	Unpriced int
+}
+
+// currency of an amount of the market, empty currency for the default currency of the market
+func getHoldingCurrency(currency, market string) string {
+	if currency != "" {
+		return currency
+	}
+	if market == "" {
+		return shared.NORMALIZED_CURRENCY
+	}
+	return shared.GetMarketCurrency(market)
+}
+
+// @return units of the holding, at least 1
+func GetHoldingAmount(holding *model.Holding) int {
+	if holding.Amount < 1 {
+		return 1
+	}
+	return holding.Amount
+}
+
+// ValueHolding values the holding against the best fresh price of its item at now, item nil if not found
+func ValueHolding(holding *model.Holding, item *model.Item, now time.Time) (*HoldingValuation, error) {
+	cost, err := shared.NormalizePrice(holding.PurchasePrice, getHoldingCurrency(holding.PurchaseCurrency, holding.PurchaseMarket))
+	if err != nil {
+		return nil, err
+	}
+	amount := float64(GetHoldingAmount(holding))
+	valuation := &HoldingValuation{Holding: holding, Cost: cost * amount}
+
+	if holding.SoldAt != nil {
+		if holding.SalePrice == nil {
+			return nil, fmt.Errorf("holding %s sold without a sale price", holding.ID.Hex())
+		}
+		currency := getHoldingCurrency(holding.SaleCurrency, holding.SaleMarket)
+		proceeds := shared.GetMarketFee(holding.SaleMarket).NetProceeds(shared.DecToFloat(*holding.SalePrice))
+		proceeds, err := shared.ConvertAmount(proceeds, currency, shared.NORMALIZED_CURRENCY)
+		if err != nil {
+			return nil, err
+		}
+		valuation.Sold = true
+		valuation.RealizedPnL = (proceeds - cost) * amount
+		return valuation, nil
+	}
+
+	// the item price is not of the phase, phased holdings are left unpriced
+	if shared.ParseItemName(holding.Name).HasPhases() {
+		return valuation, nil
+	}
+
+	market, bestPrice, stale := getBestMarketPrice(item, now)
+	if market == "" {
+		return valuation, nil
+	}
+	netValue, err := shared.ConvertAmount(
+		shared.GetMarketFee(market).NetProceeds(bestPrice.amount),
+		bestPrice.currency, shared.NORMALIZED_CURRENCY,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	valuation.Priced = true
+	valuation.Stale = stale
+	valuation.Market = market
+	valuation.Price = bestPrice.normalized * amount
+	valuation.NetValue = netValue * amount
+	valuation.UnrealizedPnL = valuation.NetValue - valuation.Cost
+	return valuation, nil
+}
+
+// @return the market & best fresh price of the item at now, the best stale price if none is fresh, empty market if no price
+func getBestMarketPrice(item *model.Item, now time.Time) (string, marketAmount, bool) {
+	if item == nil {
+		return "", marketAmount{}, false
+	}
+
+	stale := false
+	prices := getFreshPrices(item, shared.FRESH_PRICE_DURATION, now)
+	if len(prices) == 0 {
+		stale = true
+		prices = getFreshPrices(item, 0, now)
+	}
+
+	bestMarket := ""
+	for _, market := range shared.ITEM_MARKET_NAMES {
+		if price, ok := prices[market]; ok && (bestMarket == "" || price.normalized < prices[bestMarket].normalized) {
+			bestMarket = market
+		}
+	}
+	return bestMarket, prices[bestMarket], stale
+}
+
+// ValuePortfolio values the holdings, holdings failing to value are logged & skipped
+// @param items item name -> item
+func ValuePortfolio(holdings []model.Holding, items map[string]*model.Item, now time.Time) *Valuation {
+	valuation := &Valuation{Holdings: make([]HoldingValuation, 0, len(holdings))}
+	for i := range holdings {
+		holding := &holdings[i]
+		holdingValuation, err := ValueHolding(holding, items[holding.Name], now)
+		if err != nil {
+			log.Printf("ValuePortfolio: %s: %v", holding.Name, err)
+			continue
+		}
+		valuation.Holdings = append(valuation.Holdings, *holdingValuation)
+
+		if holdingValuation.Sold {
+			valuation.RealizedPnL += holdingValuation.RealizedPnL
+			continue
+		}
+		valuation.Held++
+		valuation.Cost += holdingValuation.Cost
+		if !holdingValuation.Priced {
+			valuation.Unpriced++
+			continue
+		}
+		valuation.Value += holdingValuation.Price
+		valuation.NetValue += holdingValuation.NetValue
+		valuation.UnrealizedPnL += holdingValuation.UnrealizedPnL
+	}
+	return valuation
+}
+
+// Snapshot of the valuation for the portfolio history
+func (v *Valuation) Snapshot(ownerId primitive.ObjectID, createdAt time.Time) *model.PortfolioSnapshot {
+	return &model.PortfolioSnapshot{
+		OwnerId:       ownerId,
+		Cost:          v.Cost,
+		Value:         v.Value,
+		NetValue:      v.NetValue,
+		RealizedPnL:   v.RealizedPnL,
+		UnrealizedPnL: v.UnrealizedPnL,
+		Holdings:      v.Held,
+		Unpriced:      v.Unpriced,
+		CreatedAt:     createdAt,
+	}
+}
+
+// Values the holdings of users & records their history
+type PortfolioService struct {
+	portfolioRepo *repository.PortfolioRepository
+	itemRepo      *repository.ItemRepository
+}
+
+func NewPortfolioService(repos repository.RepoFactory) *PortfolioService {
+	return &PortfolioService{
+		portfolioRepo: repos.GetPortfolioRepository(),
+		itemRepo:      repos.GetItemRepository(),
+	}
+}
+
+// @return item name -> item of the held holdings
+func (s *PortfolioService) getHeldItems(holdings []model.Holding) (map[string]*model.Item, error) {
+	var names []string
+	for i := range holdings {
+		if holdings[i].SoldAt == nil {
+			names = append(names, holdings[i].Name)
+		}
+	}
+	return s.getItems(names)
+}
+
+// @return item name -> item, missing names are skipped
+func (s *PortfolioService) getItems(names []string) (map[string]*model.Item, error) {
+	items := make(map[string]*model.Item, len(names))
+	if len(names) == 0 {
+		return items, nil
+	}
+	slices.Sort(names)
+	found, err := s.itemRepo.FindItemsByNames(slices.Compact(names))
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		items[found[i].Name] = &found[i]
+	}
+	return items, nil
+}
+
+// GetValuation values the held & sold holdings of the owner at the current prices
+func (s *PortfolioService) GetValuation(ownerId primitive.ObjectID) (*Valuation, error) {
+	holdings, err := s.portfolioRepo.GetHoldingsByOwnerId(ownerId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.getHeldItems(holdings)
+	if err != nil {
+		return nil, err
+	}
+	return ValuePortfolio(holdings, items, time.Now()), nil
+}
+
+// TakeSnapshot values the portfolio of the owner & saves it to the history
+func (s *PortfolioService) TakeSnapshot(ownerId primitive.ObjectID) (*model.PortfolioSnapshot, error) {
+	valuation, err := s.GetValuation(ownerId)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := valuation.Snapshot(ownerId, time.Now())
+	if err := s.portfolioRepo.InsertSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// TakeAllSnapshots snapshots the portfolios of all owners with held assets, owners failing are logged & skipped
+func (s *PortfolioService) TakeAllSnapshots() error {
+	ownerIds, err := s.portfolioRepo.GetAllOwnerIds()
+	if err != nil {
+		return err
+	}
+	for _, ownerId := range ownerIds {
+		if _, err := s.TakeSnapshot(ownerId); err != nil {
+			log.Printf("PortfolioService.TakeAllSnapshots: %s: %v", ownerId.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// @return the portfolio history of the owner in the last days, oldest first
+func (s *PortfolioService) GetHistory(ownerId primitive.ObjectID, days int) ([]model.PortfolioSnapshot, error) {
+	return s.portfolioRepo.GetSnapshots(ownerId, time.Now().AddDate(0, 0, -days))
+}
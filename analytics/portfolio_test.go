@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValuePortfolio(t *testing.T) {
+	defer shared.SetRateProvider(shared.GetRateProvider())
+	shared.SetRateProvider(shared.NewStaticRateProvider(shared.CURRENCY_USD, map[string]float64{shared.CURRENCY_CNY: 7}))
+
+	now := time.Now()
+	soldAt := now.Add(-time.Hour)
+	salePrice := shared.GetDecimal128("200")
+	items := map[string]*model.Item{
+		"AK-47 | Redline (Field-Tested)": {
+			Name:      "AK-47 | Redline (Field-Tested)",
+			BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128("120"), UpdatedAt: now},
+			UUPrice:   &model.MarketPrice{Price: shared.GetDecimal128("110"), UpdatedAt: now},
+		},
+	}
+	holdings := []model.Holding{
+		// bought $10 on steam
+		{Name: "AK-47 | Redline (Field-Tested)", PurchasePrice: shared.GetDecimal128("10"), PurchaseMarket: shared.MARKET_NAME_STEAM},
+		// no price
+		{Name: "AWP | Asiimov (Field-Tested)", PurchasePrice: shared.GetDecimal128("300")},
+		// sold on buff
+		{
+			Name:          "AK-47 | Redline (Field-Tested)",
+			PurchasePrice: shared.GetDecimal128("100"), PurchaseMarket: shared.MARKET_NAME_BUFF,
+			SalePrice: &salePrice, SaleMarket: shared.MARKET_NAME_BUFF, SoldAt: &soldAt,
+		},
+	}
+
+	valuation := ValuePortfolio(holdings, items, now)
+	if len(valuation.Holdings) != 3 || valuation.Held != 2 || valuation.Unpriced != 1 {
+		t.Fatalf("Expected 2 held & 1 unpriced, got %+v", valuation)
+	}
+
+	held := valuation.Holdings[0]
+	if !held.Priced || held.Stale || held.Market != shared.MARKET_NAME_UU || held.Cost != 70 || held.Price != 110 {
+		t.Errorf("Expected ¥70 valued at the uu price ¥110, got %+v", held)
+	}
+	netValue := shared.GetMarketFee(shared.MARKET_NAME_UU).NetProceeds(110)
+	if math.Abs(held.UnrealizedPnL-(netValue-70)) > 1e-9 {
+		t.Errorf("Expected unrealized P&L %v, got %v", netValue-70, held.UnrealizedPnL)
+	}
+
+	if valuation.Cost != 370 || valuation.Value != 110 || valuation.UnrealizedPnL != held.UnrealizedPnL {
+		t.Errorf("Expected the unpriced holding in the cost only, got %+v", valuation)
+	}
+
+	realized := shared.GetMarketFee(shared.MARKET_NAME_BUFF).NetProceeds(200) - 100
+	if sold := valuation.Holdings[2]; !sold.Sold || sold.Priced || math.Abs(sold.RealizedPnL-realized) > 1e-9 {
+		t.Errorf("Expected realized P&L %v, got %+v", realized, sold)
+	}
+	if math.Abs(valuation.RealizedPnL-realized) > 1e-9 {
+		t.Errorf("Expected realized P&L %v, got %v", realized, valuation.RealizedPnL)
+	}
+
+	ownerId := primitive.NewObjectID()
+	snapshot := valuation.Snapshot(ownerId, now)
+	if snapshot.OwnerId != ownerId || snapshot.Holdings != 2 || snapshot.Cost != valuation.Cost || snapshot.RealizedPnL != valuation.RealizedPnL {
+		t.Errorf("Expected the snapshot of the valuation, got %+v", snapshot)
+	}
+
+	// stale prices are still valued
+	items["AK-47 | Redline (Field-Tested)"].UUPrice.UpdatedAt = now.Add(-48 * time.Hour)
+	items["AK-47 | Redline (Field-Tested)"].BuffPrice.UpdatedAt = now.Add(-48 * time.Hour)
+	if held, err := ValueHolding(&holdings[0], items["AK-47 | Redline (Field-Tested)"], now); err != nil || !held.Priced || !held.Stale {
+		t.Errorf("Expected a stale valuation, got %+v, %v", held, err)
+	}
+	// a fresh price is preferred over a cheaper stale one
+	items["AK-47 | Redline (Field-Tested)"].BuffPrice.UpdatedAt = now
+	if held, err := ValueHolding(&holdings[0], items["AK-47 | Redline (Field-Tested)"], now); err != nil || held.Stale || held.Market != shared.MARKET_NAME_BUFF {
+		t.Errorf("Expected the fresh buff price, got %+v, %v", held, err)
+	}
+
+	// sold without a sale price
+	if _, err := ValueHolding(&model.Holding{Name: "AK-47 | Redline (Field-Tested)", PurchasePrice: shared.GetDecimal128("10"), SoldAt: &soldAt}, nil, now); err == nil {
+		t.Errorf("Expected error for a sale without price")
+	}
+}
@@ -0,0 +1,232 @@
+package analytics
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Premium of a pattern tier over the base price of the item, prices are in shared.NORMALIZED_CURRENCY
+type PremiumEstimate struct {
+	Name string
+	Tier string
+	// median price of the tier
+	MedianPrice float64
+	// median price of the sales without tier
+	BasePrice float64
+	// e.g. 0.85 for +85%
+	Premium float64
+	Samples int
+}
+
+// Median of the values, 0 if empty
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Price of the transaction in the normalized currency
+func GetNormalizedTransactionPrice(transaction *model.Transaction) (float64, error) {
+	return shared.NormalizePrice(transaction.Price, shared.GetMarketCurrency(transaction.Metadata.Market))
+}
+
+// EstimateBasePrice returns the median price of the sales without tier, 0 if none
+func EstimateBasePrice(transactions []model.Transaction) float64 {
+	var prices []float64
+	for i := range transactions {
+		if transactions[i].Rarity != "" {
+			continue
+		}
+		price, err := GetNormalizedTransactionPrice(&transactions[i])
+		if err != nil {
+			log.Printf("EstimateBasePrice: %s: %v", transactions[i].Name, err)
+			continue
+		}
+		prices = append(prices, price)
+	}
+	return Median(prices)
+}
+
+// EstimatePremiums estimates the premium of each tier from the transactions of the same item
+// @return tier -> estimate, tiers with less than minSamples sales or items without base sales are skipped
+func EstimatePremiums(transactions []model.Transaction, minSamples int) map[string]*PremiumEstimate {
+	var basePrices []float64
+	tierPrices := make(map[string][]float64)
+	name := ""
+
+	for i := range transactions {
+		price, err := GetNormalizedTransactionPrice(&transactions[i])
+		if err != nil {
+			log.Printf("EstimatePremiums: %s: %v", transactions[i].Name, err)
+			continue
+		}
+		name = transactions[i].Name
+
+		// the tier is recorded by the scrapers with shared.GetTier
+		tier := transactions[i].Rarity
+		if tier == "" {
+			basePrices = append(basePrices, price)
+		} else {
+			tierPrices[tier] = append(tierPrices[tier], price)
+		}
+	}
+
+	estimates := make(map[string]*PremiumEstimate)
+	basePrice := Median(basePrices)
+	if basePrice <= 0 {
+		return estimates
+	}
+
+	for tier, prices := range tierPrices {
+		if len(prices) < minSamples {
+			continue
+		}
+		median := Median(prices)
+		estimates[tier] = &PremiumEstimate{
+			Name:        name,
+			Tier:        tier,
+			MedianPrice: median,
+			BasePrice:   basePrice,
+			Premium:     median/basePrice - 1,
+			Samples:     len(prices),
+		}
+	}
+	return estimates
+}
+
+// Estimates the tier premiums from the recent transactions, cached per item
+type PremiumEstimator struct {
+	transactionRepo *repository.TransactionRepository
+
+	// transactions in the last days are used
+	Days       int
+	MinSamples int
+	// cached estimates are refreshed after
+	CacheDuration time.Duration
+
+	// item name -> tier -> estimate
+	estimates map[string]map[string]*PremiumEstimate
+	// item name -> median price of the sales without tier
+	basePrices map[string]float64
+	// item name -> estimated at
+	estimatedAt map[string]time.Time
+	mu          sync.Mutex
+}
+
+func NewPremiumEstimator(repos repository.RepoFactory) *PremiumEstimator {
+	return &PremiumEstimator{
+		transactionRepo: repos.GetTransactionRepository(),
+		Days:            30,
+		MinSamples:      3,
+		CacheDuration:   6 * time.Hour,
+		estimates:       make(map[string]map[string]*PremiumEstimate),
+		basePrices:      make(map[string]float64),
+		estimatedAt:     make(map[string]time.Time),
+	}
+}
+
+// Refresh re-estimates the premiums of the item
+func (p *PremiumEstimator) Refresh(name string) (map[string]*PremiumEstimate, error) {
+	// synthetic sales are priced at the last ask, not the trade
+	transactions, err := p.transactionRepo.FindItemByDays(p.Days, bson.M{"name": name, "metadata.synthetic": bson.M{"$ne": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	estimates := EstimatePremiums(transactions, p.MinSamples)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.estimates[name] = estimates
+	p.basePrices[name] = EstimateBasePrice(transactions)
+	p.estimatedAt[name] = time.Now()
+	return estimates, nil
+}
+
+// GetPremiums returns the cached estimates of the item, refreshed if expired
+func (p *PremiumEstimator) GetPremiums(name string) (map[string]*PremiumEstimate, error) {
+	p.mu.Lock()
+	estimates, ok := p.estimates[name]
+	fresh := ok && time.Since(p.estimatedAt[name]) < p.CacheDuration
+	p.mu.Unlock()
+
+	if fresh {
+		return estimates, nil
+	}
+	return p.Refresh(name)
+}
+
+func (p *PremiumEstimator) GetPremium(name, tier string) (*PremiumEstimate, bool) {
+	if tier == "" {
+		return nil, false
+	}
+
+	estimates, err := p.GetPremiums(name)
+	if err != nil {
+		log.Printf("PremiumEstimator.GetPremium: %s: %v", name, err)
+		return nil, false
+	}
+	estimate, ok := estimates[tier]
+	return estimate, ok
+}
+
+// GetBasePrice returns the median recent sale price of the item without tier
+func (p *PremiumEstimator) GetBasePrice(name string) (float64, bool) {
+	if _, err := p.GetPremiums(name); err != nil {
+		log.Printf("PremiumEstimator.GetBasePrice: %s: %v", name, err)
+		return 0, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	basePrice := p.basePrices[name]
+	return basePrice, basePrice > 0
+}
+
+// GetTierPremium implements subscription.PremiumProvider
+func (p *PremiumEstimator) GetTierPremium(name, tier string) (float64, bool) {
+	estimate, ok := p.GetPremium(name, tier)
+	if !ok {
+		return 0, false
+	}
+	return estimate.Premium, true
+}
+
+// FairValue returns the expected price of the listing in the normalized currency,
+// the base price is the current min price of the item, or the median base sale price if 0
+func (p *PremiumEstimator) FairValue(listing *model.Listing, basePrice float64) (float64, bool) {
+	// no tier is worth the base price
+	tier := listing.Rarity
+	if tier == "" {
+		if basePrice > 0 {
+			return basePrice, true
+		}
+		return 0, false
+	}
+
+	estimate, ok := p.GetPremium(listing.Name, tier)
+	if !ok {
+		return 0, false
+	}
+	if basePrice <= 0 {
+		basePrice = estimate.BasePrice
+	}
+	return basePrice * (1 + estimate.Premium), true
+}
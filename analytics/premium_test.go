@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestMedian(t *testing.T) {
+	testCases := []struct {
+		values   []float64
+		expected float64
+	}{
+		{nil, 0},
+		{[]float64{3}, 3},
+		{[]float64{5, 1, 3}, 3},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+
+	for _, tc := range testCases {
+		if actual := Median(tc.values); actual != tc.expected {
+			t.Errorf("Median(%v): expected %v, got %v", tc.values, tc.expected, actual)
+		}
+	}
+}
+
+func TestEstimatePremiums(t *testing.T) {
+	name := "★ Bayonet | Marble Fade (Factory New)"
+	newTransaction := func(price, tier string) model.Transaction {
+		return model.Transaction{
+			Name:     name,
+			Metadata: model.TransactionMetadata{Market: shared.MARKET_NAME_BUFF},
+			Price:    shared.GetDecimal128(price),
+			Rarity:   tier,
+		}
+	}
+
+	transactions := []model.Transaction{
+		newTransaction("1000", ""),
+		newTransaction("1100", ""),
+		newTransaction("900", ""),
+		newTransaction("1800", "FFI"),
+		newTransaction("1850", "FFI"),
+		newTransaction("2000", "FFI"),
+		// not enough samples
+		newTransaction("3000", "Max Blue"),
+	}
+
+	estimates := EstimatePremiums(transactions, 2)
+	if len(estimates) != 1 {
+		t.Fatalf("Expected 1 estimate, got %v", estimates)
+	}
+
+	estimate := estimates["FFI"]
+	if estimate == nil || estimate.BasePrice != 1000 || estimate.MedianPrice != 1850 || estimate.Samples != 3 {
+		t.Fatalf("Unexpected estimate: %+v", estimate)
+	}
+	if math.Abs(estimate.Premium-0.85) > 1e-9 {
+		t.Errorf("Expected +85%%, got %v", estimate.Premium)
+	}
+
+	// no base sales to compare with
+	if estimates := EstimatePremiums(transactions[3:], 1); len(estimates) != 0 {
+		t.Errorf("Expected no estimates, got %v", estimates)
+	}
+}
@@ -0,0 +1,170 @@
+package analytics
+
+import (
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Listings of an item seen on a market in one scrape
+type ListingSnapshot struct {
+	Name   string
+	Market string
+	// Optional, assets seen in the scrape, nil to rely on CheckedAt only
+	AssetIds []string
+	// Start of the scrape, listings checked before are not seen in the scrape
+	CheckedAt time.Time
+}
+
+type ReconcileResult struct {
+	Sold     []model.Listing
+	Delisted []model.Listing
+	// transactions synthesized for the sold listings without one
+	Synthesized []model.Transaction
+}
+
+// GetRemovedListings returns the active listings not seen in the snapshot
+func GetRemovedListings(listings []model.Listing, snapshot *ListingSnapshot) []model.Listing {
+	var seen map[string]bool
+	if snapshot.AssetIds != nil {
+		seen = make(map[string]bool, len(snapshot.AssetIds))
+		for _, assetId := range snapshot.AssetIds {
+			seen[assetId] = true
+		}
+	}
+
+	var removed []model.Listing
+	for _, listing := range listings {
+		if seen[listing.AssetId] || !listing.CheckedAt.Before(snapshot.CheckedAt) {
+			continue
+		}
+		removed = append(removed, listing)
+	}
+	return removed
+}
+
+// NewSyntheticTransaction infers the sale of the listing at its last price
+func NewSyntheticTransaction(listing *model.Listing, soldAt time.Time) model.Transaction {
+	return model.Transaction{
+		ID: primitive.NewObjectID(),
+		Metadata: model.TransactionMetadata{
+			Market:    listing.Market,
+			AssetId:   listing.AssetId,
+			Synthetic: true,
+		},
+		Name:             listing.Name,
+		CreatedAt:        soldAt,
+		Price:            listing.Price,
+		PreviewUrl:       listing.PreviewUrl,
+		GoodsId:          listing.GoodsId,
+		ClassId:          listing.ClassId,
+		TradableCooldown: listing.TradableCooldown,
+		PaintWear:        listing.PaintWear,
+		PaintIndex:       listing.PaintIndex,
+		PaintSeed:        listing.PaintSeed,
+		Rarity:           listing.Rarity,
+		Phase:            listing.Phase,
+		InstanceId:       listing.InstanceId,
+	}
+}
+
+// MarkRemoved sets the removal fields, sold if the transaction is known
+func MarkRemoved(listing *model.Listing, transaction *model.Transaction, removedAt time.Time) {
+	listing.RemovedAt = &removedAt
+	listing.Status = shared.LISTING_STATUS_DELISTED
+
+	endAt := removedAt
+	if transaction != nil {
+		listing.Status = shared.LISTING_STATUS_SOLD
+		listing.TransactionId = transaction.ID
+		endAt = transaction.CreatedAt
+	}
+
+	if !listing.CreatedAt.IsZero() && endAt.After(listing.CreatedAt) {
+		listing.TimeOnMarket = int64(endAt.Sub(listing.CreatedAt).Seconds())
+	}
+}
+
+// Marks the listings that disappeared from the markets as sold or delisted
+type ListingReconciler struct {
+	listingRepo     *repository.ListingRepository
+	transactionRepo *repository.TransactionRepository
+	// Assume the disappeared listings without transaction were sold, and synthesize their transactions
+	SynthesizeSales bool
+}
+
+func NewListingReconciler(repos repository.RepoFactory) *ListingReconciler {
+	return &ListingReconciler{
+		listingRepo:     repos.GetListingRepository(),
+		transactionRepo: repos.GetTransactionRepository(),
+	}
+}
+
+// Reconcile compares the snapshot with the active listings of the item on the market
+func (r *ListingReconciler) Reconcile(snapshot *ListingSnapshot) (*ReconcileResult, error) {
+	listings, err := r.listingRepo.FindActiveListings(snapshot.Name, snapshot.Market)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{}
+	removed := GetRemovedListings(listings, snapshot)
+	if len(removed) == 0 {
+		return result, nil
+	}
+
+	// link the transactions by asset id
+	assetIds := make([]string, len(removed))
+	for i := range removed {
+		assetIds[i] = removed[i].AssetId
+	}
+	transactions, err := r.transactionRepo.FindTransactionsByAssetIds(snapshot.Market, assetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// asset id -> the latest transaction
+	assetTransactions := make(map[string]*model.Transaction)
+	for i := range transactions {
+		transaction := &transactions[i]
+		if prev, ok := assetTransactions[transaction.Metadata.AssetId]; !ok || transaction.CreatedAt.After(prev.CreatedAt) {
+			assetTransactions[transaction.Metadata.AssetId] = transaction
+		}
+	}
+
+	for i := range removed {
+		listing := &removed[i]
+
+		// a transaction before the listing is from a previous sale of the asset
+		transaction, ok := assetTransactions[listing.AssetId]
+		if ok && transaction.CreatedAt.Before(listing.CreatedAt) {
+			transaction = nil
+		}
+
+		if transaction == nil && r.SynthesizeSales {
+			synthesized := NewSyntheticTransaction(listing, snapshot.CheckedAt)
+			result.Synthesized = append(result.Synthesized, synthesized)
+			transaction = &result.Synthesized[len(result.Synthesized)-1]
+		}
+
+		MarkRemoved(listing, transaction, snapshot.CheckedAt)
+		if listing.Status == shared.LISTING_STATUS_SOLD {
+			result.Sold = append(result.Sold, *listing)
+		} else {
+			result.Delisted = append(result.Delisted, *listing)
+		}
+	}
+
+	if len(result.Synthesized) > 0 {
+		if err := r.transactionRepo.InsertTransactions(result.Synthesized); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.listingRepo.MarkListingsRemoved(removed); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
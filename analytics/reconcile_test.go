@@ -0,0 +1,69 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetRemovedListings(t *testing.T) {
+	scrapedAt := time.Now()
+	listings := []model.Listing{
+		// checked in the scrape
+		{AssetId: "1", CheckedAt: scrapedAt.Add(time.Minute)},
+		// in the snapshot
+		{AssetId: "2", CheckedAt: scrapedAt.Add(-time.Hour)},
+		// gone
+		{AssetId: "3", CheckedAt: scrapedAt.Add(-time.Hour)},
+	}
+
+	removed := GetRemovedListings(listings, &ListingSnapshot{AssetIds: []string{"2"}, CheckedAt: scrapedAt})
+	if len(removed) != 1 || removed[0].AssetId != "3" {
+		t.Errorf("Expected asset 3 removed, got %v", removed)
+	}
+
+	// CheckedAt only
+	removed = GetRemovedListings(listings, &ListingSnapshot{CheckedAt: scrapedAt})
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 removed, got %v", removed)
+	}
+}
+
+func TestMarkRemoved(t *testing.T) {
+	createdAt := time.Now().Add(-2 * time.Hour)
+	removedAt := createdAt.Add(2 * time.Hour)
+
+	listing := &model.Listing{CreatedAt: createdAt}
+	MarkRemoved(listing, nil, removedAt)
+	if listing.Status != shared.LISTING_STATUS_DELISTED || listing.TimeOnMarket != 7200 || !listing.RemovedAt.Equal(removedAt) {
+		t.Errorf("Unexpected delisted listing: %+v", listing)
+	}
+
+	transaction := &model.Transaction{ID: primitive.NewObjectID(), CreatedAt: createdAt.Add(time.Hour)}
+	listing = &model.Listing{CreatedAt: createdAt}
+	MarkRemoved(listing, transaction, removedAt)
+	if listing.Status != shared.LISTING_STATUS_SOLD || listing.TimeOnMarket != 3600 || listing.TransactionId != transaction.ID {
+		t.Errorf("Unexpected sold listing: %+v", listing)
+	}
+}
+
+func TestNewSyntheticTransaction(t *testing.T) {
+	listing := &model.Listing{
+		Name:      "AK-47 | Redline (Field-Tested)",
+		Market:    shared.MARKET_NAME_BUFF,
+		AssetId:   "1",
+		Price:     shared.GetDecimal128("100"),
+		PaintSeed: 661,
+	}
+	soldAt := time.Now()
+
+	transaction := NewSyntheticTransaction(listing, soldAt)
+	if !transaction.Metadata.Synthetic || transaction.ID.IsZero() || transaction.Metadata.AssetId != "1" ||
+		transaction.Metadata.Market != shared.MARKET_NAME_BUFF || transaction.Price != listing.Price ||
+		transaction.PaintSeed != 661 || !transaction.CreatedAt.Equal(soldAt) {
+		t.Errorf("Unexpected transaction: %+v", transaction)
+	}
+}
@@ -0,0 +1,185 @@
+package analytics
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+)
+
+type ScoreConfig struct {
+	// premium of the lowest float over the highest float within the same exterior, e.g. 0.1 for 10%
+	WearPremium float64
+	// share of the sticker prices added to the value, applied stickers sell far below their price
+	StickerValueRate float64
+}
+
+var DefaultScoreConfig = ScoreConfig{
+	WearPremium:      0.1,
+	StickerValueRate: 0.05,
+}
+
+// Inputs of the expected value of a listing, prices are in shared.NORMALIZED_CURRENCY
+type ScoreInputs struct {
+	// price of the item without tier, stickers & float premium
+	BasePrice float64
+	// premium of the tier of the listing, e.g. 0.85 for +85%
+	TierPremium float64
+	// sticker name -> price
+	StickerPrices map[string]float64
+}
+
+// Position of the paint wear within its exterior range, 0 for the best float, 0.5 if unknown
+func GetWearPosition(name string, paintWear float64) float64 {
+	exterior := shared.ParseItemName(name).Exterior
+	wearRange, ok := shared.WEAR_RANGES[exterior]
+	if !ok || paintWear <= 0 {
+		return 0.5
+	}
+	pos := (paintWear - wearRange[0]) / (wearRange[1] - wearRange[0])
+	return math.Min(math.Max(pos, 0), 1)
+}
+
+// ExpectedValue returns the fair value of the listing from its wear, tier and stickers
+func ExpectedValue(listing *model.Listing, inputs *ScoreInputs, config *ScoreConfig) float64 {
+	if inputs.BasePrice <= 0 {
+		return 0
+	}
+
+	// neutral at the middle of the exterior range
+	wearMultiplier := 1 + config.WearPremium*(0.5-GetWearPosition(listing.Name, shared.DecToFloat(listing.PaintWear)))
+	value := inputs.BasePrice * (1 + inputs.TierPremium) * wearMultiplier
+
+	for _, sticker := range listing.Stickers {
+		price, ok := inputs.StickerPrices[sticker.Name]
+		if !ok {
+			continue
+		}
+		value += price * config.StickerValueRate * (1 - sticker.Wear)
+	}
+	return value
+}
+
+// Discount of the price to the fair value, negative if overpriced
+func GetDiscount(price, fairValue float64) float64 {
+	if fairValue <= 0 {
+		return 0
+	}
+	return 1 - price/fairValue
+}
+
+// Scores listings against their fair values
+type ListingScorer struct {
+	premiums    *PremiumEstimator
+	itemRepo    *repository.ItemRepository
+	listingRepo *repository.ListingRepository
+	Config      ScoreConfig
+
+	// sticker name -> normalized price, stickers without price are cached as 0
+	stickerPrices map[string]float64
+	mu            sync.Mutex
+}
+
+func NewListingScorer(repos repository.RepoFactory, premiums *PremiumEstimator, config ScoreConfig) *ListingScorer {
+	return &ListingScorer{
+		premiums:      premiums,
+		itemRepo:      repos.GetItemRepository(),
+		listingRepo:   repos.GetListingRepository(),
+		Config:        config,
+		stickerPrices: make(map[string]float64),
+	}
+}
+
+// base price from the recent sales, or the current min price if no sales
+func (s *ListingScorer) getBasePrice(name string) (float64, bool) {
+	if basePrice, ok := s.premiums.GetBasePrice(name); ok {
+		return basePrice, true
+	}
+
+	item, err := s.itemRepo.FindItemByName(name)
+	if err != nil {
+		return 0, false
+	}
+	price, err := getNormalizedBestPrice(item)
+	if err != nil {
+		return 0, false
+	}
+	return price, price > 0
+}
+
+func getNormalizedBestPrice(item *model.Item) (float64, error) {
+	bestPrice := shared.GetFreshBestPrice(item, shared.FRESH_PRICE_DURATION)
+	if bestPrice == nil {
+		return 0, nil
+	}
+	return shared.NormalizePrice(bestPrice.Price, shared.GetItemPriceCurrency(item, bestPrice))
+}
+
+func (s *ListingScorer) getStickerPrices(stickers []model.Sticker) map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prices := make(map[string]float64)
+	for _, sticker := range stickers {
+		price, ok := s.stickerPrices[sticker.Name]
+		if !ok {
+			if item, err := s.itemRepo.FindItemByName(sticker.Name); err == nil {
+				price, _ = getNormalizedBestPrice(item)
+			}
+			s.stickerPrices[sticker.Name] = price
+		}
+		if price > 0 {
+			prices[sticker.Name] = price
+		}
+	}
+	return prices
+}
+
+// Score sets the fair value & discount of the listing
+// @return false if the item has no price to compare with
+func (s *ListingScorer) Score(listing *model.Listing) bool {
+	basePrice, ok := s.getBasePrice(listing.Name)
+	if !ok {
+		return false
+	}
+
+	inputs := &ScoreInputs{
+		BasePrice:     basePrice,
+		StickerPrices: s.getStickerPrices(listing.Stickers),
+	}
+	if premium, ok := s.premiums.GetTierPremium(listing.Name, listing.Rarity); ok {
+		inputs.TierPremium = premium
+	}
+
+	price, err := shared.NormalizePrice(listing.Price, shared.GetListingCurrency(listing))
+	if err != nil {
+		log.Printf("ListingScorer.Score: %s: %v", listing.Name, err)
+		return false
+	}
+
+	listing.FairValue = ExpectedValue(listing, inputs, &s.Config)
+	listing.Discount = GetDiscount(price, listing.FairValue)
+	return listing.FairValue > 0
+}
+
+// ScoreListings scores and saves the listings
+// @return number of scored listings
+func (s *ListingScorer) ScoreListings(listings []model.Listing) (int, error) {
+	var scored []model.Listing
+	for i := range listings {
+		if s.Score(&listings[i]) {
+			scored = append(scored, listings[i])
+		}
+	}
+	return len(scored), s.listingRepo.UpdateListingScores(scored)
+}
+
+// ClearStickerPrices clears the cached sticker prices
+func (s *ListingScorer) ClearStickerPrices() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stickerPrices = make(map[string]float64)
+}
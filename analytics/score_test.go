@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestGetWearPosition(t *testing.T) {
+	testCases := []struct {
+		name      string
+		paintWear float64
+		expected  float64
+	}{
+		{"AK-47 | Redline (Field-Tested)", 0.15, 0},
+		{"AK-47 | Redline (Field-Tested)", 0.265, 0.5},
+		{"AK-47 | Redline (Field-Tested)", 0.38, 1},
+		{"★ Karambit | Doppler (Factory New)", 0.035, 0.5},
+		// unknown exterior or float
+		{"Sticker | Crown (Foil)", 0.1, 0.5},
+		{"AK-47 | Redline (Field-Tested)", 0, 0.5},
+	}
+
+	for _, tc := range testCases {
+		if actual := GetWearPosition(tc.name, tc.paintWear); math.Abs(actual-tc.expected) > 1e-9 {
+			t.Errorf("GetWearPosition(%s, %v): expected %v, got %v", tc.name, tc.paintWear, tc.expected, actual)
+		}
+	}
+}
+
+func TestExpectedValue(t *testing.T) {
+	config := &ScoreConfig{WearPremium: 0.1, StickerValueRate: 0.1}
+	listing := &model.Listing{
+		Name:      "AK-47 | Case Hardened (Field-Tested)",
+		PaintWear: shared.GetDecimal128("0.15"),
+		Stickers: []model.Sticker{
+			{Name: "Sticker | Crown (Foil)", Slot: 0},
+			{Name: "Sticker | Crown (Foil)", Slot: 1, Wear: 0.5},
+			{Name: "Sticker | Unknown", Slot: 2},
+		},
+	}
+	inputs := &ScoreInputs{
+		BasePrice:     100,
+		TierPremium:   1,
+		StickerPrices: map[string]float64{"Sticker | Crown (Foil)": 1000},
+	}
+
+	// 100 * (1 + 1) * (1 + 0.1 * 0.5) + 1000 * 0.1 + 1000 * 0.1 * 0.5
+	expected := 210.0 + 100 + 50
+	if actual := ExpectedValue(listing, inputs, config); math.Abs(actual-expected) > 1e-9 {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+
+	if actual := ExpectedValue(listing, &ScoreInputs{}, config); actual != 0 {
+		t.Errorf("Expected 0 without base price, got %v", actual)
+	}
+}
+
+func TestGetDiscount(t *testing.T) {
+	if actual := GetDiscount(80, 100); math.Abs(actual-0.2) > 1e-9 {
+		t.Errorf("Expected 0.2, got %v", actual)
+	}
+	if actual := GetDiscount(120, 100); math.Abs(actual+0.2) > 1e-9 {
+		t.Errorf("Expected -0.2, got %v", actual)
+	}
+	if actual := GetDiscount(100, 0); actual != 0 {
+		t.Errorf("Expected 0 without fair value, got %v", actual)
+	}
+}
@@ -14,6 +14,7 @@ import (
 const (
 	STAT_TRAK_LABEL    = "StatTrak™ "
 	STAR_LEBEL         = "★ "
+	SOUVENIR_LABEL     = "Souvenir "
 	BUFF_IDS_PATH      = "shared/data/buff/buffids.json"
 	IGXE_IDS_PATH      = "shared/data/igxe/igxeids.json"
 	RARE_PATTERNS_PATH = "shared/data/items/rare_patterns.json"
@@ -26,6 +27,16 @@ const (
 	MARKET_NAME_IGXE  = "igxe"
 )
 
+const (
+	CURRENCY_CNY = "CNY"
+	CURRENCY_USD = "USD"
+)
+
+const (
+	LOCALE_EN    = "en"
+	LOCALE_ZH_CN = "zh-CN"
+)
+
 const (
 	BUFF_ITEM_PREVIEW_BASE_URL = "https://buff.163.com/goods"
 	BUFF_CS_APPID              = "730"
@@ -35,6 +46,27 @@ const (
 	SECRET_TELEGRAM_TOKEN = "telegramToken"
 )
 
+const (
+	NOTI_TYPE_TELEGRAM = "telegram"
+)
+
+const (
+	USER_ROLE_USER  = "user"
+	USER_ROLE_ADMIN = "admin"
+)
+
+const (
+	TOKEN_TYPE_SESSION = "session"
+	TOKEN_TYPE_API     = "api"
+)
+
+const (
+	TOKEN_SCOPE_READ_LISTINGS        = "listings:read"
+	TOKEN_SCOPE_MANAGE_SUBSCRIPTIONS = "subscriptions:manage"
+	// admin scope implies all other scopes
+	TOKEN_SCOPE_ADMIN = "admin"
+)
+
 const (
 	MAX_NUM_STR = "99999999"
 )
@@ -44,12 +76,176 @@ var MAX_DECIMAL128, _ = primitive.ParseDecimal128(MAX_NUM_STR)
 // configs
 const (
 	FRESH_PRICE_DURATION = 60 * time.Minute
+	SESSION_DURATION     = 7 * 24 * time.Hour
+	LINK_CODE_DURATION   = 10 * time.Minute
+	LINK_CODE_LENGTH     = 8
+)
+
+const (
+	ITEM_TYPE_WEAPON    = "weapon"
+	ITEM_TYPE_KNIFE     = "knife"
+	ITEM_TYPE_GLOVES    = "gloves"
+	ITEM_TYPE_STICKER   = "sticker"
+	ITEM_TYPE_PATCH     = "patch"
+	ITEM_TYPE_GRAFFITI  = "graffiti"
+	ITEM_TYPE_MUSIC_KIT = "musicKit"
+	ITEM_TYPE_CONTAINER = "container"
+	ITEM_TYPE_AGENT     = "agent"
+	ITEM_TYPE_OTHER     = "other"
+)
+
+const (
+	PHASE_1           = "Phase 1"
+	PHASE_2           = "Phase 2"
+	PHASE_3           = "Phase 3"
+	PHASE_4           = "Phase 4"
+	PHASE_RUBY        = "Ruby"
+	PHASE_SAPPHIRE    = "Sapphire"
+	PHASE_BLACK_PEARL = "Black Pearl"
+	PHASE_EMERALD     = "Emerald"
 )
 
+var DOPPLER_PHASES = []string{PHASE_1, PHASE_2, PHASE_3, PHASE_4, PHASE_RUBY, PHASE_SAPPHIRE, PHASE_BLACK_PEARL, PHASE_EMERALD}
+
+// paint index -> phase of Doppler & Gamma Doppler finishes
+var DOPPLER_PHASE_PAINT_INDEXES = map[int]string{
+	// Doppler
+	415: PHASE_RUBY,
+	416: PHASE_SAPPHIRE,
+	417: PHASE_BLACK_PEARL,
+	418: PHASE_1,
+	419: PHASE_2,
+	420: PHASE_3,
+	421: PHASE_4,
+	617: PHASE_BLACK_PEARL,
+	618: PHASE_2,
+	619: PHASE_SAPPHIRE,
+	852: PHASE_1,
+	853: PHASE_2,
+	854: PHASE_3,
+	855: PHASE_4,
+	// Gamma Doppler
+	568: PHASE_EMERALD,
+	569: PHASE_1,
+	570: PHASE_2,
+	571: PHASE_3,
+	572: PHASE_4,
+	// Glock-18 Gamma Doppler
+	1119: PHASE_EMERALD,
+	1120: PHASE_1,
+	1121: PHASE_2,
+	1122: PHASE_3,
+	1123: PHASE_4,
+}
+
+var WEAPON_NAMES = []string{
+	"AK-47", "AUG", "AWP", "CZ75-Auto", "Desert Eagle", "Dual Berettas", "FAMAS", "Five-SeveN",
+	"G3SG1", "Galil AR", "Glock-18", "M249", "M4A1-S", "M4A4", "MAC-10", "MAG-7", "MP5-SD", "MP7",
+	"MP9", "Negev", "Nova", "P2000", "P250", "P90", "PP-Bizon", "R8 Revolver", "SCAR-20", "SG 553",
+	"SSG 08", "Sawed-Off", "Tec-9", "UMP-45", "USP-S", "XM1014", "Zeus x27",
+}
+
+var GLOVE_NAMES = []string{
+	"Bloodhound Gloves", "Broken Fang Gloves", "Driver Gloves", "Hand Wraps",
+	"Hydra Gloves", "Moto Gloves", "Specialist Gloves", "Sport Gloves",
+}
+
+// the part before " | " of non-weapon items
+var ITEM_NAME_PREFIX_TYPES = map[string]string{
+	"Sticker":         ITEM_TYPE_STICKER,
+	"Patch":           ITEM_TYPE_PATCH,
+	"Sealed Graffiti": ITEM_TYPE_GRAFFITI,
+	"Graffiti":        ITEM_TYPE_GRAFFITI,
+	"Music Kit":       ITEM_TYPE_MUSIC_KIT,
+}
+
+var CONTAINER_NAME_SUFFIXES = []string{" Case", " Capsule", " Package"}
+
 var WEAR_LEVELS = []string{"Factory New", "Minimal Wear", "Field-Tested", "Well-Worn", "Battle-Scarred"}
 
+// wear level -> [min, max) paint wear
+var WEAR_RANGES = map[string][2]float64{
+	"Factory New":    {0, 0.07},
+	"Minimal Wear":   {0.07, 0.15},
+	"Field-Tested":   {0.15, 0.38},
+	"Well-Worn":      {0.38, 0.45},
+	"Battle-Scarred": {0.45, 1},
+}
+
 var ITEM_MARKET_NAMES = []string{MARKET_NAME_BUFF, MARKET_NAME_STEAM, MARKET_NAME_UU, MARKET_NAME_IGXE}
 
+// default currency of the prices on each market
+var MARKET_CURRENCIES = map[string]string{
+	MARKET_NAME_BUFF:  CURRENCY_CNY,
+	MARKET_NAME_UU:    CURRENCY_CNY,
+	MARKET_NAME_IGXE:  CURRENCY_CNY,
+	MARKET_NAME_STEAM: CURRENCY_USD,
+}
+
+// status of the listings removed from the market, active listings have no status
+const (
+	LISTING_STATUS_SOLD     = "sold"
+	LISTING_STATUS_DELISTED = "delisted"
+)
+
+// listing events found by the upserts
+const (
+	LISTING_EVENT_NEW            = "new"
+	LISTING_EVENT_PRICE_DROP     = "priceDrop"
+	LISTING_EVENT_PRICE_INCREASE = "priceIncrease"
+	// the asset was listed on another market before
+	LISTING_EVENT_RELISTED = "relisted"
+)
+
+// item alert types, prices are compared in NORMALIZED_CURRENCY
+const (
+	// best price across markets crosses below the threshold
+	ITEM_ALERT_TYPE_PRICE_BELOW = "priceBelow"
+	// best price across markets crosses above the threshold
+	ITEM_ALERT_TYPE_PRICE_ABOVE = "priceAbove"
+	// best price moves by the change percentage in 24h
+	ITEM_ALERT_TYPE_PRICE_MOVE = "priceMove"
+	// the market becomes the cheapest
+	ITEM_ALERT_TYPE_CHEAPEST_MARKET = "cheapestMarket"
+)
+
+// what the cleanup does to the stale listings
+const (
+	STALE_ACTION_ARCHIVE = "archive"
+	STALE_ACTION_DELETE  = "delete"
+)
+
+// anomaly types
+const (
+	ANOMALY_TYPE_PRICE_SPIKE  = "priceSpike"
+	ANOMALY_TYPE_PRICE_DROP   = "priceDrop"
+	ANOMALY_TYPE_VOLUME_SPIKE = "volumeSpike"
+	ANOMALY_TYPE_WASH_TRADE   = "washTrade"
+)
+
+// Cross-market prices are compared in this currency
+const NORMALIZED_CURRENCY = CURRENCY_CNY
+
+// Fallback rates against USD, override with SetRateProvider for live rates
+var DEFAULT_EXCHANGE_RATES = map[string]float64{
+	CURRENCY_CNY: 7.2,
+}
+
+var CURRENCY_SYMBOLS = map[string]string{
+	CURRENCY_CNY: "¥",
+	CURRENCY_USD: "$",
+}
+
+var LOCALES = []string{LOCALE_EN, LOCALE_ZH_CN}
+
+var USER_ROLES = []string{USER_ROLE_USER, USER_ROLE_ADMIN}
+
+var ITEM_ALERT_TYPES = []string{ITEM_ALERT_TYPE_PRICE_BELOW, ITEM_ALERT_TYPE_PRICE_ABOVE, ITEM_ALERT_TYPE_PRICE_MOVE, ITEM_ALERT_TYPE_CHEAPEST_MARKET}
+
+var TOKEN_TYPES = []string{TOKEN_TYPE_SESSION, TOKEN_TYPE_API}
+
+var TOKEN_SCOPES = []string{TOKEN_SCOPE_READ_LISTINGS, TOKEN_SCOPE_MANAGE_SUBSCRIPTIONS, TOKEN_SCOPE_ADMIN}
+
 var ITEM_FIXED_VAL_FILTER_KEYS = []string{"name", "category", "skin", "exterior"}
 
 var buffIds = map[string]int{}
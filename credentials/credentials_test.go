@@ -0,0 +1,109 @@
+package credentials_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikezzb/steam-trading-shared/credentials"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	t.Run("HashAndVerify", func(t *testing.T) {
+		hash, err := credentials.HashPassword("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !credentials.IsHashed(hash) {
+			t.Errorf("Expected hashed value, got %s", hash)
+		}
+
+		if err := credentials.VerifyPassword(hash, "secret"); err != nil {
+			t.Errorf("Expected password to match, got %v", err)
+		}
+
+		if err := credentials.VerifyPassword(hash, "wrong"); err != credentials.ErrInvalidCredentials {
+			t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+		}
+
+		if credentials.NeedsRehash(hash) {
+			t.Errorf("Fresh hash shall not need rehash")
+		}
+	})
+
+	t.Run("Rehash", func(t *testing.T) {
+		oldHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+		testPairs := []struct {
+			stored   string
+			expected bool
+		}{
+			{string(oldHash), true},
+			{"secret", true},
+		}
+
+		for _, pair := range testPairs {
+			if actual := credentials.NeedsRehash(pair.stored); actual != pair.expected {
+				t.Errorf("NeedsRehash(%q): expected %v, got %v", pair.stored, pair.expected, actual)
+			}
+		}
+
+		// outdated hash still verifies
+		if err := credentials.VerifyPassword(string(oldHash), "secret"); err != nil {
+			t.Errorf("Expected password to match, got %v", err)
+		}
+	})
+
+	t.Run("LegacyPlainText", func(t *testing.T) {
+		if err := credentials.VerifyPassword("secret", "secret"); err != nil {
+			t.Errorf("Expected legacy password to match, got %v", err)
+		}
+
+		if err := credentials.VerifyPassword("", ""); err != credentials.ErrInvalidCredentials {
+			t.Errorf("Empty stored password shall never match")
+		}
+	})
+}
+
+func TestToken(t *testing.T) {
+	t.Run("GenerateAndHash", func(t *testing.T) {
+		token, err := credentials.GenerateToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other, _ := credentials.GenerateToken()
+		if token == other {
+			t.Errorf("Tokens shall be unique")
+		}
+
+		hash := credentials.HashToken(token)
+		if hash == token || len(hash) != 64 {
+			t.Errorf("Unexpected token hash: %s", hash)
+		}
+
+		if credentials.HashToken(token) != hash {
+			t.Errorf("Token hash shall be deterministic")
+		}
+	})
+}
+
+func TestCode(t *testing.T) {
+	t.Run("GenerateCode", func(t *testing.T) {
+		code, err := credentials.GenerateCode(8)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != 8 {
+			t.Errorf("Expected code length 8, got %d", len(code))
+		}
+
+		for _, c := range code {
+			if !strings.ContainsRune(credentials.CODE_ALPHABET, c) {
+				t.Errorf("Unexpected character %q in code %s", c, code)
+			}
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package credentials
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt encodes the version and cost in the hash, e.g. $2a$12$...
+// bump HASH_COST to upgrade, old hashes are rehashed on next login
+const HASH_COST = 12
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), HASH_COST)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsHashed reports whether the stored value is a password hash
+func IsHashed(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// VerifyPassword compares the stored value with the password.
+// Stored values that are not hashes (legacy plain text) are compared in constant time.
+// @return ErrInvalidCredentials if not match
+func VerifyPassword(stored, password string) error {
+	if !IsHashed(stored) {
+		if stored == "" || subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// NeedsRehash reports whether the stored value shall be replaced by a new hash,
+// i.e. it is plain text or hashed with outdated parameters
+func NeedsRehash(stored string) bool {
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		return true
+	}
+	return cost != HASH_COST
+}
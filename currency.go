@@ -0,0 +1,138 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Provides the exchange rate between currencies
+type ExchangeRateProvider interface {
+	// GetRate returns the amount of `to` currency per 1 unit of `from` currency
+	GetRate(from, to string) (float64, error)
+}
+
+// Exchange rates against a base currency, for offline use
+type StaticRateProvider struct {
+	Base string `json:"base"`
+	// currency -> amount of the currency per 1 unit of the base currency
+	Rates map[string]float64 `json:"rates"`
+}
+
+func NewStaticRateProvider(base string, rates map[string]float64) *StaticRateProvider {
+	return &StaticRateProvider{
+		Base:  base,
+		Rates: rates,
+	}
+}
+
+// LoadRateProvider loads the static rates from a json file, e.g. {"base": "USD", "rates": {"CNY": 7.2}}
+func LoadRateProvider(path string) (*StaticRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &StaticRateProvider{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if p.Base == "" {
+		return nil, fmt.Errorf("LoadRateProvider: missing base currency in %s", path)
+	}
+	return p, nil
+}
+
+func (p *StaticRateProvider) getBaseRate(currency string) (float64, error) {
+	if currency == p.Base {
+		return 1, nil
+	}
+	rate, ok := p.Rates[currency]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("exchange rate of %s not found", currency)
+	}
+	return rate, nil
+}
+
+func (p *StaticRateProvider) GetRate(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	fromRate, err := p.getBaseRate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := p.getBaseRate(to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+var (
+	rateProvider   ExchangeRateProvider = NewStaticRateProvider(CURRENCY_USD, DEFAULT_EXCHANGE_RATES)
+	rateProviderMu sync.RWMutex
+)
+
+// Set the provider used by the cross-market price comparisons
+func SetRateProvider(p ExchangeRateProvider) {
+	rateProviderMu.Lock()
+	defer rateProviderMu.Unlock()
+	rateProvider = p
+}
+
+func GetRateProvider() ExchangeRateProvider {
+	rateProviderMu.RLock()
+	defer rateProviderMu.RUnlock()
+	return rateProvider
+}
+
+// Convert the amount between currencies with the current rate provider
+func ConvertAmount(amount float64, from, to string) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	rate, err := GetRateProvider().GetRate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
+
+// Convert the price to NORMALIZED_CURRENCY
+func NormalizePrice(price primitive.Decimal128, currency string) (float64, error) {
+	return ConvertAmount(DecToFloat(price), currency, NORMALIZED_CURRENCY)
+}
+
+// Currency of the market price, prices without currency are in the default currency of the market
+func GetMarketPriceCurrency(price *model.MarketPrice, marketName string) string {
+	if price.Currency != "" {
+		return price.Currency
+	}
+	return GetMarketCurrency(marketName)
+}
+
+// Currency of the listing, listings without currency are in the default currency of the market
+func GetListingCurrency(listing *model.Listing) string {
+	if listing.Currency != "" {
+		return listing.Currency
+	}
+	return GetMarketCurrency(listing.Market)
+}
+
+// Currency of one of the market prices of the item, e.g. the result of GetBestPrice
+func GetItemPriceCurrency(item *model.Item, price *model.MarketPrice) string {
+	for _, marketName := range ITEM_MARKET_NAMES {
+		if GetMarketPrice(item, marketName) == price {
+			return GetMarketPriceCurrency(price, marketName)
+		}
+	}
+	if price.Currency != "" {
+		return price.Currency
+	}
+	return NORMALIZED_CURRENCY
+}
@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestStaticRateProvider(t *testing.T) {
+	p := NewStaticRateProvider(CURRENCY_USD, map[string]float64{
+		CURRENCY_CNY: 7,
+		"EUR":        0.5,
+	})
+
+	testCases := []struct {
+		from, to string
+		expected float64
+	}{
+		{CURRENCY_USD, CURRENCY_USD, 1},
+		{CURRENCY_USD, CURRENCY_CNY, 7},
+		{CURRENCY_CNY, CURRENCY_USD, 1.0 / 7},
+		{"EUR", CURRENCY_CNY, 14},
+	}
+
+	for _, tc := range testCases {
+		actual, err := p.GetRate(tc.from, tc.to)
+		if err != nil || math.Abs(actual-tc.expected) > 1e-9 {
+			t.Errorf("GetRate(%s, %s): expected %v, got %v, %v", tc.from, tc.to, tc.expected, actual, err)
+		}
+	}
+
+	if _, err := p.GetRate("JPY", CURRENCY_USD); err == nil {
+		t.Errorf("Expected error for unknown currency")
+	}
+}
+
+func TestLoadRateProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"base": "CNY", "rates": {"USD": 0.125}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadRateProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rate, err := p.GetRate(CURRENCY_USD, CURRENCY_CNY)
+	if err != nil || rate != 8 {
+		t.Errorf("Expected 8, got %v, %v", rate, err)
+	}
+}
+
+func TestGetBestPrice_Normalized(t *testing.T) {
+	defer SetRateProvider(GetRateProvider())
+	SetRateProvider(NewStaticRateProvider(CURRENCY_USD, map[string]float64{CURRENCY_CNY: 7}))
+
+	now := time.Now()
+	item := &model.Item{
+		// ¥100
+		BuffPrice: &model.MarketPrice{Price: GetDecimal128("100"), UpdatedAt: now},
+		// $20 = ¥140, smaller in number but more expensive
+		SteamPrice: &model.MarketPrice{Price: GetDecimal128("20"), UpdatedAt: now},
+	}
+
+	if best := GetBestPrice(item); best != item.BuffPrice {
+		t.Errorf("Expected buff price, got %v", best)
+	}
+	if best := GetFreshBestPrice(item, time.Hour); best != item.BuffPrice {
+		t.Errorf("Expected fresh buff price, got %v", best)
+	}
+
+	// $10 = ¥70
+	item.SteamPrice.Price = GetDecimal128("10")
+	if best := GetBestPrice(item); best != item.SteamPrice {
+		t.Errorf("Expected steam price, got %v", best)
+	}
+
+	// explicit currency overrides the market currency
+	item.SteamPrice.Currency = CURRENCY_CNY
+	item.SteamPrice.Price = GetDecimal128("90")
+	if best := GetBestPrice(item); best != item.SteamPrice {
+		t.Errorf("Expected steam price in CNY, got %v", best)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -26,6 +27,137 @@ func (c *DBClient) Init() error {
 		return err
 	}
 
+	// item price snapshots per market
+	priceTsOpts := options.TimeSeries().SetTimeField("createdAt").SetMetaField("metadata").SetGranularity("hours")
+	if err := c.DB.CreateCollection(context.Background(), "price_history", options.CreateCollection().SetTimeSeriesOptions(priceTsOpts)); err != nil {
+		return err
+	}
+
+	return c.InitIndexes()
+}
+
+// create indexes, safe to call multiple times
+func (c *DBClient) InitIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// tokens: lookup by hash, list by user, remove once expired
+	tokenIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err := c.DB.Collection("tokens").Indexes().CreateMany(ctx, tokenIndexes); err != nil {
+		return err
+	}
+
+	// link codes: one-time lookup by code, remove once expired
+	linkCodeIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err := c.DB.Collection("link_codes").Indexes().CreateMany(ctx, linkCodeIndexes); err != nil {
+		return err
+	}
+
+	// listings: best price lookups per item & phase, deals ranked by discount, staleness per market
+	listingIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "phase", Value: 1}, {Key: "price", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "discount", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "market", Value: 1}, {Key: "checkedAt", Value: 1}},
+		},
+	}
+	if _, err := c.DB.Collection("listings").Indexes().CreateMany(ctx, listingIndexes); err != nil {
+		return err
+	}
+
+	// anomalies: dedupe & recent anomalies of an item
+	anomalyIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "type", Value: 1}, {Key: "detectedAt", Value: -1}},
+		},
+	}
+	if _, err := c.DB.Collection("anomalies").Indexes().CreateMany(ctx, anomalyIndexes); err != nil {
+		return err
+	}
+
+	// item alerts: alerts of an item & of a user
+	itemAlertIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "itemId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}},
+		},
+	}
+	if _, err := c.DB.Collection("item_alerts").Indexes().CreateMany(ctx, itemAlertIndexes); err != nil {
+		return err
+	}
+
+	// portfolios: holdings of a user, one holding per asset, snapshots of a user over time
+	holdingIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "assetId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"assetId": bson.M{"$exists": true},
+			}),
+		},
+	}
+	if _, err := c.DB.Collection("holdings").Indexes().CreateMany(ctx, holdingIndexes); err != nil {
+		return err
+	}
+	snapshotIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	}
+	if _, err := c.DB.Collection("portfolio_snapshots").Indexes().CreateMany(ctx, snapshotIndexes); err != nil {
+		return err
+	}
+
+	// stats: one document per item & market
+	statsIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}, {Key: "market", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "dailySales", Value: -1}},
+		},
+	}
+	if _, err := c.DB.Collection("stats").Indexes().CreateMany(ctx, statsIndexes); err != nil {
+		return err
+	}
+
+	// users: find user by linked channel
+	userIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "linkedChannels.type", Value: 1}, {Key: "linkedChannels.notiId", Value: 1}},
+		},
+	}
+	if _, err := c.DB.Collection("users").Indexes().CreateMany(ctx, userIndexes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -72,6 +204,30 @@ func (c *DBClient) MigrateTransactions(oldCollName, newCollName string) error {
 	return nil
 }
 
+// Convert the favorite item ids stored as ObjectIDs to strings, as item ids are buff ids
+// @return number of users migrated
+func (c *DBClient) MigrateFavItemIds() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"favItemIds": bson.M{"$type": "objectId"}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"favItemIds": bson.M{"$map": bson.M{
+				"input": "$favItemIds",
+				"as":    "id",
+				"in":    bson.M{"$toString": "$$id"},
+			}},
+		}}},
+	}
+
+	result, err := c.DB.Collection("users").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
 func unixToTime(createdAt interface{}) (time.Time, error) {
 	if createdAt32, ok := createdAt.(int32); ok {
 		return time.Unix(int64(createdAt32), 0), nil
@@ -1,11 +1,14 @@
 package database_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	shared "github.com/mikezzb/steam-trading-shared"
 	"github.com/mikezzb/steam-trading-shared/database"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -53,6 +56,37 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
+func TestMigrateFavItemIds(t *testing.T) {
+	dbClient, err := database.NewDBClient(dbUri, dbName, 10*time.Second)
+	defer dbClient.Disconnect()
+	if err != nil {
+		t.Fatalf("Failed to connect to db: %v", err)
+	}
+
+	users := dbClient.DB.Collection("users")
+	legacyId := primitive.NewObjectID()
+	result, err := users.InsertOne(context.Background(), bson.M{
+		"username":   "legacy",
+		"favItemIds": bson.A{legacyId, "33815"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer users.DeleteOne(context.Background(), bson.M{"_id": result.InsertedID})
+
+	if _, err := dbClient.MigrateFavItemIds(); err != nil {
+		t.Fatalf("Failed to migrate fav item ids: %v", err)
+	}
+
+	var user model.User
+	if err := users.FindOne(context.Background(), bson.M{"_id": result.InsertedID}).Decode(&user); err != nil {
+		t.Fatalf("Failed to decode the migrated user: %v", err)
+	}
+	if len(user.FavItemIds) != 2 || user.FavItemIds[0] != legacyId.Hex() || user.FavItemIds[1] != "33815" {
+		t.Errorf("Expected the fav item ids as strings, got %v", user.FavItemIds)
+	}
+}
+
 func TestDecimal128(t *testing.T) {
 	t.Run("Decimal128", func(t *testing.T) {
 		a, _ := primitive.ParseDecimal128("0.434223353413354")
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,6 +10,8 @@ import (
 type MarketPrice struct {
 	Price     primitive.Decimal128 `bson:"price" json:"price"`
 	UpdatedAt time.Time            `bson:"updatedAt" json:"updatedAt"`
+	// Empty for the default currency of the market
+	Currency string `bson:"currency,omitempty" json:"currency,omitempty"`
 }
 
 // TODO: make the market prices omitempty
@@ -41,6 +44,7 @@ type Listing struct {
 	Name             string               `bson:"name" json:"name"`
 	Market           string               `bson:"market" json:"market"`
 	Price            primitive.Decimal128 `bson:"price" json:"price"`
+	Currency         string               `bson:"currency,omitempty" json:"currency,omitempty"`
 	PreviewUrl       string               `bson:"previewUrl" json:"previewUrl"`
 	GoodsId          int                  `bson:"goodsId" json:"goodsId"`
 	ClassId          string               `bson:"classId" json:"classId"`
@@ -51,9 +55,51 @@ type Listing struct {
 	PaintIndex int                  `bson:"paintIndex" json:"paintIndex"`
 	PaintSeed  int                  `bson:"paintSeed" json:"paintSeed"`
 	Rarity     string               `bson:"rarity" json:"rarity"`
+	// Doppler phase resolved from the paint index, e.g. Phase 2, Ruby
+	Phase string `bson:"phase,omitempty" json:"phase,omitempty"`
 
 	// Market specific ID
 	InstanceId string `bson:"instanceId" json:"instanceId"`
+
+	// Optional, applied stickers
+	Stickers []Sticker `bson:"stickers,omitempty" json:"stickers,omitempty"`
+
+	// Expected value in the normalized currency, set by the scoring service
+	FairValue float64 `bson:"fairValue,omitempty" json:"fairValue,omitempty"`
+	// Discount to the fair value, e.g. 0.2 for 20% below
+	Discount float64 `bson:"discount,omitempty" json:"discount,omitempty"`
+
+	// Set once the listing is not seen on the market anymore, one of LISTING_STATUS_*
+	Status    string     `bson:"status,omitempty" json:"status,omitempty"`
+	RemovedAt *time.Time `bson:"removedAt,omitempty" json:"removedAt,omitempty"`
+	// Seconds from the creation to the removal
+	TimeOnMarket int64 `bson:"timeOnMarket,omitempty" json:"timeOnMarket,omitempty"`
+	// Optional, the transaction of the sold listing
+	TransactionId primitive.ObjectID `bson:"transactionId,omitempty" json:"transactionId,omitempty"`
+}
+
+// Change of a listing found by an upsert
+type ListingEvent struct {
+	// one of LISTING_EVENT_*
+	Type    string
+	Listing *Listing
+	// Optional, the listing before a price change, or the listing of the asset on the previous market if relisted
+	Previous *Listing
+}
+
+// Item added to or removed from the favorites of a user
+type FavItemChange struct {
+	UserId primitive.ObjectID
+	ItemId string
+}
+
+// Sticker applied on a listing
+type Sticker struct {
+	// Market hash name, e.g. Sticker | Crown (Foil)
+	Name string `bson:"name" json:"name"`
+	Slot int    `bson:"slot" json:"slot"`
+	// Scraped percentage, 0 for intact
+	Wear float64 `bson:"wear,omitempty" json:"wear,omitempty"`
 }
 
 // Subscription on the rare patterns of an item
@@ -65,13 +111,28 @@ type Subscription struct {
 	// Optional, if not provided, it means subscribe to all rarity
 	Rarities   []string `bson:"rarities,omitempty" json:"rarities"`
 	PaintSeeds []int    `bson:"paintSeeds,omitempty" json:"paintSeeds"`
+	// Optional, Doppler phases, e.g. Ruby, Phase 2
+	Phases []string `bson:"phases,omitempty" json:"phases"`
 	// Optional, can be percentage or absolute value
 	MaxPremium string `bson:"maxPremium,omitempty" json:"maxPremium"`
+	// Optional, only notify price drops of at least this percentage, e.g. 10 for 10%
+	MinPriceDrop float64 `bson:"minPriceDrop,omitempty" json:"minPriceDrop"`
 
 	// Alarm settings. Example: Telegram, Email
 	NotiType string `bson:"notiType" json:"notiType"`
 	// Example: Telegram chat id, or email address
 	NotiId string `bson:"notiId" json:"notiId"`
+	// Optional, a linked channel of the owner, takes precedence over NotiType & NotiId
+	ChannelId primitive.ObjectID `bson:"channelId,omitempty" json:"channelId"`
+
+	// Paused subscriptions are kept but not notified.
+	// Stored as disabled so that existing documents stay enabled.
+	Disabled bool `bson:"disabled,omitempty" json:"disabled"`
+	// Optional, the subscription is removed once expired
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty" json:"expiresAt"`
+	// Optional, the subscription is removed after this number of notifications, 0 means unlimited
+	MaxNotifications  int `bson:"maxNotifications,omitempty" json:"maxNotifications"`
+	NotificationCount int `bson:"notificationCount,omitempty" json:"notificationCount"`
 
 	OwnerId primitive.ObjectID `bson:"ownerId" json:"ownerId"`
 }
@@ -80,20 +141,97 @@ type User struct {
 	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
 
 	Username string `bson:"username" json:"username"`
-	Password string `bson:"password" json:"password"`
+	// Password hash, accepted from JSON but never serialized to JSON
+	Password string `bson:"password" json:"password,omitempty"`
 
 	Email string `bson:"email" json:"email"`
 
 	Role string `bson:"role" json:"role"`
+	// Optional, locale of the notifications, e.g. en, zh-CN
+	Locale string `bson:"locale,omitempty" json:"locale"`
 
 	SubscriptionIds []primitive.ObjectID `bson:"subscriptionIds" json:"subscriptionIds"`
-	FavItemIds      []primitive.ObjectID `bson:"favItemIds" json:"favItemIds"`
-	FavListingIds   []primitive.ObjectID `bson:"favListingIds" json:"favListingIds"`
+	// Item ids are buff ids (string), same as Item.ID
+	FavItemIds    []string             `bson:"favItemIds" json:"favItemIds"`
+	FavListingIds []primitive.ObjectID `bson:"favListingIds" json:"favListingIds"`
+
+	// Verified notification channels
+	LinkedChannels []LinkedChannel `bson:"linkedChannels,omitempty" json:"linkedChannels"`
+}
+
+// Notification channel verified by the user, e.g. a Telegram chat
+type LinkedChannel struct {
+	ID primitive.ObjectID `bson:"_id" json:"_id"`
+
+	// Example: Telegram
+	Type string `bson:"type" json:"type"`
+	// Example: Telegram chat id
+	NotiId string `bson:"notiId" json:"notiId"`
+	// Example: Telegram username
+	Name string `bson:"name,omitempty" json:"name"`
+
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// One-time code to link a channel to a user
+type LinkCode struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+
+	Code        string             `bson:"code" json:"code"`
+	UserId      primitive.ObjectID `bson:"userId" json:"userId"`
+	ChannelType string             `bson:"channelType" json:"channelType"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// MarshalJSON omits the password hash
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	safeUser := user(u)
+	safeUser.Password = ""
+	return json.Marshal(safeUser)
+}
+
+// Session or API token of a user
+type Token struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+
+	UserId primitive.ObjectID `bson:"userId" json:"userId"`
+	// session or api
+	Type string `bson:"type" json:"type"`
+	Name string `bson:"name,omitempty" json:"name"`
+	// sha256 of the token, the raw token is only known on issue
+	Hash   string   `bson:"hash" json:"-"`
+	Scopes []string `bson:"scopes" json:"scopes"`
+
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+	LastUsedAt time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt"`
+	// Optional, removed by the TTL index once passed
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty" json:"expiresAt"`
 }
 
 type TransactionMetadata struct {
 	Market  string `bson:"market" json:"market"`
 	AssetId string `bson:"assetId" json:"assetId"`
+	// Inferred from a listing that disappeared, not scraped from the market
+	Synthetic bool `bson:"synthetic,omitempty" json:"synthetic,omitempty"`
+}
+
+type PriceSnapshotMetadata struct {
+	Name   string `bson:"name" json:"name"`
+	Market string `bson:"market" json:"market"`
+}
+
+// Asking price of an item on a market at a time, stored in a time-series collection
+type PriceSnapshot struct {
+	ID       primitive.ObjectID    `bson:"_id,omitempty" json:"_id"`
+	Metadata PriceSnapshotMetadata `bson:"metadata" json:"metadata"`
+
+	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+	Price     primitive.Decimal128 `bson:"price" json:"price"`
+	// Empty for the default currency of the market
+	Currency string `bson:"currency,omitempty" json:"currency,omitempty"`
 }
 
 // Currently same as Listing
@@ -116,7 +254,146 @@ type Transaction struct {
 	PaintSeed  int                  `bson:"paintSeed" json:"paintSeed"`
 
 	Rarity string `bson:"rarity" json:"rarity"`
+	// Doppler phase resolved from the paint index, e.g. Phase 2, Ruby
+	Phase string `bson:"phase,omitempty" json:"phase,omitempty"`
 
 	// market specific unique id
 	InstanceId string `bson:"instanceId" json:"instanceId"`
 }
+
+// Suspicious price or trading activity of an item
+type Anomaly struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+
+	Name string `bson:"name" json:"name"`
+	// Empty if across markets
+	Market string `bson:"market,omitempty" json:"market,omitempty"`
+	// One of ANOMALY_TYPE_*
+	Type string `bson:"type" json:"type"`
+	// Robust z-score of the value, or the number of cycles of wash trades
+	Score float64 `bson:"score" json:"score"`
+	// The flagged value & the expected value, e.g. price & median price, sales & median daily sales
+	Value    float64 `bson:"value" json:"value"`
+	Baseline float64 `bson:"baseline" json:"baseline"`
+	// Optional, asset cycled in wash trades
+	AssetId string `bson:"assetId,omitempty" json:"assetId,omitempty"`
+
+	DetectedAt time.Time `bson:"detectedAt" json:"detectedAt"`
+}
+
+// Alert on the prices of an item, unlike subscriptions on its listings
+type ItemAlert struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+
+	// Item ids are buff ids (string), same as Item.ID
+	ItemId string `bson:"itemId" json:"itemId"`
+	Name   string `bson:"name" json:"name"`
+	// One of ITEM_ALERT_TYPE_*
+	Type string `bson:"type" json:"type"`
+	// Price threshold in the normalized currency, for the price below & above alerts
+	Threshold float64 `bson:"threshold,omitempty" json:"threshold,omitempty"`
+	// Percentage of the price move alerts, e.g. 10 for 10% either way
+	ChangePerc float64 `bson:"changePerc,omitempty" json:"changePerc,omitempty"`
+	// Market of the cheapest market alerts
+	Market string `bson:"market,omitempty" json:"market,omitempty"`
+
+	NotiType string `bson:"notiType" json:"notiType"`
+	NotiId   string `bson:"notiId" json:"notiId"`
+	// Optional, a linked channel of the owner, takes precedence over NotiType & NotiId
+	ChannelId primitive.ObjectID `bson:"channelId,omitempty" json:"channelId"`
+	OwnerId   primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+	Disabled  bool               `bson:"disabled,omitempty" json:"disabled"`
+
+	// State of the last check, alerts trigger when the state crosses the condition
+	LastPrice       float64    `bson:"lastPrice,omitempty" json:"lastPrice,omitempty"`
+	LastMarket      string     `bson:"lastMarket,omitempty" json:"lastMarket,omitempty"`
+	LastTriggeredAt *time.Time `bson:"lastTriggeredAt,omitempty" json:"lastTriggeredAt,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// An asset owned by a user, valued against the current market prices
+type Holding struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	OwnerId primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+
+	// Optional, steam asset id
+	AssetId string `bson:"assetId,omitempty" json:"assetId,omitempty"`
+	// Market hash name
+	Name string `bson:"name" json:"name"`
+	// Optional, buff id, same as Item.ID
+	ItemId string `bson:"itemId,omitempty" json:"itemId,omitempty"`
+
+	PaintWear primitive.Decimal128 `bson:"paintWear" json:"paintWear"`
+	PaintSeed int                  `bson:"paintSeed,omitempty" json:"paintSeed,omitempty"`
+	Rarity    string               `bson:"rarity,omitempty" json:"rarity,omitempty"`
+	Phase     string               `bson:"phase,omitempty" json:"phase,omitempty"`
+	// Units of a stackable asset e.g. cases, 0 for 1
+	Amount      int    `bson:"amount,omitempty" json:"amount,omitempty"`
+	Tradable    bool   `bson:"tradable" json:"tradable"`
+	InspectLink string `bson:"inspectLink,omitempty" json:"inspectLink,omitempty"`
+
+	// Price paid per unit, including the buyer fees
+	PurchasePrice primitive.Decimal128 `bson:"purchasePrice" json:"purchasePrice"`
+	// Empty for the default currency of the purchase market
+	PurchaseCurrency string    `bson:"purchaseCurrency,omitempty" json:"purchaseCurrency,omitempty"`
+	PurchaseMarket   string    `bson:"purchaseMarket,omitempty" json:"purchaseMarket,omitempty"`
+	PurchasedAt      time.Time `bson:"purchasedAt" json:"purchasedAt"`
+
+	// Set once sold, the price per unit before the seller fees of the sale market
+	SalePrice    *primitive.Decimal128 `bson:"salePrice,omitempty" json:"salePrice,omitempty"`
+	SaleCurrency string                `bson:"saleCurrency,omitempty" json:"saleCurrency,omitempty"`
+	SaleMarket   string                `bson:"saleMarket,omitempty" json:"saleMarket,omitempty"`
+	SoldAt       *time.Time            `bson:"soldAt,omitempty" json:"soldAt,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// Valuation of the holdings of a user at a time, amounts in the normalized currency
+type PortfolioSnapshot struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	OwnerId primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+
+	// Cost & market value of the held assets
+	Cost  float64 `bson:"cost" json:"cost"`
+	Value float64 `bson:"value" json:"value"`
+	// Value after the seller fees
+	NetValue      float64 `bson:"netValue" json:"netValue"`
+	RealizedPnL   float64 `bson:"realizedPnl" json:"realizedPnl"`
+	UnrealizedPnL float64 `bson:"unrealizedPnl" json:"unrealizedPnl"`
+	// Number of held assets, and those without a fresh price
+	Holdings int `bson:"holdings" json:"holdings"`
+	Unpriced int `bson:"unpriced" json:"unpriced"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// Liquidity statistics of an item on a market, refreshed incrementally
+type ItemStats struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+
+	Name   string `bson:"name" json:"name"`
+	Market string `bson:"market" json:"market"`
+
+	// day (2006-01-02) -> sales of the day, days out of the window are pruned
+	DailyCounts map[string]int64 `bson:"dailyCounts" json:"dailyCounts"`
+	// average sales per day in the window
+	DailySales float64 `bson:"dailySales" json:"dailySales"`
+
+	// sales matched with a listing by asset id
+	MatchedSales int64 `bson:"matchedSales" json:"matchedSales"`
+	// average seconds from the listing creation to the sale
+	AvgTimeToSell float64 `bson:"avgTimeToSell" json:"avgTimeToSell"`
+
+	// latest sale prices in the normalized currency, newest last
+	RecentPrices []float64 `bson:"recentPrices" json:"recentPrices"`
+	// lowest listing price & median recent sale price in the normalized currency
+	LowestAsk  float64 `bson:"lowestAsk" json:"lowestAsk"`
+	MedianSale float64 `bson:"medianSale" json:"medianSale"`
+	// (lowest ask - median sale) / lowest ask
+	Spread float64 `bson:"spread" json:"spread"`
+
+	// transactions up to this time are counted
+	LastTransactionAt time.Time `bson:"lastTransactionAt" json:"lastTransactionAt"`
+	UpdatedAt         time.Time `bson:"updatedAt" json:"updatedAt"`
+}
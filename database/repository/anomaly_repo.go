@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AnomalyRepository struct {
+	AnomalyCol           *mongo.Collection
+	ChangeStreamCallback ChangeStreamCallback
+}
+
+// Insert the anomaly, the callback broadcasts it
+func (r *AnomalyRepository) InsertAnomaly(anomaly *model.Anomaly) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if anomaly.DetectedAt.IsZero() {
+		anomaly.DetectedAt = time.Now()
+	}
+
+	result, err := r.AnomalyCol.InsertOne(ctx, anomaly)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	anomaly.ID = result.InsertedID.(primitive.ObjectID)
+
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(anomaly, "insert")
+	}
+	return anomaly.ID, nil
+}
+
+// Check if an anomaly of the same item, market, type & asset was detected since
+func (r *AnomalyRepository) ExistsSince(anomaly *model.Anomaly, since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	filter := bson.M{
+		"name":       anomaly.Name,
+		"type":       anomaly.Type,
+		"detectedAt": bson.M{"$gte": since},
+	}
+	if anomaly.Market != "" {
+		filter["market"] = anomaly.Market
+	}
+	if anomaly.AssetId != "" {
+		filter["assetId"] = anomaly.AssetId
+	}
+
+	count, err := r.AnomalyCol.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// GetAnomaliesByPage returns the latest anomalies first
+func (r *AnomalyRepository) GetAnomaliesByPage(page, pageSize int, filters bson.M) ([]model.Anomaly, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := GetPageOpts(page, pageSize)
+	opts.SetSort(bson.M{"detectedAt": -1})
+
+	cursor, err := r.AnomalyCol.Find(ctx, filters, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var anomalies []model.Anomaly
+	err = cursor.All(ctx, &anomalies)
+	return anomalies, err
+}
+
+func (r *AnomalyRepository) GetAnomaliesByItemName(name string, since time.Time) ([]model.Anomaly, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"detectedAt": -1})
+	cursor, err := r.AnomalyCol.Find(ctx, bson.M{
+		"name":       name,
+		"detectedAt": bson.M{"$gte": since},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var anomalies []model.Anomaly
+	err = cursor.All(ctx, &anomalies)
+	return anomalies, err
+}
+
+func (r *AnomalyRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.AnomalyCol.DeleteMany(ctx, bson.M{})
+	return err
+}
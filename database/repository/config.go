@@ -4,4 +4,6 @@ import "time"
 
 const (
 	TIMEOUT_DURATION = 3 * time.Second
+	// listings per bulk write, each chunk has its own timeout
+	LISTING_CHUNK_SIZE = 500
 )
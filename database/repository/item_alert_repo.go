@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ItemAlertRepository struct {
+	ItemAlertCol         *mongo.Collection
+	ChangeStreamCallback ChangeStreamCallback
+}
+
+var ErrInvalidItemAlert = fmt.Errorf("invalid item alert")
+
+// checks the condition of the alert type is set
+func validateItemAlert(alert *model.ItemAlert) error {
+	switch alert.Type {
+	case shared.ITEM_ALERT_TYPE_PRICE_BELOW, shared.ITEM_ALERT_TYPE_PRICE_ABOVE:
+		if alert.Threshold <= 0 {
+			return fmt.Errorf("%w: threshold must be positive", ErrInvalidItemAlert)
+		}
+	case shared.ITEM_ALERT_TYPE_PRICE_MOVE:
+		if alert.ChangePerc <= 0 {
+			return fmt.Errorf("%w: change percentage must be positive", ErrInvalidItemAlert)
+		}
+	case shared.ITEM_ALERT_TYPE_CHEAPEST_MARKET:
+		if !slices.Contains(shared.ITEM_MARKET_NAMES, alert.Market) {
+			return fmt.Errorf("%w: unknown market %q", ErrInvalidItemAlert, alert.Market)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q, types: %v", ErrInvalidItemAlert, alert.Type, shared.ITEM_ALERT_TYPES)
+	}
+	return nil
+}
+
+// @return alert id, ErrInvalidItemAlert if the condition of the type is not set
+func (r *ItemAlertRepository) InsertItemAlert(alert *model.ItemAlert) (primitive.ObjectID, error) {
+	if err := validateItemAlert(alert); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+
+	result, err := r.ItemAlertCol.InsertOne(ctx, alert)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	alert.ID = result.InsertedID.(primitive.ObjectID)
+
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(alert, "insert")
+	}
+	return alert.ID, nil
+}
+
+func (r *ItemAlertRepository) getItemAlerts(filter bson.M) ([]model.ItemAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.ItemAlertCol.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var alerts []model.ItemAlert
+	err = cursor.All(ctx, &alerts)
+	return alerts, err
+}
+
+// @return the alerts not disabled
+func (r *ItemAlertRepository) GetAllActive() ([]model.ItemAlert, error) {
+	return r.getItemAlerts(bson.M{"disabled": bson.M{"$ne": true}})
+}
+
+func (r *ItemAlertRepository) GetItemAlertsByItemId(itemId string) ([]model.ItemAlert, error) {
+	return r.getItemAlerts(bson.M{"itemId": itemId})
+}
+
+func (r *ItemAlertRepository) GetItemAlertsByOwnerId(ownerId primitive.ObjectID) ([]model.ItemAlert, error) {
+	return r.getItemAlerts(bson.M{"ownerId": ownerId})
+}
+
+// Pause or resume an alert of the owner
+func (r *ItemAlertRepository) SetItemAlertDisabled(id, ownerId primitive.ObjectID, disabled bool) (*model.ItemAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"disabled": disabled}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	alert := &model.ItemAlert{}
+	err := r.ItemAlertCol.FindOneAndUpdate(ctx, bson.M{"_id": id, "ownerId": ownerId}, update, opts).Decode(alert)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(alert, "update")
+	}
+	return alert, nil
+}
+
+// Save the state of the last check, not broadcast as the checker owns the state
+func (r *ItemAlertRepository) UpdateItemAlertState(alert *model.ItemAlert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.ItemAlertCol.UpdateOne(ctx, bson.M{"_id": alert.ID}, bson.M{"$set": bson.M{
+		"lastPrice":       alert.LastPrice,
+		"lastMarket":      alert.LastMarket,
+		"lastTriggeredAt": alert.LastTriggeredAt,
+	}})
+	return err
+}
+
+func (r *ItemAlertRepository) DeleteItemAlertById(id, ownerId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	var alert model.ItemAlert
+	err := r.ItemAlertCol.FindOneAndDelete(ctx, bson.M{"_id": id, "ownerId": ownerId}).Decode(&alert)
+	if err != nil {
+		return err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(&alert, "delete")
+	}
+	return nil
+}
+
+// Delete all alerts of the owner
+// @return deleted alerts
+func (r *ItemAlertRepository) DeleteAllByOwnerId(ownerId primitive.ObjectID) ([]model.ItemAlert, error) {
+	alerts, err := r.GetItemAlertsByOwnerId(ownerId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if _, err := r.ItemAlertCol.DeleteMany(ctx, bson.M{"ownerId": ownerId}); err != nil {
+		return nil, err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		for i := range alerts {
+			r.ChangeStreamCallback(&alerts[i], "delete")
+		}
+	}
+
+	return alerts, nil
+}
+
+func (r *ItemAlertRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.ItemAlertCol.DeleteMany(ctx, bson.M{})
+	return err
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -16,6 +18,8 @@ import (
 type ItemRepository struct {
 	ItemCol              *mongo.Collection
 	ChangeStreamCallback ChangeStreamCallback
+	// Optional, records the market price changes of the upserts
+	PriceHistory *PriceHistoryRepository
 }
 
 func (r *ItemRepository) FindItemByName(name string) (*model.Item, error) {
@@ -27,6 +31,22 @@ func (r *ItemRepository) FindItemByName(name string) (*model.Item, error) {
 	return &item, err
 }
 
+// @return the items found by name, missing names are skipped
+func (r *ItemRepository) FindItemsByNames(names []string) ([]model.Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.ItemCol.Find(ctx, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []model.Item
+	err = cursor.All(ctx, &items)
+	return items, err
+}
+
 func (r *ItemRepository) FindItemById(id string) (*model.Item, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
@@ -68,7 +88,31 @@ func (r *ItemRepository) UpsertItem(item *model.Item) error {
 	opt := options.Update().SetUpsert(true)
 
 	_, err = r.ItemCol.UpdateOne(ctx, bson.M{"_id": item.ID}, update, opt)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// the item is written, a missed snapshot is not retried
+	if r.PriceHistory != nil {
+		if err := r.PriceHistory.InsertSnapshots(GetPriceSnapshots(oldItem, item, time.Now())); err != nil {
+			log.Printf("ItemRepository.UpsertItem: %s: %v", item.Name, err)
+		}
+	}
+	r.onItemUpserted(item.ID)
+	return nil
+}
+
+// notify the stored item, as the upsert only sets the changed fields
+func (r *ItemRepository) onItemUpserted(id string) {
+	if r.ChangeStreamCallback == nil {
+		return
+	}
+	item, err := r.FindItemById(id)
+	if err != nil {
+		log.Printf("ItemRepository.onItemUpserted: %s: %v", id, err)
+		return
+	}
+	r.ChangeStreamCallback(item, "update")
 }
 
 func (r *ItemRepository) GetAll() ([]model.Item, error) {
@@ -146,3 +190,211 @@ func (r *ItemRepository) GetItemFilters() (map[string][]interface{}, error) {
 
 	return filters, nil
 }
+
+// Market price of an item set by a scrape
+type MarketPriceUpdate struct {
+	ItemId string
+	// set if the item is created
+	Name   string
+	Market string
+	// UpdatedAt is the time of the scrape, now if not set
+	Price model.MarketPrice
+}
+
+// @return filter & update setting the market price only if newer than the stored one
+func getMarketPriceUpdate(update *MarketPriceUpdate, now time.Time) (bson.M, bson.M, error) {
+	field := shared.GetMarketPriceField(update.Market)
+	if field == "" {
+		return nil, nil, fmt.Errorf("unknown market %s", update.Market)
+	}
+	if update.Price.UpdatedAt.IsZero() {
+		update.Price.UpdatedAt = now
+	}
+
+	filter := bson.M{
+		"_id": update.ItemId,
+		"$or": bson.A{
+			bson.M{field: nil},
+			bson.M{field + ".updatedAt": bson.M{"$lt": update.Price.UpdatedAt}},
+		},
+	}
+	set := bson.M{
+		field:       update.Price,
+		"updatedAt": now,
+	}
+	if update.Name != "" {
+		set["name"] = update.Name
+	}
+	return filter, bson.M{"$set": set}, nil
+}
+
+// SetMarketPrice sets the market price of the item atomically if newer than the stored one, the item is created if not found
+// @return the updated item, nil if the stored price is newer
+func (r *ItemRepository) SetMarketPrice(update MarketPriceUpdate) (*model.Item, error) {
+	filter, doc, err := getMarketPriceUpdate(&update, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// snapshots are only recorded for the changed prices
+	previous, err := r.FindItemById(update.ItemId)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var item model.Item
+	err = r.ItemCol.FindOneAndUpdate(ctx, filter, doc, opts).Decode(&item)
+	// the filter misses an existing item with a newer price, or a concurrent upsert created the item first
+	if mongo.IsDuplicateKeyError(err) {
+		err = r.ItemCol.FindOneAndUpdate(ctx, filter, doc, opts).Decode(&item)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	update.Name = item.Name
+	r.onMarketPricesSet([]MarketPriceUpdate{update}, []model.Item{item}, map[string]*model.Item{item.ID: previous})
+	return &item, nil
+}
+
+// BulkSetMarketPrices sets the market prices of the items like SetMarketPrice in one bulk write
+// @return the updated items
+func (r *ItemRepository) BulkSetMarketPrices(updates []MarketPriceUpdate) ([]model.Item, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	// do not modify the updates of the caller
+	updates = append([]MarketPriceUpdate(nil), updates...)
+
+	now := time.Now()
+	filters := make([]bson.M, len(updates))
+	docs := make([]bson.M, len(updates))
+	operations := make([]mongo.WriteModel, len(updates))
+	ids := make([]string, len(updates))
+	for i := range updates {
+		filter, doc, err := getMarketPriceUpdate(&updates[i], now)
+		if err != nil {
+			return nil, err
+		}
+		filters[i], docs[i] = filter, doc
+		operations[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(doc).SetUpsert(true)
+		ids[i] = updates[i].ItemId
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	// snapshots are only recorded for the changed prices
+	previous, err := r.findItemsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// retry the duplicate keys one by one, the others are newer prices or failed writes
+	var retries []int
+	_, err = r.ItemCol.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return nil, err
+			}
+			retries = append(retries, writeErr.Index)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, i := range retries {
+		if _, err := r.ItemCol.UpdateOne(ctx, filters[i], docs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// the items holding the prices of the updates were updated
+	itemsById, err := r.findItemsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []MarketPriceUpdate
+	var updated []model.Item
+	seen := make(map[string]bool)
+	for _, update := range updates {
+		item, ok := itemsById[update.ItemId]
+		if !ok {
+			continue
+		}
+		price := shared.GetMarketPrice(item, update.Market)
+		// stored in milliseconds
+		if price == nil || !price.UpdatedAt.Equal(update.Price.UpdatedAt.Truncate(time.Millisecond)) {
+			continue
+		}
+		update.Name = item.Name
+		applied = append(applied, update)
+		if !seen[item.ID] {
+			seen[item.ID] = true
+			updated = append(updated, *item)
+		}
+	}
+
+	r.onMarketPricesSet(applied, updated, previous)
+	return updated, nil
+}
+
+// @return item id -> item
+func (r *ItemRepository) findItemsByIds(ctx context.Context, ids []string) (map[string]*model.Item, error) {
+	cursor, err := r.ItemCol.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []model.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	itemsById := make(map[string]*model.Item, len(items))
+	for i := range items {
+		itemsById[items[i].ID] = &items[i]
+	}
+	return itemsById, nil
+}
+
+// record the snapshots of the changed prices & notify the updated items
+// @param previous item id -> the item before the updates
+func (r *ItemRepository) onMarketPricesSet(updates []MarketPriceUpdate, items []model.Item, previous map[string]*model.Item) {
+	if r.PriceHistory != nil && len(updates) > 0 {
+		var snapshots []model.PriceSnapshot
+		for _, update := range updates {
+			if old := previous[update.ItemId]; old != nil && IsSameMarketPrice(shared.GetMarketPrice(old, update.Market), &update.Price) {
+				continue
+			}
+			snapshots = append(snapshots, model.PriceSnapshot{
+				Metadata:  model.PriceSnapshotMetadata{Name: update.Name, Market: update.Market},
+				CreatedAt: update.Price.UpdatedAt,
+				Price:     update.Price.Price,
+				Currency:  update.Price.Currency,
+			})
+		}
+		if err := r.PriceHistory.InsertSnapshots(snapshots); err != nil {
+			log.Printf("ItemRepository.onMarketPricesSet: %v", err)
+		}
+	}
+
+	if r.ChangeStreamCallback != nil {
+		for i := range items {
+			r.ChangeStreamCallback(&items[i], "update")
+		}
+	}
+}
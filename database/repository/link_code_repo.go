@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/credentials"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type LinkCodeRepository struct {
+	LinkCodeCol *mongo.Collection
+}
+
+var ErrInvalidLinkCode = fmt.Errorf("invalid or expired link code")
+
+// Issue a one-time code for the user to link a channel of channelType
+func (r *LinkCodeRepository) IssueLinkCode(userId primitive.ObjectID, channelType string) (*model.LinkCode, error) {
+	code, err := credentials.GenerateCode(shared.LINK_CODE_LENGTH)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	now := time.Now()
+	linkCode := &model.LinkCode{
+		Code:        code,
+		UserId:      userId,
+		ChannelType: channelType,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(shared.LINK_CODE_DURATION),
+	}
+
+	result, err := r.LinkCodeCol.InsertOne(ctx, linkCode)
+	if err != nil {
+		return nil, err
+	}
+	linkCode.ID = result.InsertedID.(primitive.ObjectID)
+
+	return linkCode, nil
+}
+
+// Consume the code, a code can only be consumed once
+// @return link code, ErrInvalidLinkCode if not found or expired
+func (r *LinkCodeRepository) ConsumeLinkCode(code, channelType string) (*model.LinkCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	filter := bson.M{
+		"code":        code,
+		"channelType": channelType,
+		"expiresAt":   bson.M{"$gt": time.Now()},
+	}
+
+	linkCode := &model.LinkCode{}
+	err := r.LinkCodeCol.FindOneAndDelete(ctx, filter).Decode(linkCode)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidLinkCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	return linkCode, nil
+}
+
+// Delete the pending codes of the user
+func (r *LinkCodeRepository) DeleteAllByUserId(userId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.LinkCodeCol.DeleteMany(ctx, bson.M{"userId": userId})
+	return err
+}
+
+func (r *LinkCodeRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.LinkCodeCol.DeleteMany(ctx, bson.M{})
+	return err
+}
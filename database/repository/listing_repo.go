@@ -2,8 +2,13 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"time"
 
+	shared "github.com/mikezzb/steam-trading-shared"
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,8 +17,12 @@ import (
 )
 
 type ListingRepository struct {
-	ListingCol           *mongo.Collection
+	ListingCol *mongo.Collection
+	// stale listings are moved here by the cleanup
+	ArchiveCol           *mongo.Collection
 	ChangeStreamCallback ChangeStreamCallback
+	// Optional, notified of the events of the upserts with *model.ListingEvent, the operation type is the event type
+	EventCallback ChangeStreamCallback
 }
 
 func (r *ListingRepository) GetListingByItemName(name string) (*model.Listing, error) {
@@ -29,6 +38,10 @@ func (r *ListingRepository) Count(filters bson.M) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
 
+	filters, err := AddVisibleListingFilter(filters, time.Now())
+	if err != nil {
+		return 0, err
+	}
 	return r.ListingCol.CountDocuments(ctx, filters)
 }
 
@@ -40,6 +53,36 @@ func (r *ListingRepository) GetListingsByPage(page int, pageSize int, filters bs
 	// sort by price by default, ascending
 	opts.SetSort(bson.M{"price": 1})
 
+	filters, err := AddVisibleListingFilter(filters, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.ListingCol.Find(ctx, filters, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var listings []model.Listing
+	err = cursor.All(ctx, &listings)
+	return listings, err
+}
+
+// GetListingsByDiscount returns the scored listings, the biggest discount to the fair value first
+func (r *ListingRepository) GetListingsByDiscount(page int, pageSize int, filters bson.M) ([]model.Listing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	// only scored visible listings
+	filters, err := AddVisibleListingFilter(filters, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	filters["fairValue"] = bson.M{"$gt": 0}
+
+	opts := GetPageOpts(page, pageSize)
+	opts.SetSort(bson.D{{Key: "discount", Value: -1}, {Key: "price", Value: 1}})
+
 	cursor, err := r.ListingCol.Find(ctx, filters, opts)
 	if err != nil {
 		return nil, err
@@ -51,6 +94,29 @@ func (r *ListingRepository) GetListingsByPage(page int, pageSize int, filters bs
 	return listings, err
 }
 
+// Set the fair value & discount of the listings by id
+func (r *ListingRepository) UpdateListingScores(listings []model.Listing) error {
+	if len(listings) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	operations := make([]mongo.WriteModel, 0, len(listings))
+	for _, listing := range listings {
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": listing.ID}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"fairValue": listing.FairValue,
+				"discount":  listing.Discount,
+			}}))
+	}
+
+	_, err := r.ListingCol.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
 func (r *ListingRepository) FindOneListing(filter bson.M) (*model.Listing, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
@@ -65,6 +131,7 @@ func (r *ListingRepository) InsertListings(listings []model.Listing) error {
 	defer cancel()
 	var documents []interface{}
 	for _, listing := range listings {
+		SetListingPhase(&listing)
 		documents = append(documents, listing)
 	}
 	_, err := r.ListingCol.InsertMany(ctx, documents, options.InsertMany())
@@ -73,55 +140,425 @@ func (r *ListingRepository) InsertListings(listings []model.Listing) error {
 
 // Returns the listings that were really updated / created
 func (r *ListingRepository) UpsertListingsByAssetID(listings []model.Listing) ([]model.Listing, error) {
-	updatedListings := make([]model.Listing, 0)
+	changes, _, err := r.upsertListingChanges(listings)
+
+	updatedListings := make([]model.Listing, 0, len(changes))
+	for _, change := range changes {
+		updatedListings = append(updatedListings, change.Listing)
+	}
+	return updatedListings, err
+}
+
+// UpsertListingEvents upserts the listings and returns the events of the new listings & price changes
+// The events of the written listings are returned with the write errors
+func (r *ListingRepository) UpsertListingEvents(listings []model.Listing) ([]model.ListingEvent, error) {
+	_, events, err := r.upsertListingChanges(listings)
+	return events, err
+}
+
+// @return the changed listings in input order, and the events among them
+func (r *ListingRepository) upsertListingChanges(listings []model.Listing) ([]ListingChange, []model.ListingEvent, error) {
+	result, upsertErr := r.BulkUpsertListings(listings)
+
+	// the new & relisted assets may be moved from another market
+	var moved []model.Listing
+	for _, change := range result.Changes {
+		if change.Previous == nil || change.Previous.Status != "" {
+			moved = append(moved, change.Listing)
+		}
+	}
+	// the listings are written, the moved assets are treated as new without the other markets
+	others, err := r.findListingsOnOtherMarkets(moved)
+	if err != nil {
+		log.Printf("ListingRepository.upsertListingChanges: %v", err)
+	}
+
+	// field only changes have no event
+	events := make([]model.ListingEvent, 0, len(result.Changes))
+	for i := range result.Changes {
+		change := &result.Changes[i]
+		if event := shared.GetListingEvent(&change.Listing, change.Previous, others[GetListingKey(&change.Listing)]); event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	if r.ChangeStreamCallback != nil {
+		for i := range result.Changes {
+			r.ChangeStreamCallback(&result.Changes[i].Listing, "update")
+		}
+	}
+	if r.EventCallback != nil {
+		for i := range events {
+			r.EventCallback(&events[i], events[i].Type)
+		}
+	}
+	return result.Changes, events, upsertErr
+}
+
+// @return listing key -> the latest listing of the asset on another market
+func (r *ListingRepository) findListingsOnOtherMarkets(listings []model.Listing) (map[string]*model.Listing, error) {
+	others := make(map[string]*model.Listing)
+	if len(listings) == 0 {
+		return others, nil
+	}
+
+	assetIds := make([]string, len(listings))
+	for i := range listings {
+		assetIds[i] = listings[i].AssetId
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
 
-	// upsert each listing to know which one was really updated / created
-	for _, listing := range listings {
+	// latest last
+	opts := options.Find().SetSort(bson.M{"checkedAt": 1})
+	cursor, err := r.ListingCol.Find(ctx, bson.M{"assetId": bson.M{"$in": assetIds}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []model.Listing
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	// asset id -> listings of the asset, latest last
+	assetListings := make(map[string][]*model.Listing)
+	for i := range found {
+		assetListings[found[i].AssetId] = append(assetListings[found[i].AssetId], &found[i])
+	}
+
+	for i := range listings {
+		for _, other := range assetListings[listings[i].AssetId] {
+			if other.Market != listings[i].Market {
+				others[GetListingKey(&listings[i])] = other
+			}
+		}
+	}
+	return others, nil
+}
+
+// A listing inserted or modified by an upsert
+type ListingChange struct {
+	Listing model.Listing
+	// the document before the upsert, nil if inserted
+	Previous *model.Listing
+}
+
+type ListingUpsertResult struct {
+	// the inserted & modified listings in the order of the upsert, unchanged listings are left out
+	Changes []ListingChange
+	// the listings not written, the errors are returned by the upsert
+	Failed []model.Listing
+}
+
+func (r *ListingUpsertResult) Inserted() []model.Listing {
+	var inserted []model.Listing
+	for _, change := range r.Changes {
+		if change.Previous == nil {
+			inserted = append(inserted, change.Listing)
+		}
+	}
+	return inserted
+}
+
+// @return the modified listings with their previous documents
+func (r *ListingUpsertResult) Modified() []ListingChange {
+	var modified []ListingChange
+	for _, change := range r.Changes {
+		if change.Previous != nil {
+			modified = append(modified, change)
+		}
+	}
+	return modified
+}
+
+type ListingWriteError struct {
+	Listing model.Listing
+	Err     error
+}
+
+func (e *ListingWriteError) Error() string {
+	return fmt.Sprintf("listing %s: %v", GetListingKey(&e.Listing), e.Err)
+}
+
+func (e *ListingWriteError) Unwrap() error {
+	return e.Err
+}
+
+// BulkUpsertListings upserts the listings by asset id & market in chunks of LISTING_CHUNK_SIZE
+// A failed write does not stop the others, the errors are joined into the returned error
+func (r *ListingRepository) BulkUpsertListings(listings []model.Listing) (*ListingUpsertResult, error) {
+	result := &ListingUpsertResult{}
+
+	var errs []error
+	for start := 0; start < len(listings); start += LISTING_CHUNK_SIZE {
+		end := min(start+LISTING_CHUNK_SIZE, len(listings))
+		if err := r.upsertListingChunk(listings[start:end], result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+func (r *ListingRepository) upsertListingChunk(chunk []model.Listing, result *ListingUpsertResult) error {
+	// do not modify the listings of the caller
+	listings := make([]model.Listing, len(chunk))
+	copy(listings, chunk)
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	previous, err := r.findListingsByKeys(ctx, listings)
+	if err != nil {
+		result.Failed = append(result.Failed, listings...)
+		return err
+	}
+
+	operations := make([]mongo.WriteModel, len(listings))
+	for i := range listings {
+		listing := &listings[i]
+		SetListingPhase(listing)
 		// also need to filter by market name since different markets can have different prices for the same asset
-		filter := bson.M{
-			"assetId": listing.AssetId,
-			"market":  listing.Market,
+		operations[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"assetId": listing.AssetId, "market": listing.Market}).
+			SetUpdate(GetListingUpsertBson(listing)).
+			SetUpsert(true)
+	}
+
+	// index in the chunk -> write error
+	failed := make(map[int]error)
+	_, err = r.ListingCol.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = writeErr
 		}
-		update := bson.M{"$set": listing}
-		opts := options.Update().SetUpsert(true)
+	} else if err != nil {
+		result.Failed = append(result.Failed, listings...)
+		return err
+	}
 
-		result, err := r.ListingCol.UpdateOne(ctx, filter, update, opts)
+	var errs []error
+	for i := range listings {
+		listing := &listings[i]
+		if writeErr, ok := failed[i]; ok {
+			result.Failed = append(result.Failed, *listing)
+			errs = append(errs, &ListingWriteError{Listing: *listing, Err: writeErr})
+			continue
+		}
+
+		prev, ok := previous[GetListingKey(listing)]
+		if !ok {
+			result.Changes = append(result.Changes, ListingChange{Listing: *listing})
+			continue
+		}
+		modified, err := IsListingModified(prev, listing)
 		if err != nil {
-			return nil, err
+			errs = append(errs, &ListingWriteError{Listing: *listing, Err: err})
+			continue
+		}
+		if modified {
+			result.Changes = append(result.Changes, ListingChange{Listing: *listing, Previous: prev})
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		// if created or updated
-		if result.UpsertedID != nil || result.ModifiedCount > 0 {
-			updatedListings = append(updatedListings, listing)
+// @return listing key -> the stored listing with the same asset id & market
+func (r *ListingRepository) findListingsByKeys(ctx context.Context, listings []model.Listing) (map[string]*model.Listing, error) {
+	// market -> asset ids
+	marketAssetIds := make(map[string][]string)
+	for i := range listings {
+		marketAssetIds[listings[i].Market] = append(marketAssetIds[listings[i].Market], listings[i].AssetId)
+	}
 
-			if r.ChangeStreamCallback != nil {
-				r.ChangeStreamCallback(&listing, "update")
-			}
-		}
+	or := make(bson.A, 0, len(marketAssetIds))
+	for market, assetIds := range marketAssetIds {
+		or = append(or, bson.M{"market": market, "assetId": bson.M{"$in": assetIds}})
 	}
 
-	return updatedListings, nil
+	cursor, err := r.ListingCol.Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []model.Listing
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]*model.Listing, len(found))
+	for i := range found {
+		previous[GetListingKey(&found[i])] = &found[i]
+	}
+	return previous, nil
 }
 
 func (r *ListingRepository) BulkUpsertListingsByAssetID(listings []model.Listing) error {
+	_, err := r.BulkUpsertListings(listings)
+	return err
+}
+
+// @return phase -> lowest listing price of the item in the normalized currency, only Doppler items have phases
+func (r *ListingRepository) GetBestPricesByPhase(name string) (map[string]float64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
 
-	var operations []mongo.WriteModel
+	match, err := AddVisibleListingFilter(bson.M{
+		"name":  name,
+		"phase": bson.M{"$exists": true, "$ne": ""},
+	}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// the markets price in different currencies, normalized after grouping
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"phase":    "$phase",
+				"market":   "$market",
+				"currency": "$currency",
+			},
+			"price": bson.M{"$min": "$price"},
+		}},
+	}
+
+	cursor, err := r.ListingCol.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	prices := make(map[string]float64)
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				Phase    string `bson:"phase"`
+				Market   string `bson:"market"`
+				Currency string `bson:"currency"`
+			} `bson:"_id"`
+			Price primitive.Decimal128 `bson:"price"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+
+		currency := result.ID.Currency
+		if currency == "" {
+			currency = shared.GetMarketCurrency(result.ID.Market)
+		}
+		price, err := shared.NormalizePrice(result.Price, currency)
+		if err != nil {
+			log.Printf("ListingRepository.GetBestPricesByPhase: %s: %v", name, err)
+			continue
+		}
+		if best, ok := prices[result.ID.Phase]; !ok || price < best {
+			prices[result.ID.Phase] = price
+		}
+	}
+
+	return prices, cursor.Err()
+}
+
+// @return the cheapest listing of the item in the phase
+func (r *ListingRepository) GetBestListingByPhase(name, phase string) (*model.Listing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.M{"price": 1})
+
+	filters, err := AddVisibleListingFilter(bson.M{"name": name, "phase": phase}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var listing model.Listing
+	err = r.ListingCol.FindOne(ctx, filters, opts).Decode(&listing)
+	return &listing, err
+}
+
+// @return listings of the assets on the market
+func (r *ListingRepository) FindListingsByAssetIds(market string, assetIds []string) ([]model.Listing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.ListingCol.Find(ctx, bson.M{
+		"market":  market,
+		"assetId": bson.M{"$in": assetIds},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var listings []model.Listing
+	err = cursor.All(ctx, &listings)
+	return listings, err
+}
+
+// @return the cheapest listing of the item on the market
+func (r *ListingRepository) GetBestListing(name, market string) (*model.Listing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.M{"price": 1})
+
+	filters, err := AddVisibleListingFilter(bson.M{"name": name, "market": market}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var listing model.Listing
+	err = r.ListingCol.FindOne(ctx, filters, opts).Decode(&listing)
+	return &listing, err
+}
+
+// @return the active listings of the item on the market
+func (r *ListingRepository) FindActiveListings(name, market string) ([]model.Listing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.ListingCol.Find(ctx, AddActiveListingFilter(bson.M{"name": name, "market": market}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var listings []model.Listing
+	err = cursor.All(ctx, &listings)
+	return listings, err
+}
+
+// Set the removal fields of the listings by id
+func (r *ListingRepository) MarkListingsRemoved(listings []model.Listing) error {
+	if len(listings) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	operations := make([]mongo.WriteModel, 0, len(listings))
 	for _, listing := range listings {
-		filter := bson.M{"assetId": listing.AssetId}
-		update := bson.M{"$set": listing}
-		model := mongo.NewUpdateOneModel().
-			SetFilter(filter).
-			SetUpdate(update).
-			SetUpsert(true)
-		operations = append(operations, model)
+		set := bson.M{
+			"status":       listing.Status,
+			"removedAt":    listing.RemovedAt,
+			"timeOnMarket": listing.TimeOnMarket,
+		}
+		if !listing.TransactionId.IsZero() {
+			set["transactionId"] = listing.TransactionId
+		}
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": listing.ID}).
+			SetUpdate(bson.M{"$set": set}))
 	}
 
-	_, err := r.ListingCol.BulkWrite(ctx, operations)
+	_, err := r.ListingCol.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
 	return err
 }
 
@@ -221,3 +658,187 @@ func (r *ListingRepository) DeleteAll() error {
 	_, err := r.ListingCol.DeleteMany(ctx, bson.M{})
 	return err
 }
+
+// Stale active listings of a market not checked since the time
+func getStaleListingFilter(market string, markets bson.A, before time.Time) bson.M {
+	filters := AddActiveListingFilter(bson.M{"checkedAt": bson.M{"$lt": before}})
+	if market == "" {
+		filters["market"] = bson.M{"$nin": markets}
+	} else {
+		filters["market"] = market
+	}
+	return filters
+}
+
+// CleanupStaleListings archives or deletes the active listings past the removal age of their market
+// @return number of archived & deleted listings
+func (r *ListingRepository) CleanupStaleListings(now time.Time) (archived int64, deleted int64, err error) {
+	policies := shared.GetStalenessPolicies()
+	markets := make(bson.A, 0, len(policies))
+	for market := range policies {
+		markets = append(markets, market)
+	}
+
+	// "" for the markets without a policy
+	policies = maps.Clone(policies)
+	policies[""] = shared.DEFAULT_STALENESS_POLICY
+
+	for market, policy := range policies {
+		if policy.RemoveAfter <= 0 {
+			continue
+		}
+		filters := getStaleListingFilter(market, markets, now.Add(-policy.RemoveAfter))
+
+		if policy.Action == shared.STALE_ACTION_ARCHIVE {
+			count, err := r.archiveListings(filters)
+			archived += count
+			if err != nil {
+				return archived, deleted, err
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+		result, err := r.ListingCol.DeleteMany(ctx, filters)
+		cancel()
+		if err != nil {
+			return archived, deleted, err
+		}
+		deleted += result.DeletedCount
+	}
+	return archived, deleted, nil
+}
+
+// Move the listings matching the filters to the archive collection
+func (r *ListingRepository) archiveListings(filters bson.M) (int64, error) {
+	if r.ArchiveCol == nil {
+		return 0, fmt.Errorf("listing archive collection not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.ListingCol.Find(ctx, filters)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var listings []model.Listing
+	if err := cursor.All(ctx, &listings); err != nil {
+		return 0, err
+	}
+	if len(listings) == 0 {
+		return 0, nil
+	}
+
+	// replace by id so a retry after a failed delete does not duplicate
+	operations := make([]mongo.WriteModel, 0, len(listings))
+	ids := make(bson.A, 0, len(listings))
+	for i := range listings {
+		operations = append(operations, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": listings[i].ID}).
+			SetReplacement(&listings[i]).
+			SetUpsert(true))
+		ids = append(ids, listings[i].ID)
+	}
+	if _, err := r.ArchiveCol.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, err
+	}
+
+	result, err := r.ListingCol.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// StartStaleCleanup runs CleanupStaleListings every interval until stop is called
+func (r *ListingRepository) StartStaleCleanup(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				archived, deleted, err := r.CleanupStaleListings(now)
+				if err != nil {
+					log.Printf("ListingRepository.StartStaleCleanup: %v", err)
+					continue
+				}
+				if archived > 0 || deleted > 0 {
+					log.Printf("ListingRepository.StartStaleCleanup: archived %d, deleted %d stale listings", archived, deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+type ListingFreshness struct {
+	Fresh int64 `json:"fresh"`
+	Stale int64 `json:"stale"`
+}
+
+// @return market -> number of fresh & stale active listings
+func (r *ListingRepository) CountListingFreshness(now time.Time) (map[string]ListingFreshness, error) {
+	total, err := r.countByMarket(AddActiveListingFilter(bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+	filters, err := AddVisibleListingFilter(bson.M{}, now)
+	if err != nil {
+		return nil, err
+	}
+	fresh, err := r.countByMarket(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]ListingFreshness, len(total))
+	for market, count := range total {
+		counts[market] = ListingFreshness{
+			Fresh: fresh[market],
+			Stale: count - fresh[market],
+		}
+	}
+	return counts, nil
+}
+
+// @return market -> number of listings matching the filters
+func (r *ListingRepository) countByMarket(filters bson.M) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	pipeline := bson.A{
+		bson.M{"$match": filters},
+		bson.M{"$group": bson.M{
+			"_id":   "$market",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.ListingCol.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int64)
+	for cursor.Next(ctx) {
+		var result struct {
+			Market string `bson:"_id"`
+			Count  int64  `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		counts[result.Market] = result.Count
+	}
+	return counts, cursor.Err()
+}
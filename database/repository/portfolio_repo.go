@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PortfolioRepository struct {
+	HoldingCol  *mongo.Collection
+	SnapshotCol *mongo.Collection
+}
+
+func (r *PortfolioRepository) InsertHolding(holding *model.Holding) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if holding.CreatedAt.IsZero() {
+		holding.CreatedAt = time.Now()
+	}
+
+	result, err := r.HoldingCol.InsertOne(ctx, holding)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	holding.ID = result.InsertedID.(primitive.ObjectID)
+	return holding.ID, nil
+}
+
+// UpsertHoldingsByAssetId upserts the holdings of the owners by asset id, holdings without an asset id are inserted
+// The sale of an existing holding is kept
+func (r *PortfolioRepository) UpsertHoldingsByAssetId(holdings []model.Holding) error {
+	if len(holdings) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	now := time.Now()
+	operations := make([]mongo.WriteModel, len(holdings))
+	for i := range holdings {
+		holding := holdings[i]
+		if holding.CreatedAt.IsZero() {
+			holding.CreatedAt = now
+		}
+		if holding.AssetId == "" {
+			operations[i] = mongo.NewInsertOneModel().SetDocument(holding)
+			continue
+		}
+
+		operations[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ownerId": holding.OwnerId, "assetId": holding.AssetId}).
+			SetUpdate(bson.M{
+				"$set":         getHoldingSetBson(&holding),
+				"$setOnInsert": bson.M{"createdAt": holding.CreatedAt},
+			}).
+			SetUpsert(true)
+	}
+
+	_, err := r.HoldingCol.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// the fields of the holding set by an upsert, the sale & creation time are left as is
+func getHoldingSetBson(holding *model.Holding) bson.M {
+	set := bson.M{
+		"name":          holding.Name,
+		"paintWear":     holding.PaintWear,
+		"purchasePrice": holding.PurchasePrice,
+		"purchasedAt":   holding.PurchasedAt,
+		"tradable":      holding.Tradable,
+	}
+	optional := map[string]interface{}{
+		"itemId":           holding.ItemId,
+		"paintSeed":        holding.PaintSeed,
+		"rarity":           holding.Rarity,
+		"phase":            holding.Phase,
+		"amount":           holding.Amount,
+		"inspectLink":      holding.InspectLink,
+		"purchaseCurrency": holding.PurchaseCurrency,
+		"purchaseMarket":   holding.PurchaseMarket,
+	}
+	for key, value := range optional {
+		if value != "" && value != 0 {
+			set[key] = value
+		}
+	}
+	return set
+}
+
+func (r *PortfolioRepository) getHoldings(filter bson.M) ([]model.Holding, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"purchasedAt": 1})
+	cursor, err := r.HoldingCol.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var holdings []model.Holding
+	err = cursor.All(ctx, &holdings)
+	return holdings, err
+}
+
+// @return the held & sold holdings of the owner, oldest purchase first
+func (r *PortfolioRepository) GetHoldingsByOwnerId(ownerId primitive.ObjectID) ([]model.Holding, error) {
+	return r.getHoldings(bson.M{"ownerId": ownerId})
+}
+
+// @return the holdings of the owner not sold yet
+func (r *PortfolioRepository) GetHeldByOwnerId(ownerId primitive.ObjectID) ([]model.Holding, error) {
+	return r.getHoldings(bson.M{"ownerId": ownerId, "soldAt": bson.M{"$exists": false}})
+}
+
+// @return the owners with holdings not sold yet
+func (r *PortfolioRepository) GetAllOwnerIds() ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	values, err := r.HoldingCol.Distinct(ctx, "ownerId", bson.M{"soldAt": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+
+	ownerIds := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if ownerId, ok := value.(primitive.ObjectID); ok {
+			ownerIds = append(ownerIds, ownerId)
+		}
+	}
+	return ownerIds, nil
+}
+
+func (r *PortfolioRepository) GetHoldingById(id, ownerId primitive.ObjectID) (*model.Holding, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	var holding model.Holding
+	err := r.HoldingCol.FindOne(ctx, bson.M{"_id": id, "ownerId": ownerId}).Decode(&holding)
+	return &holding, err
+}
+
+// Record the sale of a holding of the owner
+// @param price the sale price before the seller fees, currency empty for the default currency of the market
+func (r *PortfolioRepository) MarkHoldingSold(id, ownerId primitive.ObjectID, price primitive.Decimal128, currency, market string, soldAt time.Time) (*model.Holding, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	set := bson.M{
+		"salePrice":  price,
+		"saleMarket": market,
+		"soldAt":     soldAt,
+	}
+	if currency != "" {
+		set["saleCurrency"] = currency
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	holding := &model.Holding{}
+	err := r.HoldingCol.FindOneAndUpdate(ctx, bson.M{"_id": id, "ownerId": ownerId}, bson.M{"$set": set}, opts).Decode(holding)
+	if err != nil {
+		return nil, err
+	}
+	return holding, nil
+}
+
+func (r *PortfolioRepository) DeleteHoldingById(id, ownerId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	result, err := r.HoldingCol.DeleteOne(ctx, bson.M{"_id": id, "ownerId": ownerId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *PortfolioRepository) InsertSnapshot(snapshot *model.PortfolioSnapshot) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if snapshot.CreatedAt.IsZero() {
+		snapshot.CreatedAt = time.Now()
+	}
+
+	result, err := r.SnapshotCol.InsertOne(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	snapshot.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// @return snapshots of the owner since the time, oldest first
+func (r *PortfolioRepository) GetSnapshots(ownerId primitive.ObjectID, since time.Time) ([]model.PortfolioSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := r.SnapshotCol.Find(ctx, bson.M{
+		"ownerId":   ownerId,
+		"createdAt": bson.M{"$gte": since},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var snapshots []model.PortfolioSnapshot
+	err = cursor.All(ctx, &snapshots)
+	return snapshots, err
+}
+
+// Delete all holdings & snapshots of the owner
+func (r *PortfolioRepository) DeleteAllByOwnerId(ownerId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if _, err := r.HoldingCol.DeleteMany(ctx, bson.M{"ownerId": ownerId}); err != nil {
+		return err
+	}
+	_, err := r.SnapshotCol.DeleteMany(ctx, bson.M{"ownerId": ownerId})
+	return err
+}
+
+func (r *PortfolioRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if _, err := r.HoldingCol.DeleteMany(ctx, bson.M{}); err != nil {
+		return err
+	}
+	_, err := r.SnapshotCol.DeleteMany(ctx, bson.M{})
+	return err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PriceHistoryRepository struct {
+	PriceHistoryCol *mongo.Collection
+}
+
+func (r *PriceHistoryRepository) InsertSnapshots(snapshots []model.PriceSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	documents := make([]interface{}, len(snapshots))
+	for i := range snapshots {
+		documents[i] = snapshots[i]
+	}
+	_, err := r.PriceHistoryCol.InsertMany(ctx, documents)
+	return err
+}
+
+// @return snapshots of the item on the market in [since, until), oldest first
+func (r *PriceHistoryRepository) GetPriceHistory(name, market string, since, until time.Time) ([]model.PriceSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := r.PriceHistoryCol.Find(ctx, bson.M{
+		"metadata.name":   name,
+		"metadata.market": market,
+		"createdAt":       bson.M{"$gte": since, "$lt": until},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var snapshots []model.PriceSnapshot
+	err = cursor.All(ctx, &snapshots)
+	return snapshots, err
+}
+
+// @return the price of the item on the market at the time, mongo.ErrNoDocuments if no snapshot before
+func (r *PriceHistoryRepository) GetPriceAt(name, market string, at time.Time) (*model.PriceSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.M{"createdAt": -1})
+
+	var snapshot model.PriceSnapshot
+	err := r.PriceHistoryCol.FindOne(ctx, bson.M{
+		"metadata.name":   name,
+		"metadata.market": market,
+		"createdAt":       bson.M{"$lte": at},
+	}, opts).Decode(&snapshot)
+	return &snapshot, err
+}
+
+// @return the price of the item on the market hours ago
+func (r *PriceHistoryRepository) GetPriceHoursAgo(name, market string, hours int) (*model.PriceSnapshot, error) {
+	return r.GetPriceAt(name, market, time.Now().Add(-time.Duration(hours)*time.Hour))
+}
+
+func (r *PriceHistoryRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.PriceHistoryCol.DeleteMany(ctx, bson.M{})
+	return err
+}
@@ -8,6 +8,13 @@ type RepoFactory interface {
 	GetTransactionRepository() *TransactionRepository
 	GetSubscriptionRepository() *SubscriptionRepository
 	GetUserRepository() *UserRepository
+	GetTokenRepository() *TokenRepository
+	GetLinkCodeRepository() *LinkCodeRepository
+	GetAnomalyRepository() *AnomalyRepository
+	GetStatsRepository() *StatsRepository
+	GetPriceHistoryRepository() *PriceHistoryRepository
+	GetItemAlertRepository() *ItemAlertRepository
+	GetPortfolioRepository() *PortfolioRepository
 }
 
 type Repositories struct {
@@ -18,13 +25,24 @@ type Repositories struct {
 	transactionRepo      *TransactionRepository
 	subscriptionRepo     *SubscriptionRepository
 	userRepo             *UserRepository
+	tokenRepo            *TokenRepository
+	linkCodeRepo         *LinkCodeRepository
+	anomalyRepo          *AnomalyRepository
+	statsRepo            *StatsRepository
+	priceHistoryRepo     *PriceHistoryRepository
+	itemAlertRepo        *ItemAlertRepository
+	portfolioRepo        *PortfolioRepository
 }
 
 type ChangeStreamHandlers struct {
 	ItemChangeStreamCallback         ChangeStreamCallback
 	ListingChangeStreamCallback      ChangeStreamCallback
+	ListingEventCallback             ChangeStreamCallback
 	TransactionChangeStreamCallback  ChangeStreamCallback
 	SubscriptionChangeStreamCallback ChangeStreamCallback
+	AnomalyChangeStreamCallback      ChangeStreamCallback
+	ItemAlertChangeStreamCallback    ChangeStreamCallback
+	UserChangeStreamCallback         ChangeStreamCallback
 }
 
 type ChangeStreamCallback func(data interface{}, operationType string)
@@ -44,6 +62,7 @@ func (r *Repositories) GetItemRepository() *ItemRepository {
 	if r.itemRepo == nil {
 		r.itemRepo = &ItemRepository{
 			ItemCol:              r.dbClient.DB.Collection("items"),
+			PriceHistory:         r.GetPriceHistoryRepository(),
 			ChangeStreamCallback: r.changeStreamHandlers.ItemChangeStreamCallback,
 		}
 	}
@@ -54,7 +73,9 @@ func (r *Repositories) GetListingRepository() *ListingRepository {
 	if r.listingRepo == nil {
 		r.listingRepo = &ListingRepository{
 			ListingCol:           r.dbClient.DB.Collection("listings"),
+			ArchiveCol:           r.dbClient.DB.Collection("listings_archive"),
 			ChangeStreamCallback: r.changeStreamHandlers.ListingChangeStreamCallback,
+			EventCallback:        r.changeStreamHandlers.ListingEventCallback,
 		}
 	}
 	return r.listingRepo
@@ -83,8 +104,80 @@ func (r *Repositories) GetSubscriptionRepository() *SubscriptionRepository {
 func (r *Repositories) GetUserRepository() *UserRepository {
 	if r.userRepo == nil {
 		r.userRepo = &UserRepository{
-			UserCol: r.dbClient.DB.Collection("users"),
+			UserCol:              r.dbClient.DB.Collection("users"),
+			SubRepo:              r.GetSubscriptionRepository(),
+			TokenRepo:            r.GetTokenRepository(),
+			ItemAlertRepo:        r.GetItemAlertRepository(),
+			PortfolioRepo:        r.GetPortfolioRepository(),
+			LinkCodeRepo:         r.GetLinkCodeRepository(),
+			ChangeStreamCallback: r.changeStreamHandlers.UserChangeStreamCallback,
 		}
 	}
 	return r.userRepo
 }
+
+func (r *Repositories) GetTokenRepository() *TokenRepository {
+	if r.tokenRepo == nil {
+		r.tokenRepo = &TokenRepository{
+			TokenCol: r.dbClient.DB.Collection("tokens"),
+		}
+	}
+	return r.tokenRepo
+}
+
+func (r *Repositories) GetLinkCodeRepository() *LinkCodeRepository {
+	if r.linkCodeRepo == nil {
+		r.linkCodeRepo = &LinkCodeRepository{
+			LinkCodeCol: r.dbClient.DB.Collection("link_codes"),
+		}
+	}
+	return r.linkCodeRepo
+}
+
+func (r *Repositories) GetAnomalyRepository() *AnomalyRepository {
+	if r.anomalyRepo == nil {
+		r.anomalyRepo = &AnomalyRepository{
+			AnomalyCol:           r.dbClient.DB.Collection("anomalies"),
+			ChangeStreamCallback: r.changeStreamHandlers.AnomalyChangeStreamCallback,
+		}
+	}
+	return r.anomalyRepo
+}
+
+func (r *Repositories) GetStatsRepository() *StatsRepository {
+	if r.statsRepo == nil {
+		r.statsRepo = &StatsRepository{
+			StatsCol: r.dbClient.DB.Collection("stats"),
+		}
+	}
+	return r.statsRepo
+}
+
+func (r *Repositories) GetPriceHistoryRepository() *PriceHistoryRepository {
+	if r.priceHistoryRepo == nil {
+		r.priceHistoryRepo = &PriceHistoryRepository{
+			PriceHistoryCol: r.dbClient.DB.Collection("price_history"),
+		}
+	}
+	return r.priceHistoryRepo
+}
+
+func (r *Repositories) GetItemAlertRepository() *ItemAlertRepository {
+	if r.itemAlertRepo == nil {
+		r.itemAlertRepo = &ItemAlertRepository{
+			ItemAlertCol:         r.dbClient.DB.Collection("item_alerts"),
+			ChangeStreamCallback: r.changeStreamHandlers.ItemAlertChangeStreamCallback,
+		}
+	}
+	return r.itemAlertRepo
+}
+
+func (r *Repositories) GetPortfolioRepository() *PortfolioRepository {
+	if r.portfolioRepo == nil {
+		r.portfolioRepo = &PortfolioRepository{
+			HoldingCol:  r.dbClient.DB.Collection("holdings"),
+			SnapshotCol: r.dbClient.DB.Collection("portfolio_snapshots"),
+		}
+	}
+	return r.portfolioRepo
+}
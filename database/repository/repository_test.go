@@ -1,15 +1,22 @@
 package repository_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/credentials"
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"github.com/mikezzb/steam-trading-shared/database/repository"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/mikezzb/steam-trading-shared/database"
 )
@@ -80,11 +87,22 @@ func TestItemRepository_UpdateItem(t *testing.T) {
 			},
 		}
 
+		// the stored item is notified, with the prices not in the upsert
+		var notified *model.Item
+		repo.ChangeStreamCallback = func(data interface{}, operationType string) {
+			notified = data.(*model.Item)
+		}
+		defer func() { repo.ChangeStreamCallback = nil }()
+
 		err = repo.UpsertItem(newItem)
 		if err != nil {
 			t.Error(err)
 		}
 
+		if notified == nil || notified.IgxePrice == nil || notified.SteamPrice == nil {
+			t.Errorf("Expected the upserted item notified, got %+v", notified)
+		}
+
 		// Get the item back
 		updatedItem, err = repo.FindItemByName(item.Name)
 		if err != nil {
@@ -388,6 +406,37 @@ func TestTransactionRepo_Insert(t *testing.T) {
 			t.Error(err)
 		}
 	})
+
+	t.Run("ReplaceSynthetic", func(t *testing.T) {
+		defer repo.DeleteAll()
+
+		synthetic := model.Transaction{
+			ID:        primitive.NewObjectID(),
+			Name:      "★ Bayonet | Doppler (Factory New)",
+			Price:     shared.GetDecimal128("1000"),
+			CreatedAt: time.Now(),
+			Metadata:  model.TransactionMetadata{AssetId: "789", Market: "buff", Synthetic: true},
+		}
+		if err := repo.InsertTransactions([]model.Transaction{synthetic}); err != nil {
+			t.Fatal(err)
+		}
+
+		scraped := synthetic
+		scraped.ID = primitive.NilObjectID
+		scraped.Price = shared.GetDecimal128("950")
+		scraped.Metadata.Synthetic = false
+		if err := repo.UpsertTransactionsByAssetID([]model.Transaction{scraped}); err != nil {
+			t.Fatal(err)
+		}
+
+		transactions, err := repo.FindTransactionsByAssetIds("buff", []string{"789"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 1 || transactions[0].Metadata.Synthetic || transactions[0].ID != synthetic.ID || transactions[0].Price.String() != "950" {
+			t.Errorf("Expected the scraped transaction with the synthetic id, got %+v", transactions)
+		}
+	})
 }
 
 func TestMongoID(t *testing.T) {
@@ -606,3 +655,1066 @@ func TestTransactionHistory(t *testing.T) {
 	})
 
 }
+
+func TestUserRepo_Lifecycle(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetUserRepository()
+	subRepo := repos.GetSubscriptionRepository()
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		userId, err := repo.InsertUser(&model.User{
+			Username: "test",
+			Email:    "test@test.com",
+			Role:     shared.USER_ROLE_USER,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// duplicate
+		if _, err := repo.InsertUser(&model.User{Username: "test"}); err != repository.ErrDuplicate {
+			t.Errorf("Expected duplicate error, got %v", err)
+		}
+
+		if err := repo.UpdateRole(userId, "superuser"); err != repository.ErrInvalidRole {
+			t.Errorf("Expected invalid role error, got %v", err)
+		}
+
+		if err := repo.UpdateRole(userId, shared.USER_ROLE_ADMIN); err != nil {
+			t.Error(err)
+		}
+
+		// favorite changes are notified
+		var favChanges []string
+		repo.ChangeStreamCallback = func(data interface{}, operationType string) {
+			favChanges = append(favChanges, operationType+" "+data.(*model.FavItemChange).ItemId)
+		}
+		defer func() { repo.ChangeStreamCallback = nil }()
+
+		// favorites shall be deduplicated
+		repo.AddFavItem(userId, "123")
+		repo.AddFavItem(userId, "123")
+		repo.AddFavItem(userId, "456")
+		repo.RemoveFavItem(userId, "456")
+
+		user, err := repo.GetUserById(userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(user.FavItemIds) != 1 || user.FavItemIds[0] != "123" {
+			t.Errorf("Expected fav items [123], got %v", user.FavItemIds)
+		}
+
+		if user.Role != shared.USER_ROLE_ADMIN {
+			t.Errorf("Role not updated: %v", user.Role)
+		}
+
+		// delete shall cascade to subscriptions, item alerts, portfolio & link codes
+		subRepo.InsertSubscription(&model.Subscription{
+			Name:       "★ Bayonet | Marble Fade (Factory New)",
+			MaxPremium: "5%",
+			OwnerId:    userId,
+		})
+		repos.GetItemAlertRepository().InsertItemAlert(&model.ItemAlert{
+			ItemId:    "123",
+			Type:      shared.ITEM_ALERT_TYPE_PRICE_BELOW,
+			Threshold: 100,
+			OwnerId:   userId,
+		})
+		repos.GetPortfolioRepository().InsertHolding(&model.Holding{
+			OwnerId:       userId,
+			Name:          "AK-47 | Redline (Field-Tested)",
+			PurchasePrice: shared.GetDecimal128("100"),
+		})
+		repos.GetLinkCodeRepository().IssueLinkCode(userId, shared.NOTI_TYPE_TELEGRAM)
+
+		if err := repo.DeleteUser(userId); err != nil {
+			t.Error(err)
+		}
+
+		if strings.Join(favChanges, ",") != "insert 123,insert 123,insert 456,delete 456,delete 123" {
+			t.Errorf("Unexpected favorite changes: %v", favChanges)
+		}
+
+		subs, _ := subRepo.GetAllByOwnerId(userId)
+		if len(subs) != 0 {
+			t.Errorf("Expected subscriptions to be deleted, got %v", len(subs))
+		}
+
+		alerts, _ := repos.GetItemAlertRepository().GetItemAlertsByOwnerId(userId)
+		holdings, _ := repos.GetPortfolioRepository().GetHoldingsByOwnerId(userId)
+		if len(alerts) != 0 || len(holdings) != 0 {
+			t.Errorf("Expected item alerts & holdings to be deleted, got %v, %v", len(alerts), len(holdings))
+		}
+		if count, _ := db.DB.Collection("link_codes").CountDocuments(context.Background(), bson.M{"userId": userId}); count != 0 {
+			t.Errorf("Expected link codes to be deleted, got %v", count)
+		}
+
+		if _, err := repo.GetUserById(userId); err == nil {
+			t.Errorf("User not deleted: %v", userId)
+		}
+	})
+}
+
+func TestUserRepo_Authenticate(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetUserRepository()
+
+	t.Run("Authenticate", func(t *testing.T) {
+		userId, err := repo.InsertUser(&model.User{
+			Username: "auth",
+			Email:    "auth@test.com",
+			Password: "secret",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repo.GetUserById(userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user.Password == "secret" {
+			t.Errorf("Password stored in plain text")
+		}
+
+		if _, err := repo.Authenticate("auth@test.com", "wrong"); err != credentials.ErrInvalidCredentials {
+			t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+		}
+
+		if _, err := repo.Authenticate("auth@test.com", "secret"); err != nil {
+			t.Errorf("Failed to authenticate: %v", err)
+		}
+
+		// hash shall never be serialized
+		b, _ := json.Marshal(user)
+		if strings.Contains(string(b), "password") {
+			t.Errorf("Password serialized to JSON: %s", b)
+		}
+
+		// a hash submitted as the password is hashed again
+		hash, err := credentials.HashPassword("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertUser(&model.User{
+			Username: "hashed",
+			Email:    "hashed@test.com",
+			Password: hash,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repo.Authenticate("hashed@test.com", "secret"); err != credentials.ErrInvalidCredentials {
+			t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+		}
+
+		if _, err := repo.Authenticate("hashed@test.com", hash); err != nil {
+			t.Errorf("Failed to authenticate with the submitted password: %v", err)
+		}
+
+		repo.DeleteAll()
+	})
+}
+
+func TestTokenRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetTokenRepository()
+
+	t.Run("IssueValidateRevoke", func(t *testing.T) {
+		userId := primitive.NewObjectID()
+
+		if _, _, err := repo.IssueToken(userId, shared.TOKEN_TYPE_API, "bot", []string{"root"}, 0); err != repository.ErrInvalidScope {
+			t.Errorf("Expected ErrInvalidScope, got %v", err)
+		}
+
+		if _, _, err := repo.IssueToken(userId, "refresh", "bot", nil, 0); err != repository.ErrInvalidTokenType {
+			t.Errorf("Expected ErrInvalidTokenType, got %v", err)
+		}
+
+		rawToken, token, err := repo.IssueToken(userId, shared.TOKEN_TYPE_API, "bot", []string{shared.TOKEN_SCOPE_READ_LISTINGS}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.Hash == rawToken {
+			t.Errorf("Token stored in plain text")
+		}
+
+		validated, err := repo.ValidateToken(rawToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !shared.TokenHasScope(validated, shared.TOKEN_SCOPE_READ_LISTINGS) || shared.TokenHasScope(validated, shared.TOKEN_SCOPE_ADMIN) {
+			t.Errorf("Unexpected scopes: %v", validated.Scopes)
+		}
+
+		// expired session
+		expiredToken, _, err := repo.IssueToken(userId, shared.TOKEN_TYPE_SESSION, "", nil, time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if _, err := repo.ValidateToken(expiredToken); err != repository.ErrInvalidToken {
+			t.Errorf("Expected ErrInvalidToken, got %v", err)
+		}
+
+		if err := repo.RevokeToken(token.ID, userId); err != nil {
+			t.Error(err)
+		}
+
+		if _, err := repo.ValidateToken(rawToken); err != repository.ErrInvalidToken {
+			t.Errorf("Expected revoked token to be invalid, got %v", err)
+		}
+
+		repo.DeleteAll()
+	})
+}
+
+func TestLinkCodeRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetLinkCodeRepository()
+	userRepo := repos.GetUserRepository()
+
+	t.Run("LinkTelegram", func(t *testing.T) {
+		userId, err := userRepo.InsertUser(&model.User{Username: "link", Email: "link@test.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		linkCode, err := repo.IssueLinkCode(userId, shared.NOTI_TYPE_TELEGRAM)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		consumed, err := repo.ConsumeLinkCode(linkCode.Code, shared.NOTI_TYPE_TELEGRAM)
+		if err != nil || consumed.UserId != userId {
+			t.Fatalf("Failed to consume link code: %v", err)
+		}
+
+		// one-time only
+		if _, err := repo.ConsumeLinkCode(linkCode.Code, shared.NOTI_TYPE_TELEGRAM); err != repository.ErrInvalidLinkCode {
+			t.Errorf("Expected ErrInvalidLinkCode, got %v", err)
+		}
+
+		channel := &model.LinkedChannel{Type: shared.NOTI_TYPE_TELEGRAM, NotiId: "123"}
+		if err := userRepo.AddLinkedChannel(userId, channel); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := userRepo.GetUserByLinkedChannel(shared.NOTI_TYPE_TELEGRAM, "123")
+		if err != nil || user.ID != userId {
+			t.Errorf("Failed to find user by linked channel: %v", err)
+		}
+
+		linked, err := userRepo.GetLinkedChannel(userId, channel.ID)
+		if err != nil || linked.NotiId != "123" {
+			t.Errorf("Failed to get linked channel: %v", err)
+		}
+
+		repo.DeleteAll()
+		userRepo.DeleteAll()
+	})
+}
+
+func TestSubscriptions_Expiry(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetSubscriptionRepository()
+
+	t.Run("Expiry", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		ownerId := primitive.NewObjectID()
+		subs := []model.Subscription{
+			{Name: "active", MaxPremium: "5%", OwnerId: ownerId},
+			{Name: "paused", MaxPremium: "5%", OwnerId: ownerId, Disabled: true},
+			{Name: "expired", MaxPremium: "5%", OwnerId: ownerId, ExpiresAt: &past},
+			{Name: "exhausted", MaxPremium: "5%", OwnerId: ownerId, MaxNotifications: 1},
+		}
+		for i := range subs {
+			id, err := repo.InsertSubscription(&subs[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			subs[i].ID = id
+		}
+
+		if _, err := repo.IncrementNotificationCount(subs[3].ID); err != nil {
+			t.Error(err)
+		}
+
+		active, err := repo.GetAllActive()
+		if err != nil {
+			t.Error(err)
+		}
+		if len(active) != 1 || active[0].Name != "active" {
+			t.Errorf("Expected only the active subscription, got %v", active)
+		}
+
+		deleted, err := repo.DeleteExpiredSubscriptions()
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 2 {
+			t.Errorf("Expected 2 expired subscriptions, got %v", len(deleted))
+		}
+
+		repo.DeleteAll()
+	})
+}
+
+func TestListingRepo_Phase(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetListingRepository()
+
+	t.Run("BestPricesByPhase", func(t *testing.T) {
+		defer shared.SetRateProvider(shared.GetRateProvider())
+		shared.SetRateProvider(shared.NewStaticRateProvider(shared.CURRENCY_USD, map[string]float64{shared.CURRENCY_CNY: 7}))
+
+		name := "★ Karambit | Doppler (Factory New)"
+		listings := []model.Listing{
+			{Name: name, AssetId: "1", PaintIndex: 415, Price: shared.GetDecimal128("30000"), CheckedAt: time.Now()},
+			{Name: name, AssetId: "2", PaintIndex: 419, Price: shared.GetDecimal128("9000"), CheckedAt: time.Now()},
+			{Name: name, AssetId: "3", PaintIndex: 419, Price: shared.GetDecimal128("8500"), CheckedAt: time.Now()},
+			// $1300 = ¥9100, lowest raw number but not the best price
+			{Name: name, AssetId: "4", Market: shared.MARKET_NAME_STEAM, PaintIndex: 419, Price: shared.GetDecimal128("1300"), CheckedAt: time.Now()},
+		}
+
+		if err := repo.InsertListings(listings); err != nil {
+			t.Fatal(err)
+		}
+
+		prices, err := repo.GetBestPricesByPhase(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if prices[shared.PHASE_RUBY] != 30000 || prices[shared.PHASE_2] != 8500 {
+			t.Errorf("Unexpected phase prices: %v", prices)
+		}
+
+		best, err := repo.GetBestListingByPhase(name, shared.PHASE_2)
+		if err != nil || best.AssetId != "3" {
+			t.Errorf("Unexpected best listing: %v, %v", best, err)
+		}
+
+		repo.DeleteAll()
+	})
+}
+
+func TestListingRepo_Discount(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetListingRepository()
+
+	name := "AK-47 | Redline (Field-Tested)"
+	listings := []model.Listing{
+		{Name: name, AssetId: "1", Price: shared.GetDecimal128("90"), CheckedAt: time.Now()},
+		{Name: name, AssetId: "2", Price: shared.GetDecimal128("70"), CheckedAt: time.Now()},
+		{Name: name, AssetId: "3", Price: shared.GetDecimal128("50"), CheckedAt: time.Now()},
+	}
+	if err := repo.InsertListings(listings); err != nil {
+		t.Fatal(err)
+	}
+
+	// score the first two only
+	var scored []model.Listing
+	for _, assetId := range []string{"1", "2"} {
+		listing, err := repo.FindOneListing(bson.M{"assetId": assetId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listing.FairValue = 100
+		listing.Discount = 1 - shared.DecToFloat(listing.Price)/100
+		scored = append(scored, *listing)
+	}
+	if err := repo.UpdateListingScores(scored); err != nil {
+		t.Fatal(err)
+	}
+
+	ranked, err := repo.GetListingsByDiscount(1, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranked) != 2 || ranked[0].AssetId != "2" || ranked[1].AssetId != "1" {
+		t.Errorf("Unexpected ranking: %v", ranked)
+	}
+
+	repo.DeleteAll()
+}
+
+func TestAnomalyRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetAnomalyRepository()
+
+	anomaly := &model.Anomaly{
+		Name:   "AK-47 | Redline (Field-Tested)",
+		Market: shared.MARKET_NAME_BUFF,
+		Type:   shared.ANOMALY_TYPE_PRICE_SPIKE,
+		Value:  150,
+	}
+	if _, err := repo.InsertAnomaly(anomaly); err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := repo.ExistsSince(anomaly, time.Now().Add(-time.Hour))
+	if err != nil || !exists {
+		t.Errorf("Expected the anomaly to exist, got %v, %v", exists, err)
+	}
+
+	other := *anomaly
+	other.Type = shared.ANOMALY_TYPE_PRICE_DROP
+	if exists, _ := repo.ExistsSince(&other, time.Now().Add(-time.Hour)); exists {
+		t.Errorf("Expected no anomaly of another type")
+	}
+
+	anomalies, err := repo.GetAnomaliesByItemName(anomaly.Name, time.Now().Add(-time.Hour))
+	if err != nil || len(anomalies) != 1 {
+		t.Errorf("Expected 1 anomaly, got %v, %v", anomalies, err)
+	}
+
+	repo.DeleteAll()
+}
+
+func TestStatsRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetStatsRepository()
+
+	stats := &model.ItemStats{
+		Name:        "AK-47 | Redline (Field-Tested)",
+		Market:      shared.MARKET_NAME_BUFF,
+		DailyCounts: map[string]int64{"2024-05-01": 3},
+		DailySales:  3,
+	}
+	if err := repo.UpsertStats(stats); err != nil {
+		t.Fatal(err)
+	}
+
+	// upsert again by name & market
+	stats.DailySales = 5
+	if err := repo.UpsertStats(stats); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := repo.GetStatsByItemName(stats.Name)
+	if err != nil || len(all) != 1 || all[0].DailySales != 5 {
+		t.Errorf("Expected 1 updated stats, got %v, %v", all, err)
+	}
+
+	if _, err := repo.GetStats(stats.Name, shared.MARKET_NAME_UU); err != mongo.ErrNoDocuments {
+		t.Errorf("Expected no stats on uu, got %v", err)
+	}
+
+	repo.DeleteAll()
+}
+
+func TestListingRepo_Removal(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetListingRepository()
+
+	name := "AK-47 | Redline (Field-Tested)"
+	listing := model.Listing{Name: name, Market: shared.MARKET_NAME_BUFF, AssetId: "1", Price: shared.GetDecimal128("100"), CheckedAt: time.Now()}
+	if _, err := repo.UpsertListingsByAssetID([]model.Listing{listing}); err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := repo.FindActiveListings(name, shared.MARKET_NAME_BUFF)
+	if err != nil || len(active) != 1 {
+		t.Fatalf("Expected 1 active listing, got %v, %v", active, err)
+	}
+
+	removedAt := time.Now()
+	active[0].Status = shared.LISTING_STATUS_DELISTED
+	active[0].RemovedAt = &removedAt
+	if err := repo.MarkListingsRemoved(active); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := repo.Count(bson.M{"name": name}); count != 0 {
+		t.Errorf("Expected the removed listing hidden, got %d", count)
+	}
+	if count, _ := repo.Count(bson.M{"name": name, "status": shared.LISTING_STATUS_DELISTED}); count != 1 {
+		t.Errorf("Expected 1 delisted listing, got %d", count)
+	}
+
+	// relisted
+	if _, err := repo.UpsertListingsByAssetID([]model.Listing{listing}); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := repo.Count(bson.M{"name": name}); count != 1 {
+		t.Errorf("Expected the relisted listing active, got %d", count)
+	}
+
+	repo.DeleteAll()
+}
+
+func TestListingRepo_Staleness(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetListingRepository()
+
+	now := time.Now()
+	policy := shared.GetStalenessPolicy(shared.MARKET_NAME_BUFF)
+	name := "AK-47 | Redline (Field-Tested)"
+	listings := []model.Listing{
+		{Name: name, Market: shared.MARKET_NAME_BUFF, AssetId: "1", Price: shared.GetDecimal128("100"), CheckedAt: now},
+		// stale, kept
+		{Name: name, Market: shared.MARKET_NAME_BUFF, AssetId: "2", Price: shared.GetDecimal128("90"), CheckedAt: now.Add(-policy.MaxAge - time.Minute)},
+		// stale, removed by the cleanup
+		{Name: name, Market: shared.MARKET_NAME_BUFF, AssetId: "3", Price: shared.GetDecimal128("80"), CheckedAt: now.Add(-policy.RemoveAfter - time.Minute)},
+	}
+	if err := repo.InsertListings(listings); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := repo.Count(bson.M{"name": name}); count != 1 {
+		t.Errorf("Expected the stale listings hidden, got %d", count)
+	}
+	best, err := repo.GetBestListing(name, shared.MARKET_NAME_BUFF)
+	if err != nil || best.AssetId != "1" {
+		t.Errorf("Expected the fresh listing as best, got %v, %v", best, err)
+	}
+
+	counts, err := repo.CountListingFreshness(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freshness := counts[shared.MARKET_NAME_BUFF]; freshness.Fresh != 1 || freshness.Stale != 2 {
+		t.Errorf("Unexpected freshness: %v", freshness)
+	}
+
+	archived, deleted, err := repo.CleanupStaleListings(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 1 || deleted != 0 {
+		t.Errorf("Expected 1 archived listing, got %d archived, %d deleted", archived, deleted)
+	}
+	if count, _ := repo.ArchiveCol.CountDocuments(context.Background(), bson.M{"assetId": "3"}); count != 1 {
+		t.Errorf("Expected the listing in the archive, got %d", count)
+	}
+
+	repo.DeleteAll()
+	repo.ArchiveCol.DeleteMany(context.Background(), bson.M{})
+}
+
+func TestListingRepo_Events(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetListingRepository()
+
+	name := "AK-47 | Redline (Field-Tested)"
+	listing := model.Listing{Name: name, Market: shared.MARKET_NAME_BUFF, AssetId: "1", Price: shared.GetDecimal128("100"), CheckedAt: time.Now()}
+
+	upsert := func(listing model.Listing) []model.ListingEvent {
+		events, err := repo.UpsertListingEvents([]model.Listing{listing})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	// the changed listings & the events are notified apart
+	var updated, notifiedEvents []string
+	repo.ChangeStreamCallback = func(data interface{}, operationType string) {
+		updated = append(updated, operationType+" "+data.(*model.Listing).AssetId)
+	}
+	repo.EventCallback = func(data interface{}, operationType string) {
+		notifiedEvents = append(notifiedEvents, operationType)
+	}
+	defer func() { repo.ChangeStreamCallback, repo.EventCallback = nil, nil }()
+
+	if events := upsert(listing); len(events) != 1 || events[0].Type != shared.LISTING_EVENT_NEW {
+		t.Errorf("Expected a new listing event, got %v", events)
+	}
+	if events := upsert(listing); len(events) != 0 {
+		t.Errorf("Expected no event for the same price, got %v", events)
+	}
+	if len(updated) != 1 || updated[0] != "update 1" || len(notifiedEvents) != 1 || notifiedEvents[0] != shared.LISTING_EVENT_NEW {
+		t.Errorf("Expected the new listing notified once, got %v, %v", updated, notifiedEvents)
+	}
+
+	listing.Price = shared.GetDecimal128("90")
+	events := upsert(listing)
+	if len(events) != 1 || events[0].Type != shared.LISTING_EVENT_PRICE_DROP || events[0].Previous.Price.String() != "100" {
+		t.Errorf("Expected a price drop from 100, got %v", events)
+	}
+
+	listing.Market = shared.MARKET_NAME_UU
+	if events := upsert(listing); len(events) != 1 || events[0].Type != shared.LISTING_EVENT_RELISTED || events[0].Previous.Market != shared.MARKET_NAME_BUFF {
+		t.Errorf("Expected a relisted event from buff, got %v", events)
+	}
+
+	repo.DeleteAll()
+}
+
+func TestGetListingUpsertBson(t *testing.T) {
+	unset := repository.GetListingUpsertBson(&model.Listing{AssetId: "1"})["$unset"].(bson.M)
+	if _, ok := unset["fairValue"]; !ok {
+		t.Errorf("Expected the score of the unscored listing unset, got %v", unset)
+	}
+	if _, ok := repository.LISTING_REMOVAL_FIELDS["fairValue"]; ok {
+		t.Errorf("Expected the removal fields unchanged")
+	}
+
+	unset = repository.GetListingUpsertBson(&model.Listing{AssetId: "1", FairValue: 100, Discount: 0.1})["$unset"].(bson.M)
+	if _, ok := unset["fairValue"]; ok {
+		t.Errorf("Expected the score of the scored listing kept, got %v", unset)
+	}
+}
+
+func TestAddVisibleListingFilter(t *testing.T) {
+	now := time.Now()
+
+	filters := bson.M{"name": "AK-47 | Redline (Field-Tested)"}
+	visible, err := repository.AddVisibleListingFilter(filters, now)
+	if err != nil || visible["status"] == nil || visible["$or"] == nil {
+		t.Errorf("Expected the active & fresh filters, got %v, %v", visible, err)
+	}
+	if len(filters) != 1 {
+		t.Errorf("Expected the filters of the caller unchanged, got %v", filters)
+	}
+
+	// the $and of the caller is kept
+	filters = bson.M{
+		"$or":  bson.A{bson.M{"market": "buff"}, bson.M{"market": "uu"}},
+		"$and": []bson.M{{"price": bson.M{"$gt": 10}}},
+	}
+	visible, err = repository.AddVisibleListingFilter(filters, now)
+	if and, ok := visible["$and"].(bson.A); err != nil || !ok || len(and) != 2 {
+		t.Errorf("Expected the $and of the caller & the fresh filter, got %v, %v", visible["$and"], err)
+	}
+	if len(filters["$and"].([]bson.M)) != 1 {
+		t.Errorf("Expected the $and of the caller unchanged, got %v", filters["$and"])
+	}
+
+	if _, err := repository.AddVisibleListingFilter(bson.M{"$or": bson.A{}, "$and": "invalid"}, now); err == nil {
+		t.Errorf("Expected error for an invalid $and")
+	}
+}
+
+func TestIsListingModified(t *testing.T) {
+	previous := &model.Listing{
+		ID:        primitive.NewObjectID(),
+		Name:      "AK-47 | Redline (Field-Tested)",
+		Market:    shared.MARKET_NAME_BUFF,
+		AssetId:   "1",
+		Price:     shared.GetDecimal128("100"),
+		FairValue: 120,
+		CheckedAt: time.Now().Add(-time.Hour),
+	}
+
+	// rescraped, the scores are not set by the scrapers
+	listing := *previous
+	listing.ID = primitive.NilObjectID
+	listing.FairValue = 0
+	listing.CheckedAt = time.Now()
+	if modified, err := repository.IsListingModified(previous, &listing); err != nil || modified {
+		t.Errorf("Expected unmodified, got %v, %v", modified, err)
+	}
+
+	listing.Price = shared.GetDecimal128("90")
+	if modified, _ := repository.IsListingModified(previous, &listing); !modified {
+		t.Error("Expected the price change modified")
+	}
+
+	listing.Price = previous.Price
+	removed := *previous
+	removed.Status = shared.LISTING_STATUS_DELISTED
+	if modified, _ := repository.IsListingModified(&removed, &listing); !modified {
+		t.Error("Expected the relisted listing modified")
+	}
+}
+
+func newBulkListings(n int, market string) []model.Listing {
+	listings := make([]model.Listing, n)
+	for i := range listings {
+		listings[i] = model.Listing{
+			Name:      "AK-47 | Redline (Field-Tested)",
+			Market:    market,
+			AssetId:   strconv.Itoa(i),
+			Price:     shared.GetDecimal128("100"),
+			CheckedAt: time.Now(),
+		}
+	}
+	return listings
+}
+
+func TestListingRepo_BulkUpsert(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetListingRepository()
+
+	// more than a chunk
+	n := repository.LISTING_CHUNK_SIZE + 10
+	listings := newBulkListings(n, shared.MARKET_NAME_BUFF)
+	result, err := repo.BulkUpsertListings(listings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Inserted()) != n || len(result.Modified()) != 0 {
+		t.Errorf("Expected %d inserted, got %d inserted, %d modified", n, len(result.Inserted()), len(result.Modified()))
+	}
+
+	// same assets on another market are not overwritten
+	if _, err := repo.BulkUpsertListings(newBulkListings(1, shared.MARKET_NAME_UU)); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := repo.Count(bson.M{"assetId": "0"}); count != 2 {
+		t.Errorf("Expected the asset on 2 markets, got %d", count)
+	}
+
+	// one price change, the rest rescraped
+	listings[1].Price = shared.GetDecimal128("90")
+	result, err = repo.BulkUpsertListings(listings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := result.Modified()
+	if len(result.Inserted()) != 0 || len(modified) != 1 {
+		t.Fatalf("Expected 1 modified, got %d inserted, %d modified", len(result.Inserted()), len(modified))
+	}
+	if modified[0].Listing.AssetId != "1" || modified[0].Previous.Price.String() != "100" {
+		t.Errorf("Unexpected change: %v", modified[0])
+	}
+
+	repo.DeleteAll()
+}
+
+func BenchmarkListingRepo_BulkUpsert(b *testing.B) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	repo := repos.GetListingRepository()
+	listings := newBulkListings(2000, shared.MARKET_NAME_BUFF)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.BulkUpsertListings(listings); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	repo.DeleteAll()
+}
+
+func BenchmarkIsListingModified(b *testing.B) {
+	previous := &newBulkListings(1, shared.MARKET_NAME_BUFF)[0]
+	listing := *previous
+	listing.CheckedAt = time.Now()
+
+	for i := 0; i < b.N; i++ {
+		repository.IsListingModified(previous, &listing)
+	}
+}
+
+func TestGetPriceSnapshots(t *testing.T) {
+	now := time.Now()
+	updatedAt := now.Add(-time.Minute)
+	oldItem := &model.Item{
+		Name:      "AK-47 | Redline (Field-Tested)",
+		BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128("100"), UpdatedAt: updatedAt},
+		UUPrice:   &model.MarketPrice{Price: shared.GetDecimal128("105"), UpdatedAt: updatedAt},
+	}
+	item := &model.Item{
+		Name:       oldItem.Name,
+		BuffPrice:  &model.MarketPrice{Price: shared.GetDecimal128("100"), UpdatedAt: now},
+		UUPrice:    &model.MarketPrice{Price: shared.GetDecimal128("98"), UpdatedAt: now},
+		SteamPrice: &model.MarketPrice{Price: shared.GetDecimal128("15"), Currency: shared.CURRENCY_USD},
+	}
+
+	snapshots := repository.GetPriceSnapshots(oldItem, item, now)
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected the uu & steam snapshots, got %v", snapshots)
+	}
+	for _, snapshot := range snapshots {
+		switch snapshot.Metadata.Market {
+		case shared.MARKET_NAME_UU:
+			if snapshot.Price.String() != "98" || !snapshot.CreatedAt.Equal(now) {
+				t.Errorf("Unexpected uu snapshot: %v", snapshot)
+			}
+		case shared.MARKET_NAME_STEAM:
+			if snapshot.Currency != shared.CURRENCY_USD || !snapshot.CreatedAt.Equal(now) {
+				t.Errorf("Unexpected steam snapshot: %v", snapshot)
+			}
+		default:
+			t.Errorf("Unexpected snapshot of %s", snapshot.Metadata.Market)
+		}
+	}
+}
+
+func TestPriceHistoryRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	itemRepo := repos.GetItemRepository()
+	historyRepo := repos.GetPriceHistoryRepository()
+
+	name := "AK-47 | Redline (Field-Tested)"
+	now := time.Now()
+	for i, price := range []string{"100", "95", "90"} {
+		item := &model.Item{
+			ID:        "price-history-test",
+			Name:      name,
+			BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128(price), UpdatedAt: now.Add(time.Duration(i-2) * time.Hour)},
+		}
+		if err := itemRepo.UpsertItem(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := historyRepo.GetPriceHistory(name, shared.MARKET_NAME_BUFF, now.Add(-3*time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Price.String() != "100" {
+		t.Errorf("Unexpected history: %v", history)
+	}
+
+	snapshot, err := historyRepo.GetPriceHoursAgo(name, shared.MARKET_NAME_BUFF, 1)
+	if err != nil || snapshot.Price.String() != "95" {
+		t.Errorf("Expected the price an hour ago 95, got %v, %v", snapshot, err)
+	}
+
+	itemRepo.DeleteAll()
+	historyRepo.DeleteAll()
+}
+
+func TestItemRepo_SetMarketPrice(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetItemRepository()
+
+	id := "set-market-price-test"
+	now := time.Now()
+	update := repository.MarketPriceUpdate{
+		ItemId: id,
+		Name:   "AK-47 | Redline (Field-Tested)",
+		Market: shared.MARKET_NAME_BUFF,
+		Price:  model.MarketPrice{Price: shared.GetDecimal128("100"), UpdatedAt: now},
+	}
+	if item, err := repo.SetMarketPrice(update); err != nil || item == nil || item.BuffPrice.Price.String() != "100" {
+		t.Fatalf("Expected the item created with the price, got %v, %v", item, err)
+	}
+
+	// an older scrape does not revert the price
+	update.Price = model.MarketPrice{Price: shared.GetDecimal128("120"), UpdatedAt: now.Add(-time.Minute)}
+	if item, err := repo.SetMarketPrice(update); err != nil || item != nil {
+		t.Errorf("Expected the older price ignored, got %v, %v", item, err)
+	}
+
+	// a newer scrape of the same price is set without a snapshot
+	update.Price = model.MarketPrice{Price: shared.GetDecimal128("100"), UpdatedAt: now.Add(time.Minute)}
+	if item, err := repo.SetMarketPrice(update); err != nil || item == nil {
+		t.Errorf("Expected the newer scrape set, got %v, %v", item, err)
+	}
+	history, err := repos.GetPriceHistoryRepository().GetPriceHistory(update.Name, shared.MARKET_NAME_BUFF, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil || len(history) != 1 {
+		t.Errorf("Expected 1 snapshot of the unchanged price, got %v, %v", history, err)
+	}
+
+	// other markets are set in bulk without touching buff
+	items, err := repo.BulkSetMarketPrices([]repository.MarketPriceUpdate{
+		{ItemId: id, Market: shared.MARKET_NAME_UU, Price: model.MarketPrice{Price: shared.GetDecimal128("98"), UpdatedAt: now}},
+		{ItemId: id, Market: shared.MARKET_NAME_BUFF, Price: model.MarketPrice{Price: shared.GetDecimal128("80"), UpdatedAt: now.Add(-time.Hour)}},
+	})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected 1 updated item, got %v, %v", items, err)
+	}
+	if items[0].UUPrice.Price.String() != "98" || items[0].BuffPrice.Price.String() != "100" {
+		t.Errorf("Unexpected prices: %v, %v", items[0].UUPrice, items[0].BuffPrice)
+	}
+
+	repo.DeleteAll()
+	repos.GetPriceHistoryRepository().DeleteAll()
+}
+
+func TestItemAlertRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetItemAlertRepository()
+
+	ownerId := primitive.NewObjectID()
+	alert := &model.ItemAlert{
+		ItemId:    "alert-test",
+		Name:      "AK-47 | Redline (Field-Tested)",
+		Type:      shared.ITEM_ALERT_TYPE_PRICE_BELOW,
+		Threshold: 100,
+		OwnerId:   ownerId,
+	}
+	if _, err := repo.InsertItemAlert(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	invalidAlerts := []model.ItemAlert{
+		{Type: "priceAround", Threshold: 100},
+		{Type: shared.ITEM_ALERT_TYPE_PRICE_ABOVE},
+		{Type: shared.ITEM_ALERT_TYPE_PRICE_MOVE},
+		{Type: shared.ITEM_ALERT_TYPE_CHEAPEST_MARKET, Market: "unknown"},
+	}
+	for _, invalid := range invalidAlerts {
+		if _, err := repo.InsertItemAlert(&invalid); !errors.Is(err, repository.ErrInvalidItemAlert) {
+			t.Errorf("Expected ErrInvalidItemAlert of %+v, got %v", invalid, err)
+		}
+	}
+
+	triggeredAt := time.Now()
+	alert.LastPrice, alert.LastTriggeredAt = 95, &triggeredAt
+	if err := repo.UpdateItemAlertState(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := repo.GetItemAlertsByItemId("alert-test")
+	if err != nil || len(alerts) != 1 || alerts[0].LastPrice != 95 || alerts[0].LastTriggeredAt == nil {
+		t.Errorf("Expected the alert with its state, got %v, %v", alerts, err)
+	}
+
+	if _, err := repo.SetItemAlertDisabled(alert.ID, ownerId, true); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := repo.GetAllActive(); len(active) != 0 {
+		t.Errorf("Expected no active alert, got %v", active)
+	}
+
+	if err := repo.DeleteItemAlertById(alert.ID, ownerId); err != nil {
+		t.Fatal(err)
+	}
+	repo.DeleteAll()
+}
+
+func TestPortfolioRepo(t *testing.T) {
+	db, repos, err := RepoInit()
+	defer db.Disconnect()
+	if err != nil {
+		t.Error(err)
+	}
+
+	repo := repos.GetPortfolioRepository()
+
+	ownerId := primitive.NewObjectID()
+	holdings := []model.Holding{
+		{OwnerId: ownerId, AssetId: "1", Name: "AK-47 | Redline (Field-Tested)", PurchasePrice: shared.GetDecimal128("100"), PurchaseMarket: shared.MARKET_NAME_BUFF},
+		{OwnerId: ownerId, Name: "AWP | Asiimov (Field-Tested)", PurchasePrice: shared.GetDecimal128("300")},
+	}
+	if err := repo.UpsertHoldingsByAssetId(holdings); err != nil {
+		t.Fatal(err)
+	}
+	// upserted again by asset id
+	holdings[0].PurchasePrice = shared.GetDecimal128("90")
+	if err := repo.UpsertHoldingsByAssetId(holdings[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetHoldingsByOwnerId(ownerId)
+	if err != nil || len(saved) != 2 {
+		t.Fatalf("Expected 2 holdings, got %v, %v", saved, err)
+	}
+	var held *model.Holding
+	for i := range saved {
+		if saved[i].AssetId == "1" {
+			held = &saved[i]
+		}
+	}
+	if held == nil || held.PurchasePrice.String() != "90" || held.CreatedAt.IsZero() {
+		t.Fatalf("Expected the upserted holding, got %v", held)
+	}
+
+	sold, err := repo.MarkHoldingSold(held.ID, ownerId, shared.GetDecimal128("120"), "", shared.MARKET_NAME_BUFF, time.Now())
+	if err != nil || sold.SoldAt == nil || sold.SalePrice == nil {
+		t.Errorf("Expected the sold holding, got %v, %v", sold, err)
+	}
+	if held, _ := repo.GetHeldByOwnerId(ownerId); len(held) != 1 {
+		t.Errorf("Expected 1 held holding, got %v", held)
+	}
+
+	snapshot := &model.PortfolioSnapshot{OwnerId: ownerId, Cost: 300, Holdings: 1}
+	if err := repo.InsertSnapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, err := repo.GetSnapshots(ownerId, time.Now().Add(-time.Hour)); err != nil || len(snapshots) != 1 {
+		t.Errorf("Expected 1 snapshot, got %v, %v", snapshots, err)
+	}
+
+	if err := repo.DeleteHoldingById(held.ID, primitive.NewObjectID()); err == nil {
+		t.Errorf("Expected no holding of another owner")
+	}
+	repo.DeleteAll()
+}
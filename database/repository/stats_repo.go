@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StatsRepository struct {
+	StatsCol *mongo.Collection
+}
+
+// @return stats of the item on the market, mongo.ErrNoDocuments if never computed
+func (r *StatsRepository) GetStats(name, market string) (*model.ItemStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	var stats model.ItemStats
+	err := r.StatsCol.FindOne(ctx, bson.M{"name": name, "market": market}).Decode(&stats)
+	return &stats, err
+}
+
+// @return stats of the item on all markets
+func (r *StatsRepository) GetStatsByItemName(name string) ([]model.ItemStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.StatsCol.Find(ctx, bson.M{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []model.ItemStats
+	err = cursor.All(ctx, &stats)
+	return stats, err
+}
+
+// GetStatsByPage returns the most liquid items first
+func (r *StatsRepository) GetStatsByPage(page, pageSize int, filters bson.M) ([]model.ItemStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	opts := GetPageOpts(page, pageSize)
+	opts.SetSort(bson.M{"dailySales": -1})
+
+	cursor, err := r.StatsCol.Find(ctx, filters, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []model.ItemStats
+	err = cursor.All(ctx, &stats)
+	return stats, err
+}
+
+// Upsert the stats by item name & market
+func (r *StatsRepository) UpsertStats(stats *model.ItemStats) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	stats.UpdatedAt = time.Now()
+
+	// _id is kept on update
+	doc, err := bson.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(doc, &set); err != nil {
+		return err
+	}
+	delete(set, "_id")
+
+	opts := options.Update().SetUpsert(true)
+	_, err = r.StatsCol.UpdateOne(ctx,
+		bson.M{"name": stats.Name, "market": stats.Market},
+		bson.M{"$set": set},
+		opts,
+	)
+	return err
+}
+
+func (r *StatsRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.StatsCol.DeleteMany(ctx, bson.M{})
+	return err
+}
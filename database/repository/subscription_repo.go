@@ -2,11 +2,13 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SubscriptionRepository struct {
@@ -63,11 +65,57 @@ func (r *SubscriptionRepository) GetSubscriptions(filter bson.M) ([]model.Subscr
 	return subscriptions, err
 }
 
+// Filter of subscriptions that are enabled, not expired and below the max notifications
+func GetActiveSubscriptionFilter(now time.Time) bson.M {
+	return bson.M{
+		"disabled": bson.M{"$ne": true},
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"expiresAt": bson.M{"$exists": false}},
+				{"expiresAt": bson.M{"$gt": now}},
+			}},
+			{"$or": []bson.M{
+				{"maxNotifications": bson.M{"$exists": false}},
+				{"maxNotifications": 0},
+				{"$expr": bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$notificationCount", 0}}, "$maxNotifications"}}},
+			}},
+		},
+	}
+}
+
+// Filter of subscriptions that passed the expiry or reached the max notifications
+func GetExpiredSubscriptionFilter(now time.Time) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$lte": now}},
+			{
+				"maxNotifications": bson.M{"$gt": 0},
+				"$expr":            bson.M{"$gte": bson.A{bson.M{"$ifNull": bson.A{"$notificationCount", 0}}, "$maxNotifications"}},
+			},
+		},
+	}
+}
+
+// find multiple active subscriptions by filters
+func (r *SubscriptionRepository) GetActiveSubscriptions(filter bson.M) ([]model.Subscription, error) {
+	activeFilter := GetActiveSubscriptionFilter(time.Now())
+	if len(filter) > 0 {
+		activeFilter = bson.M{"$and": []bson.M{filter, activeFilter}}
+	}
+	return r.GetSubscriptions(activeFilter)
+}
+
+func (r *SubscriptionRepository) GetAllActive() ([]model.Subscription, error) {
+	return r.GetActiveSubscriptions(nil)
+}
+
 func (r *SubscriptionRepository) GetAllByOwnerId(ownerId primitive.ObjectID) ([]model.Subscription, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
 
-	cursor, err := r.SubCol.Find(ctx, bson.M{"ownerId": ownerId})
+	// stable order for the # of the subscriptions
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cursor, err := r.SubCol.Find(ctx, bson.M{"ownerId": ownerId}, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -91,12 +139,120 @@ func (r *SubscriptionRepository) GetAll() ([]model.Subscription, error) {
 	return subscriptions, err
 }
 
+func (r *SubscriptionRepository) GetSubscriptionById(id primitive.ObjectID) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	subscription := &model.Subscription{}
+	err := r.SubCol.FindOne(ctx, bson.M{"_id": id}).Decode(subscription)
+	return subscription, err
+}
+
 func (r *SubscriptionRepository) DeleteSubscriptionById(id primitive.ObjectID, ownerId primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
 
-	_, err := r.SubCol.DeleteOne(ctx, bson.M{"_id": id, "ownerId": ownerId})
-	return err
+	var subscription model.Subscription
+	err := r.SubCol.FindOneAndDelete(ctx, bson.M{"_id": id, "ownerId": ownerId}).Decode(&subscription)
+	if err != nil {
+		return err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(&subscription, "delete")
+	}
+
+	return nil
+}
+
+// Pause or resume a subscription of the owner
+func (r *SubscriptionRepository) SetSubscriptionDisabled(id, ownerId primitive.ObjectID, disabled bool) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"disabled": disabled}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	subscription := &model.Subscription{}
+	err := r.SubCol.FindOneAndUpdate(ctx, bson.M{"_id": id, "ownerId": ownerId}, update, opts).Decode(subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(subscription, "update")
+	}
+
+	return subscription, nil
+}
+
+// Count a notification sent for the subscription
+// @return the updated subscription
+func (r *SubscriptionRepository) IncrementNotificationCount(id primitive.ObjectID) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	update := bson.M{"$inc": bson.M{"notificationCount": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	subscription := &model.Subscription{}
+	err := r.SubCol.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(subscription)
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// Delete the expired subscriptions, returns the deleted subscriptions
+func (r *SubscriptionRepository) DeleteExpiredSubscriptions() ([]model.Subscription, error) {
+	filter := GetExpiredSubscriptionFilter(time.Now())
+	subscriptions, err := r.GetSubscriptions(filter)
+	if err != nil || len(subscriptions) == 0 {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(subscriptions))
+	for i, sub := range subscriptions {
+		ids[i] = sub.ID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if _, err := r.SubCol.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		for i := range subscriptions {
+			r.ChangeStreamCallback(&subscriptions[i], "delete")
+		}
+	}
+
+	return subscriptions, nil
+}
+
+// Delete all subscriptions of an owner, returns the deleted subscriptions
+func (r *SubscriptionRepository) DeleteAllByOwnerId(ownerId primitive.ObjectID) ([]model.Subscription, error) {
+	subscriptions, err := r.GetAllByOwnerId(ownerId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if _, err := r.SubCol.DeleteMany(ctx, bson.M{"ownerId": ownerId}); err != nil {
+		return nil, err
+	}
+
+	if r.ChangeStreamCallback != nil {
+		for i := range subscriptions {
+			r.ChangeStreamCallback(&subscriptions[i], "delete")
+		}
+	}
+
+	return subscriptions, nil
 }
 
 func (r *SubscriptionRepository) DeleteAll() error {
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/credentials"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TokenRepository struct {
+	TokenCol *mongo.Collection
+}
+
+var ErrInvalidToken = fmt.Errorf("invalid or expired token")
+var ErrInvalidScope = fmt.Errorf("invalid token scope")
+var ErrInvalidTokenType = fmt.Errorf("invalid token type")
+
+// Issue a token to the user, ttl <= 0 means never expire
+// @return raw token (only available here), token, error
+func (r *TokenRepository) IssueToken(userId primitive.ObjectID, tokenType, name string, scopes []string, ttl time.Duration) (string, *model.Token, error) {
+	if !slices.Contains(shared.TOKEN_TYPES, tokenType) {
+		return "", nil, ErrInvalidTokenType
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(shared.TOKEN_SCOPES, scope) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	rawToken, err := credentials.GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	token := &model.Token{
+		UserId:    userId,
+		Type:      tokenType,
+		Name:      name,
+		Hash:      credentials.HashToken(rawToken),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	result, err := r.TokenCol.InsertOne(ctx, token)
+	if err != nil {
+		return "", nil, err
+	}
+	token.ID = result.InsertedID.(primitive.ObjectID)
+
+	return rawToken, token, nil
+}
+
+// Find the token by the raw token and mark it as used
+// @return token, ErrInvalidToken if not found or expired
+func (r *TokenRepository) ValidateToken(rawToken string) (*model.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	// the TTL monitor only runs periodically, so also check the expiry here
+	filter := bson.M{
+		"hash": credentials.HashToken(rawToken),
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$exists": false}},
+			{"expiresAt": bson.M{"$gt": time.Now()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"lastUsedAt": time.Now()}}
+
+	token := &model.Token{}
+	err := r.TokenCol.FindOneAndUpdate(ctx, filter, update).Decode(token)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *TokenRepository) GetTokensByUserId(userId primitive.ObjectID) ([]model.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.TokenCol.Find(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []model.Token
+	err = cursor.All(ctx, &tokens)
+	return tokens, err
+}
+
+// Revoke a token owned by the user
+func (r *TokenRepository) RevokeToken(id, userId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	result, err := r.TokenCol.DeleteOne(ctx, bson.M{"_id": id, "userId": userId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Revoke all tokens of the user, tokenType "" means all types
+func (r *TokenRepository) RevokeAllByUserId(userId primitive.ObjectID, tokenType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	filter := bson.M{"userId": userId}
+	if tokenType != "" {
+		filter["type"] = tokenType
+	}
+
+	_, err := r.TokenCol.DeleteMany(ctx, filter)
+	return err
+}
+
+// Delete expired tokens now instead of waiting for the TTL monitor
+func (r *TokenRepository) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.TokenCol.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lte": time.Now()}})
+	return err
+}
+
+func (r *TokenRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.TokenCol.DeleteMany(ctx, bson.M{})
+	return err
+}
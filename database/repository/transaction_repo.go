@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	shared "github.com/mikezzb/steam-trading-shared"
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -90,6 +92,7 @@ func (r *TransactionRepository) InsertTransactions(transactions []model.Transact
 	defer cancel()
 	var documents []interface{}
 	for _, transaction := range transactions {
+		SetTransactionPhase(&transaction)
 		documents = append(documents, transaction)
 	}
 	_, err := r.TransactionCol.InsertMany(ctx, documents, options.InsertMany())
@@ -103,6 +106,8 @@ func (r *TransactionRepository) Count(filters bson.M) (int64, error) {
 	return r.TransactionCol.CountDocuments(ctx, filters)
 }
 
+// UpsertTransactionsByAssetID inserts the transactions not in the collection yet by asset id & market
+// A scraped transaction replaces the synthetic one of the asset, and keeps its id for the linked listing
 func (r *TransactionRepository) UpsertTransactionsByAssetID(transactions []model.Transaction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
@@ -111,6 +116,8 @@ func (r *TransactionRepository) UpsertTransactionsByAssetID(transactions []model
 		operations  []mongo.WriteModel
 		filters     []interface{}
 		newTransMap = make(map[string]bool)
+		// unique key -> id of the synthetic transaction
+		syntheticIds = make(map[string]primitive.ObjectID)
 	)
 
 	// Collect all filters and prepare to check in bulk
@@ -133,14 +140,16 @@ func (r *TransactionRepository) UpsertTransactionsByAssetID(transactions []model
 		defer cursor.Close(ctx)
 
 		// Iterate through the cursor and mark existing documents
-		var result bson.M
 		for cursor.Next(ctx) {
-			if err := cursor.Decode(&result); err != nil {
+			var existing model.Transaction
+			if err := cursor.Decode(&existing); err != nil {
+				continue
+			}
+			uniqueKey := GetTransactionKey(&existing)
+			if existing.Metadata.Synthetic {
+				syntheticIds[uniqueKey] = existing.ID
 				continue
 			}
-			assetId := result["metadata"].(bson.M)["assetId"].(string)
-			market := result["metadata"].(bson.M)["market"].(string)
-			uniqueKey := fmt.Sprintf("%s-%s", assetId, market)
 			delete(newTransMap, uniqueKey)
 		}
 	}
@@ -148,13 +157,29 @@ func (r *TransactionRepository) UpsertTransactionsByAssetID(transactions []model
 	// Prepare insert operations for non-existing documents
 	for _, transaction := range transactions {
 		uniqueKey := GetTransactionKey(&transaction)
-		if _, found := newTransMap[uniqueKey]; found {
-			model := mongo.NewInsertOneModel().SetDocument(transaction)
-			operations = append(operations, model)
+		if _, found := newTransMap[uniqueKey]; !found {
+			continue
+		}
+		if syntheticId, ok := syntheticIds[uniqueKey]; ok {
+			if transaction.Metadata.Synthetic {
+				continue
+			}
+			// time series collections only delete by the metadata
+			operations = append(operations, mongo.NewDeleteManyModel().SetFilter(bson.M{
+				"metadata.assetId":   transaction.Metadata.AssetId,
+				"metadata.market":    transaction.Metadata.Market,
+				"metadata.synthetic": true,
+			}))
+			if transaction.ID.IsZero() {
+				transaction.ID = syntheticId
+			}
 		}
+		SetTransactionPhase(&transaction)
+		model := mongo.NewInsertOneModel().SetDocument(transaction)
+		operations = append(operations, model)
 	}
 
-	// Execute bulk insert for new transactions
+	// Execute bulk writes for new transactions
 	if len(operations) > 0 {
 		_, err := r.TransactionCol.BulkWrite(ctx, operations)
 		if err != nil {
@@ -164,6 +189,92 @@ func (r *TransactionRepository) UpsertTransactionsByAssetID(transactions []model
 	return nil
 }
 
+// @return transactions of the assets on the market
+func (r *TransactionRepository) FindTransactionsByAssetIds(market string, assetIds []string) ([]model.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.TransactionCol.Find(ctx, bson.M{
+		"metadata.market":  market,
+		"metadata.assetId": bson.M{"$in": assetIds},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []model.Transaction
+	err = cursor.All(ctx, &transactions)
+	return transactions, err
+}
+
+// @return scraped transactions of the item on the market after the time, oldest first
+func (r *TransactionRepository) FindTransactionsSince(name, market string, since time.Time) ([]model.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	filter := bson.M{
+		"name":               name,
+		"metadata.market":    market,
+		"metadata.synthetic": bson.M{"$ne": true},
+		"createdAt":          bson.M{"$gt": since},
+	}
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+
+	cursor, err := r.TransactionCol.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []model.Transaction
+	err = cursor.All(ctx, &transactions)
+	return transactions, err
+}
+
+// @return item name -> market -> number of scraped transactions in the last days
+func (r *TransactionRepository) CountSalesByItem(days int) (map[string]map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"createdAt":          bson.M{"$gte": shared.GetTimeBeforeDays(days)},
+			"metadata.synthetic": bson.M{"$ne": true},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"name": "$name", "market": "$metadata.market"},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.TransactionCol.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]map[string]int64)
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				Name   string `bson:"name"`
+				Market string `bson:"market"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		if counts[result.ID.Name] == nil {
+			counts[result.ID.Name] = make(map[string]int64)
+		}
+		counts[result.ID.Name][result.ID.Market] = result.Count
+	}
+
+	return counts, cursor.Err()
+}
+
 func (r *TransactionRepository) DeleteTransactionByItemName(name string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
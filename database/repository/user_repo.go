@@ -2,7 +2,13 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
 
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/credentials"
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,8 +17,19 @@ import (
 
 type UserRepository struct {
 	UserCol *mongo.Collection
+	// used to cascade the deletion of the user data
+	SubRepo       *SubscriptionRepository
+	TokenRepo     *TokenRepository
+	ItemAlertRepo *ItemAlertRepository
+	PortfolioRepo *PortfolioRepository
+	LinkCodeRepo  *LinkCodeRepository
+	// notified of the favorite item changes with *model.FavItemChange
+	ChangeStreamCallback ChangeStreamCallback
 }
 
+var ErrInvalidRole = fmt.Errorf("invalid user role")
+var ErrInvalidLocale = fmt.Errorf("invalid locale")
+
 // @return user, error
 func (r *UserRepository) GetUserByEmail(email string) (*model.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
@@ -38,7 +55,20 @@ func (r *UserRepository) GetUserById(id primitive.ObjectID) (*model.User, error)
 	return user, err
 }
 
+// Insert a user with the plain text password from the client.
+// The password is always hashed, even if it already looks like a hash.
 func (r *UserRepository) InsertUser(user *model.User) (primitive.ObjectID, error) {
+	hash, err := credentials.HashPassword(user.Password)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	user.Password = hash
+
+	return r.insertUser(user)
+}
+
+// insertUser stores the user as is, the password must already be hashed.
+func (r *UserRepository) insertUser(user *model.User) (primitive.ObjectID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
 	defer cancel()
 
@@ -59,5 +89,304 @@ func (r *UserRepository) InsertUser(user *model.User) (primitive.ObjectID, error
 	}
 
 	result, err := r.UserCol.InsertOne(ctx, user)
-	return result.InsertedID.(primitive.ObjectID), err
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+// Update the username and email of a user.
+// Password, role and favorites are updated by their own methods.
+func (r *UserRepository) UpdateUser(user *model.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	// ensure the new username OR email is not taken by another user
+	filter := bson.M{
+		"_id": bson.M{"$ne": user.ID},
+		"$or": []bson.M{
+			{"username": user.Username},
+			{"email": user.Email},
+		},
+	}
+
+	count, err := r.UserCol.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrDuplicate
+	}
+
+	return r.updateUserById(ctx, user.ID, bson.M{"$set": bson.M{
+		"username": user.Username,
+		"email":    user.Email,
+	}})
+}
+
+// Hash and set the password of a user
+func (r *UserRepository) UpdatePassword(id primitive.ObjectID, password string) error {
+	hash, err := credentials.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	return r.updateUserById(ctx, id, bson.M{"$set": bson.M{"password": hash}})
+}
+
+// Verify the login credentials, and rehash the stored password if outdated
+// @return user, credentials.ErrInvalidCredentials if email or password not match
+func (r *UserRepository) Authenticate(email, password string) (*model.User, error) {
+	user, err := r.GetUserByEmail(email)
+	if err == mongo.ErrNoDocuments {
+		return nil, credentials.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := credentials.VerifyPassword(user.Password, password); err != nil {
+		return nil, err
+	}
+
+	if credentials.NeedsRehash(user.Password) {
+		if err := r.UpdatePassword(user.ID, password); err != nil {
+			log.Printf("Authenticate: failed to rehash password: %v", err)
+		}
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) UpdateRole(id primitive.ObjectID, role string) error {
+	if !slices.Contains(shared.USER_ROLES, role) {
+		return ErrInvalidRole
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	return r.updateUserById(ctx, id, bson.M{"$set": bson.M{"role": role}})
+}
+
+func (r *UserRepository) UpdateLocale(id primitive.ObjectID, locale string) error {
+	if !slices.Contains(shared.LOCALES, locale) {
+		return ErrInvalidLocale
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	return r.updateUserById(ctx, id, bson.M{"$set": bson.M{"locale": locale}})
+}
+
+// Delete a user and all subscriptions, tokens, item alerts, portfolio and link codes owned by the user
+func (r *UserRepository) DeleteUser(id primitive.ObjectID) error {
+	if r.SubRepo != nil {
+		if _, err := r.SubRepo.DeleteAllByOwnerId(id); err != nil {
+			return err
+		}
+	}
+
+	if r.TokenRepo != nil {
+		if err := r.TokenRepo.RevokeAllByUserId(id, ""); err != nil {
+			return err
+		}
+	}
+
+	if r.ItemAlertRepo != nil {
+		if _, err := r.ItemAlertRepo.DeleteAllByOwnerId(id); err != nil {
+			return err
+		}
+	}
+
+	if r.PortfolioRepo != nil {
+		if err := r.PortfolioRepo.DeleteAllByOwnerId(id); err != nil {
+			return err
+		}
+	}
+
+	if r.LinkCodeRepo != nil {
+		if err := r.LinkCodeRepo.DeleteAllByUserId(id); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	var user model.User
+	if err := r.UserCol.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return err
+	}
+
+	for _, itemId := range user.FavItemIds {
+		r.onFavItemChange(id, itemId, "delete")
+	}
+	return nil
+}
+
+// Favorites, $addToSet ensures no duplicates
+
+func (r *UserRepository) AddFavItem(id primitive.ObjectID, itemId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if err := r.updateUserById(ctx, id, bson.M{"$addToSet": bson.M{"favItemIds": itemId}}); err != nil {
+		return err
+	}
+	r.onFavItemChange(id, itemId, "insert")
+	return nil
+}
+
+func (r *UserRepository) RemoveFavItem(id primitive.ObjectID, itemId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if err := r.updateUserById(ctx, id, bson.M{"$pull": bson.M{"favItemIds": itemId}}); err != nil {
+		return err
+	}
+	r.onFavItemChange(id, itemId, "delete")
+	return nil
+}
+
+func (r *UserRepository) onFavItemChange(id primitive.ObjectID, itemId, operationType string) {
+	if r.ChangeStreamCallback != nil {
+		r.ChangeStreamCallback(&model.FavItemChange{UserId: id, ItemId: itemId}, operationType)
+	}
+}
+
+// @return the users with the item in their favorites
+func (r *UserRepository) GetUsersByFavItemId(itemId string) ([]model.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	cursor, err := r.UserCol.Find(ctx, bson.M{"favItemIds": itemId})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []model.User
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+// @return the items in the favorites of any user
+func (r *UserRepository) GetAllFavItemIds() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	values, err := r.UserCol.Distinct(ctx, "favItemIds", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	itemIds := make([]string, 0, len(values))
+	for _, value := range values {
+		if itemId, ok := value.(string); ok {
+			itemIds = append(itemIds, itemId)
+		}
+	}
+	return itemIds, nil
+}
+
+func (r *UserRepository) AddFavListing(id, listingId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	return r.updateUserById(ctx, id, bson.M{"$addToSet": bson.M{"favListingIds": listingId}})
+}
+
+func (r *UserRepository) RemoveFavListing(id, listingId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	return r.updateUserById(ctx, id, bson.M{"$pull": bson.M{"favListingIds": listingId}})
+}
+
+// Link a verified channel to the user.
+// A channel can only be linked to one user, so it is unlinked from any other user first.
+func (r *UserRepository) AddLinkedChannel(id primitive.ObjectID, channel *model.LinkedChannel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	if channel.ID.IsZero() {
+		channel.ID = primitive.NewObjectID()
+	}
+	if channel.LinkedAt.IsZero() {
+		channel.LinkedAt = time.Now()
+	}
+
+	channelFilter := bson.M{"type": channel.Type, "notiId": channel.NotiId}
+	_, err := r.UserCol.UpdateMany(ctx,
+		bson.M{"linkedChannels": bson.M{"$elemMatch": channelFilter}},
+		bson.M{"$pull": bson.M{"linkedChannels": channelFilter}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.updateUserById(ctx, id, bson.M{"$push": bson.M{"linkedChannels": channel}})
+}
+
+func (r *UserRepository) RemoveLinkedChannel(id, channelId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	return r.updateUserById(ctx, id, bson.M{"$pull": bson.M{"linkedChannels": bson.M{"_id": channelId}}})
+}
+
+// Find the user who linked the channel, e.g. the Telegram chat
+func (r *UserRepository) GetUserByLinkedChannel(channelType, notiId string) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	user := &model.User{}
+	filter := bson.M{"linkedChannels": bson.M{"$elemMatch": bson.M{"type": channelType, "notiId": notiId}}}
+	err := r.UserCol.FindOne(ctx, filter).Decode(user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// @return linked channel of the user, mongo.ErrNoDocuments if not found
+func (r *UserRepository) GetLinkedChannel(id, channelId primitive.ObjectID) (*model.LinkedChannel, error) {
+	user, err := r.GetUserById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range user.LinkedChannels {
+		if user.LinkedChannels[i].ID == channelId {
+			return &user.LinkedChannels[i], nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *UserRepository) DeleteAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_DURATION)
+	defer cancel()
+
+	_, err := r.UserCol.DeleteMany(ctx, bson.M{})
+	return err
+}
+
+// @return mongo.ErrNoDocuments if the user does not exist
+func (r *UserRepository) updateUserById(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	result, err := r.UserCol.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	shared "github.com/mikezzb/steam-trading-shared"
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -117,6 +118,197 @@ func MapToBson(m map[string]interface{}) bson.M {
 	return b
 }
 
+// Resolve the Doppler phase from the paint index if not set
+func SetListingPhase(listing *model.Listing) {
+	if listing.Phase == "" {
+		listing.Phase = shared.GetDopplerPhase(listing.PaintIndex)
+	}
+}
+
+// Resolve the Doppler phase from the paint index if not set
+func SetTransactionPhase(transaction *model.Transaction) {
+	if transaction.Phase == "" {
+		transaction.Phase = shared.GetDopplerPhase(transaction.PaintIndex)
+	}
+}
+
+// fields set when a listing is removed, cleared once the listing is seen again
+var LISTING_REMOVAL_FIELDS = bson.M{
+	"status":        "",
+	"removedAt":     "",
+	"timeOnMarket":  "",
+	"transactionId": "",
+}
+
+// fields set by the scoring service, computed for the price when scored
+var LISTING_SCORE_FIELDS = bson.M{
+	"fairValue": "",
+	"discount":  "",
+}
+
+// Upsert the scraped listing, a relisted asset becomes active again
+// The score of the previous price is cleared unless the listing is scored
+func GetListingUpsertBson(listing *model.Listing) bson.M {
+	unset := MapToBson(LISTING_REMOVAL_FIELDS)
+	if listing.FairValue <= 0 {
+		for field, value := range LISTING_SCORE_FIELDS {
+			unset[field] = value
+		}
+	}
+	return bson.M{
+		"$set":   listing,
+		"$unset": unset,
+	}
+}
+
+// Only the active listings unless the filters query the status
+func AddActiveListingFilter(filters bson.M) bson.M {
+	if filters == nil {
+		filters = bson.M{}
+	}
+	if _, ok := filters["status"]; !ok {
+		filters["status"] = bson.M{"$exists": false}
+	}
+	return filters
+}
+
+// Listings of each market checked within its max age, markets without a policy use the default
+func GetFreshListingFilter(now time.Time) bson.A {
+	policies := shared.GetStalenessPolicies()
+
+	fresh := make(bson.A, 0, len(policies)+1)
+	markets := make(bson.A, 0, len(policies))
+	for market, policy := range policies {
+		fresh = append(fresh, bson.M{
+			"market":    market,
+			"checkedAt": bson.M{"$gte": now.Add(-policy.MaxAge)},
+		})
+		markets = append(markets, market)
+	}
+	fresh = append(fresh, bson.M{
+		"market":    bson.M{"$nin": markets},
+		"checkedAt": bson.M{"$gte": now.Add(-shared.DEFAULT_STALENESS_POLICY.MaxAge)},
+	})
+	return fresh
+}
+
+// Only the active & fresh listings unless the filters query the status or checkedAt
+// The filters of the caller are copied, not modified
+func AddVisibleListingFilter(filters bson.M, now time.Time) (bson.M, error) {
+	filters = AddActiveListingFilter(MapToBson(filters))
+	if _, ok := filters["checkedAt"]; ok {
+		return filters, nil
+	}
+
+	fresh := bson.M{"$or": GetFreshListingFilter(now)}
+	if _, ok := filters["$or"]; !ok {
+		filters["$or"] = fresh["$or"]
+		return filters, nil
+	}
+
+	// keep the $or & $and of the caller
+	var and bson.A
+	switch clauses := filters["$and"].(type) {
+	case nil:
+	case bson.A:
+		and = append(and, clauses...)
+	case []interface{}:
+		and = append(and, clauses...)
+	case []bson.M:
+		for _, clause := range clauses {
+			and = append(and, clause)
+		}
+	case []bson.D:
+		for _, clause := range clauses {
+			and = append(and, clause)
+		}
+	default:
+		return nil, fmt.Errorf("invalid $and filter of type %T", clauses)
+	}
+	filters["$and"] = append(and, fresh)
+	return filters, nil
+}
+
+func GetListingKey(listing *model.Listing) string {
+	return fmt.Sprintf("%s-%s", listing.AssetId, listing.Market)
+}
+
+// fields not compared by IsListingModified, refreshed by every scrape
+var LISTING_UNCOMPARED_FIELDS = map[string]bool{
+	"_id":       true,
+	"checkedAt": true,
+}
+
+// IsListingModified checks if the upsert of the listing changes its previous document
+func IsListingModified(previous, listing *model.Listing) (bool, error) {
+	// the removal fields are unset by the upsert
+	if previous.Status != "" {
+		return true, nil
+	}
+
+	// compare as documents, as the upsert only sets the non-empty fields
+	prevDoc, err := toBsonM(previous)
+	if err != nil {
+		return false, err
+	}
+	doc, err := toBsonM(listing)
+	if err != nil {
+		return false, err
+	}
+
+	for key, value := range doc {
+		if LISTING_UNCOMPARED_FIELDS[key] {
+			continue
+		}
+		if !reflect.DeepEqual(prevDoc[key], value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func toBsonM(value interface{}) (bson.M, error) {
+	b, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	err = bson.Unmarshal(b, &doc)
+	return doc, err
+}
+
+// GetPriceSnapshots returns the snapshots of the market prices changed from the old item
+// Snapshots are taken at the update time of the market price, now if not set
+// @return if both prices are set with the same amount & currency, the update times are ignored
+func IsSameMarketPrice(a, b *model.MarketPrice) bool {
+	return a != nil && b != nil && a.Price.String() == b.Price.String() && a.Currency == b.Currency
+}
+
+func GetPriceSnapshots(oldItem, item *model.Item, now time.Time) []model.PriceSnapshot {
+	var snapshots []model.PriceSnapshot
+	for _, market := range shared.ITEM_MARKET_NAMES {
+		price := shared.GetMarketPrice(item, market)
+		if price == nil {
+			continue
+		}
+		if IsSameMarketPrice(shared.GetMarketPrice(oldItem, market), price) {
+			continue
+		}
+
+		createdAt := price.UpdatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		snapshots = append(snapshots, model.PriceSnapshot{
+			Metadata:  model.PriceSnapshotMetadata{Name: item.Name, Market: market},
+			CreatedAt: createdAt,
+			Price:     price.Price,
+			Currency:  price.Currency,
+		})
+	}
+	return snapshots
+}
+
 func GetTransactionKey(tran *model.Transaction) string {
 	return fmt.Sprintf("%s-%s", tran.Metadata.AssetId, tran.Metadata.Market)
 }
@@ -0,0 +1,259 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+// A fee charged on the sale, e.g. the Steam fee and the game fee
+type FeeComponent struct {
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"`
+	// min fee in the currency of the market
+	Min float64 `json:"min"`
+}
+
+// Fees of a market, amounts are in the currency of the market
+type MarketFee struct {
+	SellerFees []FeeComponent `json:"sellerFees"`
+	// The seller fees are charged on top of the seller receipt, i.e. the listed price includes the fees (Steam)
+	FeeIncluded bool `json:"feeIncluded"`
+	// Extra fee paid by the buyer on top of the listed price
+	BuyerRate float64 `json:"buyerRate"`
+	// Fee of cashing out the balance, 0 if the balance cannot be withdrawn
+	WithdrawalRate float64 `json:"withdrawalRate"`
+	WithdrawalMin  float64 `json:"withdrawalMin"`
+}
+
+// market name -> fees
+type FeeSchedule map[string]*MarketFee
+
+// Approximate public fees, override with SetFeeSchedule or LoadFeeSchedule
+var DEFAULT_FEE_SCHEDULE = FeeSchedule{
+	MARKET_NAME_STEAM: {
+		SellerFees: []FeeComponent{
+			{Name: "steam", Rate: 0.05, Min: 0.01},
+			{Name: "game", Rate: 0.10, Min: 0.01},
+		},
+		FeeIncluded: true,
+	},
+	MARKET_NAME_BUFF: {
+		SellerFees:     []FeeComponent{{Name: "seller", Rate: 0.025, Min: 0.01}},
+		WithdrawalRate: 0.01,
+	},
+	MARKET_NAME_IGXE: {
+		SellerFees:     []FeeComponent{{Name: "seller", Rate: 0.025, Min: 0.01}},
+		WithdrawalRate: 0.01,
+	},
+	MARKET_NAME_UU: {
+		SellerFees:     []FeeComponent{{Name: "seller", Rate: 0.01, Min: 0.01}},
+		WithdrawalRate: 0.01,
+	},
+}
+
+var (
+	feeSchedule   = DEFAULT_FEE_SCHEDULE
+	feeScheduleMu sync.RWMutex
+)
+
+// LoadFeeSchedule loads the fees from a json file of market name -> MarketFee,
+// markets not in the file keep the default fees
+func LoadFeeSchedule(path string) (FeeSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := FeeSchedule{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, err
+	}
+
+	schedule := FeeSchedule{}
+	for market, fee := range DEFAULT_FEE_SCHEDULE {
+		schedule[market] = fee
+	}
+	for market, fee := range loaded {
+		if fee == nil {
+			return nil, fmt.Errorf("LoadFeeSchedule: missing fees of %s", market)
+		}
+		if err := fee.validate(); err != nil {
+			return nil, fmt.Errorf("LoadFeeSchedule: %s: %w", market, err)
+		}
+		schedule[market] = fee
+	}
+	return schedule, nil
+}
+
+// rates of 100% or more leave no proceeds to break even
+func (f *MarketFee) validate() error {
+	rate := 0.0
+	for _, c := range f.SellerFees {
+		if c.Rate < 0 || c.Min < 0 {
+			return fmt.Errorf("negative fee %s", c.Name)
+		}
+		rate += c.Rate
+	}
+	if rate >= 1 {
+		return fmt.Errorf("seller fee rate %v >= 1", rate)
+	}
+	if f.BuyerRate < 0 || f.WithdrawalMin < 0 || f.WithdrawalRate < 0 || f.WithdrawalRate >= 1 {
+		return fmt.Errorf("invalid buyer or withdrawal fee")
+	}
+	return nil
+}
+
+func SetFeeSchedule(schedule FeeSchedule) {
+	feeScheduleMu.Lock()
+	defer feeScheduleMu.Unlock()
+	feeSchedule = schedule
+}
+
+func GetFeeSchedule() FeeSchedule {
+	feeScheduleMu.RLock()
+	defer feeScheduleMu.RUnlock()
+	return feeSchedule
+}
+
+// Fees of the market, no fees for unknown markets
+func GetMarketFee(marketName string) *MarketFee {
+	if fee, ok := GetFeeSchedule()[marketName]; ok {
+		return fee
+	}
+	return &MarketFee{}
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func (f *MarketFee) totalRate() float64 {
+	rate := 0.0
+	for _, c := range f.SellerFees {
+		rate += c.Rate
+	}
+	return rate
+}
+
+// SellerFee returns the fees charged on the sale of the listed price
+func (f *MarketFee) SellerFee(price float64) float64 {
+	if price <= 0 {
+		return 0
+	}
+
+	// fees are based on the seller receipt if included in the price
+	base := price
+	if f.FeeIncluded {
+		base = price / (1 + f.totalRate())
+	}
+
+	fee := 0.0
+	for _, c := range f.SellerFees {
+		fee += roundCents(math.Max(c.Min, base*c.Rate))
+	}
+	return math.Min(fee, price)
+}
+
+// SaleProceeds returns the balance received from the sale, before withdrawal
+func (f *MarketFee) SaleProceeds(price float64) float64 {
+	return roundCents(price - f.SellerFee(price))
+}
+
+// NetProceeds returns the cash received from the sale after the withdrawal fee
+func (f *MarketFee) NetProceeds(price float64) float64 {
+	proceeds := f.SaleProceeds(price)
+	if f.WithdrawalRate == 0 && f.WithdrawalMin == 0 {
+		return proceeds
+	}
+	withdrawal := roundCents(math.Max(f.WithdrawalMin, proceeds*f.WithdrawalRate))
+	return math.Max(roundCents(proceeds-withdrawal), 0)
+}
+
+// BuyerCost returns the amount paid by the buyer of the listed price
+func (f *MarketFee) BuyerCost(price float64) float64 {
+	return roundCents(price * (1 + f.BuyerRate))
+}
+
+// listed prices over this multiple of the cost are not searched for a break even
+const MAX_BREAK_EVEN_MULTIPLE = 1000
+
+// BreakEvenPrice returns the min listed price whose net proceeds cover the cost
+// @return error if no price up to MAX_BREAK_EVEN_MULTIPLE times the cost breaks even
+func (f *MarketFee) BreakEvenPrice(cost float64) (float64, error) {
+	if cost <= 0 {
+		return 0, nil
+	}
+
+	// net proceeds is monotonic in the price, binary search in cents
+	low, high := int64(0), int64(math.Ceil(cost*100))
+	// +100 cents for the min fees of cheap items
+	limit := high*MAX_BREAK_EVEN_MULTIPLE + 100
+	for f.NetProceeds(float64(high)/100) < cost {
+		if high >= limit {
+			return 0, fmt.Errorf("no price breaks even on the cost %v", cost)
+		}
+		// +1 for the min fees of cheap items
+		high = min(high*2+1, limit)
+	}
+	for low+1 < high {
+		mid := (low + high) / 2
+		if f.NetProceeds(float64(mid)/100) >= cost {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return float64(high) / 100, nil
+}
+
+// Buyer cost of the listing in the currency of the listing
+func GetListingBuyerCost(listing *model.Listing) float64 {
+	return GetMarketFee(listing.Market).BuyerCost(DecToFloat(listing.Price))
+}
+
+// Min price to list the bought listing on the sell market without loss, in the currency of the sell market
+func GetListingBreakEvenPrice(listing *model.Listing, sellMarket string) (float64, error) {
+	cost, err := ConvertAmount(GetListingBuyerCost(listing), GetListingCurrency(listing), GetMarketCurrency(sellMarket))
+	if err != nil {
+		return 0, err
+	}
+	return GetMarketFee(sellMarket).BreakEvenPrice(cost)
+}
+
+// Net proceeds of selling the item at its market price, in the currency of the market
+func GetItemNetProceeds(item *model.Item, marketName string) (float64, error) {
+	price := GetMarketPrice(item, marketName)
+	if price == nil {
+		return 0, fmt.Errorf("no %s price of %s", marketName, item.Name)
+	}
+	return GetMarketFee(marketName).NetProceeds(DecToFloat(price.Price)), nil
+}
+
+// Buyer cost of the item at its market price, in the currency of the market
+func GetItemBuyerCost(item *model.Item, marketName string) (float64, error) {
+	price := GetMarketPrice(item, marketName)
+	if price == nil {
+		return 0, fmt.Errorf("no %s price of %s", marketName, item.Name)
+	}
+	return GetMarketFee(marketName).BuyerCost(DecToFloat(price.Price)), nil
+}
+
+// Min price to sell the item on the sell market after buying it on the buy market, in the currency of the sell market
+func GetItemBreakEvenPrice(item *model.Item, buyMarket, sellMarket string) (float64, error) {
+	price := GetMarketPrice(item, buyMarket)
+	if price == nil {
+		return 0, fmt.Errorf("no %s price of %s", buyMarket, item.Name)
+	}
+
+	cost := GetMarketFee(buyMarket).BuyerCost(DecToFloat(price.Price))
+	cost, err := ConvertAmount(cost, GetMarketPriceCurrency(price, buyMarket), GetMarketCurrency(sellMarket))
+	if err != nil {
+		return 0, err
+	}
+	return GetMarketFee(sellMarket).BreakEvenPrice(cost)
+}
@@ -0,0 +1,102 @@
+package shared
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestMarketFee(t *testing.T) {
+	testCases := []struct {
+		market        string
+		price         float64
+		saleProceeds  float64
+		netProceeds   float64
+		breakEvenCost float64
+	}{
+		// $1.15 = $1.00 + $0.05 steam fee + $0.10 game fee
+		{MARKET_NAME_STEAM, 1.15, 1.00, 1.00, 1.00},
+		// min fees of $0.01 each
+		{MARKET_NAME_STEAM, 0.03, 0.01, 0.01, 0.01},
+		// ¥100 - 2.5% seller fee, then 1% withdrawal fee
+		{MARKET_NAME_BUFF, 100, 97.5, 96.52, 96.52},
+		{MARKET_NAME_UU, 100, 99, 98.01, 98.01},
+	}
+
+	for _, tc := range testCases {
+		fee := GetMarketFee(tc.market)
+		if actual := fee.SaleProceeds(tc.price); math.Abs(actual-tc.saleProceeds) > 1e-9 {
+			t.Errorf("%s SaleProceeds(%v): expected %v, got %v", tc.market, tc.price, tc.saleProceeds, actual)
+		}
+		if actual := fee.NetProceeds(tc.price); math.Abs(actual-tc.netProceeds) > 1e-9 {
+			t.Errorf("%s NetProceeds(%v): expected %v, got %v", tc.market, tc.price, tc.netProceeds, actual)
+		}
+		breakEven, err := fee.BreakEvenPrice(tc.breakEvenCost)
+		if err != nil || breakEven > tc.price || fee.NetProceeds(breakEven) < tc.breakEvenCost {
+			t.Errorf("%s BreakEvenPrice(%v): expected <= %v with enough proceeds, got %v", tc.market, tc.breakEvenCost, tc.price, breakEven)
+		}
+	}
+
+	if actual := GetMarketFee("unknown").NetProceeds(10); actual != 10 {
+		t.Errorf("Expected no fees of unknown market, got %v", actual)
+	}
+
+	// the fixed fee takes all proceeds
+	fee := &MarketFee{SellerFees: []FeeComponent{{Name: "seller", Rate: 0.5}}, WithdrawalMin: 1e9}
+	if _, err := fee.BreakEvenPrice(10); err == nil {
+		t.Errorf("Expected no break even price")
+	}
+}
+
+func TestItemBreakEvenPrice(t *testing.T) {
+	defer SetRateProvider(GetRateProvider())
+	SetRateProvider(NewStaticRateProvider(CURRENCY_USD, map[string]float64{CURRENCY_CNY: 7}))
+
+	item := &model.Item{
+		Name:      "AK-47 | Redline (Field-Tested)",
+		BuffPrice: &model.MarketPrice{Price: GetDecimal128("70")},
+	}
+
+	// ¥70 = $10, listed at $11.50 on Steam to receive $10
+	price, err := GetItemBreakEvenPrice(item, MARKET_NAME_BUFF, MARKET_NAME_STEAM)
+	if err != nil || math.Abs(price-11.5) > 0.011 {
+		t.Errorf("Expected ~11.5, got %v, %v", price, err)
+	}
+
+	if _, err := GetItemBreakEvenPrice(item, MARKET_NAME_IGXE, MARKET_NAME_STEAM); err == nil {
+		t.Errorf("Expected error for missing price")
+	}
+}
+
+func TestLoadFeeSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fees.json")
+	if err := os.WriteFile(path, []byte(`{"buff": {"sellerFees": [{"name": "seller", "rate": 0.02}]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := LoadFeeSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer SetFeeSchedule(GetFeeSchedule())
+	SetFeeSchedule(schedule)
+
+	if actual := GetMarketFee(MARKET_NAME_BUFF).NetProceeds(100); actual != 98 {
+		t.Errorf("Expected 98, got %v", actual)
+	}
+	// other markets keep the default fees
+	if actual := GetMarketFee(MARKET_NAME_STEAM).NetProceeds(1.15); actual != 1 {
+		t.Errorf("Expected 1, got %v", actual)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"buff": {"sellerFees": [{"name": "seller", "rate": 1}]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFeeSchedule(path); err == nil {
+		t.Errorf("Expected error for a 100%% fee rate")
+	}
+}
@@ -5,6 +5,7 @@ go 1.21.3
 require (
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	go.mongodb.org/mongo-driver v1.14.0
+	golang.org/x/crypto v0.17.0
 )
 
 require (
@@ -15,7 +16,6 @@ require (
 	github.com/xdg-go/scram v1.1.2 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d // indirect
-	golang.org/x/crypto v0.17.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
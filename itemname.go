@@ -0,0 +1,127 @@
+package shared
+
+import (
+	"slices"
+	"strings"
+)
+
+// Parsed market hash name, e.g. ★ StatTrak™ Karambit | Doppler (Factory New)
+type ItemName struct {
+	Star     bool
+	StatTrak bool
+	Souvenir bool
+
+	// One of ITEM_TYPE_*
+	Type string
+	// The part before " | ", e.g. AK-47, Karambit, Sticker, or the agent name
+	Weapon string
+	// The part after " | " without exterior, e.g. Redline, Crown (Foil), or the agent faction
+	Skin string
+	// Optional, wear level
+	Exterior string
+	// Optional, Doppler phase, not part of the market hash name, e.g. "... (Factory New) - Phase 2"
+	Phase string
+}
+
+// ParseItemName parses a market hash name, optionally suffixed with " - <Doppler phase>".
+// Never fails, unknown parts are kept in Weapon & Skin so the name can be rebuilt losslessly.
+func ParseItemName(name string) ItemName {
+	n := ItemName{}
+	s := name
+
+	if rest, ok := strings.CutPrefix(s, STAR_LEBEL); ok {
+		n.Star, s = true, rest
+	}
+	if rest, ok := strings.CutPrefix(s, STAT_TRAK_LABEL); ok {
+		n.StatTrak, s = true, rest
+	}
+	if rest, ok := strings.CutPrefix(s, SOUVENIR_LABEL); ok {
+		n.Souvenir, s = true, rest
+	}
+
+	// phase suffix
+	if i := strings.LastIndex(s, " - "); i != -1 && slices.Contains(DOPPLER_PHASES, s[i+3:]) {
+		n.Phase, s = s[i+3:], s[:i]
+	}
+
+	// exterior in the ending (), other () like (Foil) are part of the name
+	if strings.HasSuffix(s, ")") {
+		if i := strings.LastIndex(s, " ("); i != -1 && slices.Contains(WEAR_LEVELS, s[i+2:len(s)-1]) {
+			n.Exterior, s = s[i+2:len(s)-1], s[:i]
+		}
+	}
+
+	n.Weapon, n.Skin, _ = strings.Cut(s, " | ")
+	n.Type = getItemType(&n)
+	return n
+}
+
+func getItemType(n *ItemName) string {
+	if n.Star {
+		if slices.Contains(GLOVE_NAMES, n.Weapon) {
+			return ITEM_TYPE_GLOVES
+		}
+		return ITEM_TYPE_KNIFE
+	}
+	if slices.Contains(WEAPON_NAMES, n.Weapon) {
+		return ITEM_TYPE_WEAPON
+	}
+	if itemType, ok := ITEM_NAME_PREFIX_TYPES[n.Weapon]; ok && n.Skin != "" {
+		return itemType
+	}
+	if n.Skin == "" {
+		for _, suffix := range CONTAINER_NAME_SUFFIXES {
+			if strings.HasSuffix(n.Weapon, suffix) {
+				return ITEM_TYPE_CONTAINER
+			}
+		}
+		return ITEM_TYPE_OTHER
+	}
+	// agents are named as "<name> | <faction>"
+	return ITEM_TYPE_AGENT
+}
+
+// Prefix returns the labels before the weapon, e.g. "★ StatTrak™ "
+func (n ItemName) Prefix() string {
+	prefix := ""
+	if n.Star {
+		prefix += STAR_LEBEL
+	}
+	if n.StatTrak {
+		prefix += STAT_TRAK_LABEL
+	}
+	if n.Souvenir {
+		prefix += SOUVENIR_LABEL
+	}
+	return prefix
+}
+
+// BaseName returns the name without labels, exterior and phase, e.g. Karambit | Doppler
+func (n ItemName) BaseName() string {
+	if n.Skin == "" {
+		return n.Weapon
+	}
+	return n.Weapon + " | " + n.Skin
+}
+
+// MarketHashName returns the name without phase, e.g. ★ StatTrak™ Karambit | Doppler (Factory New)
+func (n ItemName) MarketHashName() string {
+	name := n.Prefix() + n.BaseName()
+	if n.Exterior != "" {
+		name += " (" + n.Exterior + ")"
+	}
+	return name
+}
+
+// String returns the market hash name with the phase suffix if any, the inverse of ParseItemName
+func (n ItemName) String() string {
+	if n.Phase == "" {
+		return n.MarketHashName()
+	}
+	return n.MarketHashName() + " - " + n.Phase
+}
+
+// HasPhases reports if the finish is priced by Doppler phase, e.g. Doppler & Gamma Doppler
+func (n ItemName) HasPhases() bool {
+	return strings.HasSuffix(n.Skin, "Doppler")
+}
@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestItemName_Parse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ItemName
+	}{
+		{
+			"AK-47 | Redline (Field-Tested)",
+			ItemName{Type: ITEM_TYPE_WEAPON, Weapon: "AK-47", Skin: "Redline", Exterior: "Field-Tested"},
+		},
+		{
+			"StatTrak™ M4A1-S | Chantico's Fire (Well-Worn)",
+			ItemName{StatTrak: true, Type: ITEM_TYPE_WEAPON, Weapon: "M4A1-S", Skin: "Chantico's Fire", Exterior: "Well-Worn"},
+		},
+		{
+			"Souvenir AWP | Dragon Lore (Factory New)",
+			ItemName{Souvenir: true, Type: ITEM_TYPE_WEAPON, Weapon: "AWP", Skin: "Dragon Lore", Exterior: "Factory New"},
+		},
+		{
+			"★ StatTrak™ Karambit | Doppler (Factory New)",
+			ItemName{Star: true, StatTrak: true, Type: ITEM_TYPE_KNIFE, Weapon: "Karambit", Skin: "Doppler", Exterior: "Factory New"},
+		},
+		{
+			"★ Karambit | Gamma Doppler (Minimal Wear) - Emerald",
+			ItemName{Star: true, Type: ITEM_TYPE_KNIFE, Weapon: "Karambit", Skin: "Gamma Doppler", Exterior: "Minimal Wear", Phase: PHASE_EMERALD},
+		},
+		{
+			"★ Karambit",
+			ItemName{Star: true, Type: ITEM_TYPE_KNIFE, Weapon: "Karambit"},
+		},
+		{
+			"★ Sport Gloves | Vice (Field-Tested)",
+			ItemName{Star: true, Type: ITEM_TYPE_GLOVES, Weapon: "Sport Gloves", Skin: "Vice", Exterior: "Field-Tested"},
+		},
+		{
+			"AK-47 | Redline",
+			ItemName{Type: ITEM_TYPE_WEAPON, Weapon: "AK-47", Skin: "Redline"},
+		},
+		{
+			"Sticker | Crown (Foil)",
+			ItemName{Type: ITEM_TYPE_STICKER, Weapon: "Sticker", Skin: "Crown (Foil)"},
+		},
+		{
+			"Sticker | Team Liquid (Holo) | Katowice 2019",
+			ItemName{Type: ITEM_TYPE_STICKER, Weapon: "Sticker", Skin: "Team Liquid (Holo) | Katowice 2019"},
+		},
+		{
+			"Sealed Graffiti | Lambda (Bazooka Pink)",
+			ItemName{Type: ITEM_TYPE_GRAFFITI, Weapon: "Sealed Graffiti", Skin: "Lambda (Bazooka Pink)"},
+		},
+		{
+			"StatTrak™ Music Kit | Daniel Sadowski, Crimson Assault",
+			ItemName{StatTrak: true, Type: ITEM_TYPE_MUSIC_KIT, Weapon: "Music Kit", Skin: "Daniel Sadowski, Crimson Assault"},
+		},
+		{
+			"Recoil Case",
+			ItemName{Type: ITEM_TYPE_CONTAINER, Weapon: "Recoil Case"},
+		},
+		{
+			"Sir Bloody Miami Darryl | The Professionals",
+			ItemName{Type: ITEM_TYPE_AGENT, Weapon: "Sir Bloody Miami Darryl", Skin: "The Professionals"},
+		},
+		{
+			"Name Tag",
+			ItemName{Type: ITEM_TYPE_OTHER, Weapon: "Name Tag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := ParseItemName(tt.input)
+			if got != tt.want {
+				t.Errorf("ParseItemName(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+			if got.String() != tt.input {
+				t.Errorf("Round trip of %q got %q", tt.input, got.String())
+			}
+		})
+	}
+}
+
+func TestItemName_Format(t *testing.T) {
+	itemName := ParseItemName("★ StatTrak™ Karambit | Doppler (Factory New) - Phase 2")
+
+	if itemName.BaseName() != "Karambit | Doppler" {
+		t.Errorf("Unexpected base name: %s", itemName.BaseName())
+	}
+
+	if itemName.MarketHashName() != "★ StatTrak™ Karambit | Doppler (Factory New)" {
+		t.Errorf("Unexpected market hash name: %s", itemName.MarketHashName())
+	}
+
+	if !itemName.HasPhases() || !ParseItemName("Glock-18 | Gamma Doppler (Factory New)").HasPhases() || ParseItemName("AK-47 | Redline (Field-Tested)").HasPhases() {
+		t.Errorf("Unexpected phased items")
+	}
+}
+
+func TestItemName_BuffIds(t *testing.T) {
+	if _, err := os.Stat(filepath.Join(sharedBasePath, BUFF_IDS_PATH)); err != nil {
+		t.Skipf("buff ids not available: %v", err)
+	}
+
+	for name := range GetBuffIds() {
+		itemName := ParseItemName(name)
+		if itemName.String() != name {
+			t.Errorf("Round trip of %q got %q", name, itemName.String())
+		}
+		if itemName.Type == ITEM_TYPE_WEAPON && itemName.Skin != "" && itemName.Exterior == "" {
+			t.Errorf("Weapon skin without exterior: %q", name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package shared
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+// How long a listing stays visible without being checked by the scrapers, and what happens after
+type StalenessPolicy struct {
+	// listings not checked within are stale, hidden from queries & alerts
+	MaxAge time.Duration
+	// stale listings not checked within are removed by the cleanup, 0 to keep them
+	RemoveAfter time.Duration
+	// one of STALE_ACTION_*
+	Action string
+}
+
+// market name -> policy, markets not in the map use DEFAULT_STALENESS_POLICY
+type StalenessPolicies map[string]StalenessPolicy
+
+var DEFAULT_STALENESS_POLICY = StalenessPolicy{
+	MaxAge:      6 * time.Hour,
+	RemoveAfter: 7 * 24 * time.Hour,
+	Action:      STALE_ACTION_ARCHIVE,
+}
+
+// Buff is scraped the most often, steam the least
+var DEFAULT_STALENESS_POLICIES = StalenessPolicies{
+	MARKET_NAME_BUFF:  {MaxAge: 2 * time.Hour, RemoveAfter: 7 * 24 * time.Hour, Action: STALE_ACTION_ARCHIVE},
+	MARKET_NAME_UU:    {MaxAge: 6 * time.Hour, RemoveAfter: 7 * 24 * time.Hour, Action: STALE_ACTION_ARCHIVE},
+	MARKET_NAME_IGXE:  {MaxAge: 6 * time.Hour, RemoveAfter: 7 * 24 * time.Hour, Action: STALE_ACTION_ARCHIVE},
+	MARKET_NAME_STEAM: {MaxAge: 24 * time.Hour, RemoveAfter: 14 * 24 * time.Hour, Action: STALE_ACTION_DELETE},
+}
+
+var (
+	stalenessPolicies   = DEFAULT_STALENESS_POLICIES
+	stalenessPoliciesMu sync.RWMutex
+)
+
+func SetStalenessPolicies(policies StalenessPolicies) {
+	stalenessPoliciesMu.Lock()
+	defer stalenessPoliciesMu.Unlock()
+	stalenessPolicies = policies
+}
+
+func GetStalenessPolicies() StalenessPolicies {
+	stalenessPoliciesMu.RLock()
+	defer stalenessPoliciesMu.RUnlock()
+	return stalenessPolicies
+}
+
+func GetStalenessPolicy(marketName string) StalenessPolicy {
+	if policy, ok := GetStalenessPolicies()[marketName]; ok {
+		return policy
+	}
+	return DEFAULT_STALENESS_POLICY
+}
+
+// IsListingStale checks if the listing was not checked within the max age of its market
+func IsListingStale(listing *model.Listing, now time.Time) bool {
+	return listing.CheckedAt.Add(GetStalenessPolicy(listing.Market).MaxAge).Before(now)
+}
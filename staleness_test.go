@@ -0,0 +1,35 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikezzb/steam-trading-shared/database/model"
+)
+
+func TestIsListingStale(t *testing.T) {
+	defer SetStalenessPolicies(GetStalenessPolicies())
+	SetStalenessPolicies(StalenessPolicies{
+		MARKET_NAME_BUFF: {MaxAge: time.Hour},
+	})
+
+	now := time.Now()
+	testCases := []struct {
+		market    string
+		checkedAt time.Time
+		stale     bool
+	}{
+		{MARKET_NAME_BUFF, now.Add(-30 * time.Minute), false},
+		{MARKET_NAME_BUFF, now.Add(-2 * time.Hour), true},
+		// default policy for the markets without one
+		{MARKET_NAME_UU, now.Add(-2 * time.Hour), false},
+		{MARKET_NAME_UU, now.Add(-DEFAULT_STALENESS_POLICY.MaxAge - time.Minute), true},
+	}
+
+	for _, tc := range testCases {
+		listing := &model.Listing{Market: tc.market, CheckedAt: tc.checkedAt}
+		if actual := IsListingStale(listing, now); actual != tc.stale {
+			t.Errorf("%s checked %v ago: expected stale %v, got %v", tc.market, now.Sub(tc.checkedAt), tc.stale, actual)
+		}
+	}
+}
@@ -1,14 +1,23 @@
 package subscription
 
 import (
+	"fmt"
 	"log"
 	"strconv"
+	"sync"
+	"time"
 
 	shared "github.com/mikezzb/steam-trading-shared"
 	"github.com/mikezzb/steam-trading-shared/database/model"
 	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Typical premium of a pattern tier over the base price of the item, e.g. 0.85 for +85%
+type PremiumProvider interface {
+	GetTierPremium(name, tier string) (float64, bool)
+}
+
 // Event emitter pattern
 type NotificationEmitter struct {
 	notifer *Notifier
@@ -17,8 +26,37 @@ type NotificationEmitter struct {
 	itemRaritySubs map[string]map[string]*ParsedSubscription
 	// item name + paint seed -> subscription key -> subscription
 	itemPaintSeedSubs map[string]map[string]*ParsedSubscription
+	// item name + phase -> subscription key -> subscription
+	itemPhaseSubs map[string]map[string]*ParsedSubscription
 	// item name -> min price of item
 	itemPrices map[string]float64
+	// item name + phase -> min price of the phase, phases are priced differently
+	itemPhasePrices map[string]float64
+
+	// resolves the linked channels of subscriptions
+	userRepo *repository.UserRepository
+	// counts notifications & cleans up expired subscriptions
+	subRepo *repository.SubscriptionRepository
+
+	templates *MessageTemplates
+	// optional, adds the typical premium of the tier to listing alerts
+	premiums PremiumProvider
+
+	// item id -> alert id -> item alert
+	itemAlerts map[string]map[string]*model.ItemAlert
+	// item ids in the favorites of any user
+	watchedItems map[string]bool
+	// item id -> last watchlist notification
+	watchlistNotifiedAt map[string]time.Time
+	// min move of the best price in 24h notified to the watchlist users, in percentage
+	WatchlistChangePerc float64
+	// saves the state of the item alerts
+	itemAlertRepo *repository.ItemAlertRepository
+	// best prices 24h ago for the price move alerts & the watchlist
+	priceHistoryRepo *repository.PriceHistoryRepository
+
+	// guards the maps above, as subscriptions may change during cleanup
+	mu sync.Mutex
 }
 
 func NewNotificationEmitter(config *NotifierConfig) *NotificationEmitter {
@@ -26,7 +64,15 @@ func NewNotificationEmitter(config *NotifierConfig) *NotificationEmitter {
 		notifer:           NewNotifier(config),
 		itemRaritySubs:    make(map[string]map[string]*ParsedSubscription),
 		itemPaintSeedSubs: make(map[string]map[string]*ParsedSubscription),
+		itemPhaseSubs:     make(map[string]map[string]*ParsedSubscription),
 		itemPrices:        make(map[string]float64),
+		itemPhasePrices:   make(map[string]float64),
+		templates:         DefaultMessageTemplates,
+
+		itemAlerts:          make(map[string]map[string]*model.ItemAlert),
+		watchedItems:        make(map[string]bool),
+		watchlistNotifiedAt: make(map[string]time.Time),
+		WatchlistChangePerc: DEFAULT_WATCHLIST_CHANGE_PERC,
 	}
 	return emitter
 }
@@ -34,8 +80,12 @@ func NewNotificationEmitter(config *NotifierConfig) *NotificationEmitter {
 func (e *NotificationEmitter) Init(repos repository.RepoFactory) {
 	subRepo := repos.GetSubscriptionRepository()
 	itemRepo := repos.GetItemRepository()
-	// get all subscriptions
-	subs, err := subRepo.GetAll()
+	e.userRepo = repos.GetUserRepository()
+	e.subRepo = subRepo
+	e.itemAlertRepo = repos.GetItemAlertRepository()
+	e.priceHistoryRepo = repos.GetPriceHistoryRepository()
+	// get all active subscriptions
+	subs, err := subRepo.GetAllActive()
 	if err != nil {
 		log.Fatalf("NotificationEmitter.Init: %v", err)
 		return
@@ -46,6 +96,22 @@ func (e *NotificationEmitter) Init(repos repository.RepoFactory) {
 		e.addSub(&sub)
 	}
 
+	// min prices of the subscribed phases
+	listingRepo := repos.GetListingRepository()
+	for _, sub := range subs {
+		if len(sub.Phases) == 0 {
+			continue
+		}
+		phasePrices, err := listingRepo.GetBestPricesByPhase(sub.Name)
+		if err != nil {
+			log.Printf("NotificationEmitter.Init: %v", err)
+			continue
+		}
+		for phase, price := range phasePrices {
+			e.itemPhasePrices[getItemPhaseKey(sub.Name, phase)] = price
+		}
+	}
+
 	// get all items
 	items, err := itemRepo.GetAll()
 	if err != nil {
@@ -57,38 +123,359 @@ func (e *NotificationEmitter) Init(repos repository.RepoFactory) {
 	for _, item := range items {
 		// get the lowest market price
 		bestPrice := shared.GetFreshBestPrice(&item, shared.FRESH_PRICE_DURATION)
-		priceFloat, _ := strconv.ParseFloat(bestPrice.Price.String(), 64)
+		if bestPrice == nil {
+			continue
+		}
+		// compared in the normalized currency
+		priceFloat, err := shared.NormalizePrice(bestPrice.Price, shared.GetItemPriceCurrency(&item, bestPrice))
+		if err != nil {
+			log.Printf("NotificationEmitter.Init: %s: %v", item.Name, err)
+			continue
+		}
 		e.itemPrices[item.Name] = priceFloat
 	}
+
+	// item alerts & the watchlist
+	alerts, err := e.itemAlertRepo.GetAllActive()
+	if err != nil {
+		log.Fatalf("NotificationEmitter.Init: %v", err)
+		return
+	}
+	for i := range alerts {
+		e.addItemAlert(&alerts[i])
+	}
+	if err := e.RefreshWatchlist(); err != nil {
+		log.Printf("NotificationEmitter.Init: %v", err)
+	}
 }
 
 func (e *NotificationEmitter) EmitListing(listing *model.Listing) {
-	key := getItemRarityKey(listing.Name, listing.Rarity)
+	e.EmitListingEvent(&model.ListingEvent{Type: shared.LISTING_EVENT_NEW, Listing: listing})
+}
+
+// EmitListingEvent notifies the subscriptions matching the listing of the event
+func (e *NotificationEmitter) EmitListingEvent(event *model.ListingEvent) {
+	listing := event.Listing
+	// a stale listing is likely gone from the market, listings without checkedAt are kept
+	if !listing.CheckedAt.IsZero() && shared.IsListingStale(listing, time.Now()) {
+		return
+	}
+
+	// only match under the lock, the targets & premiums may query the db
+	e.mu.Lock()
+	matches := e.matchListingSubs(event)
+	subs := make([]model.Subscription, len(matches))
+	for i, sub := range matches {
+		subs[i] = *sub
+	}
+	minPrice := e.itemPrices[listing.Name]
+	e.mu.Unlock()
+
+	// notiType/locale -> rendered message
+	messages := make(map[string]string)
+	for i := range subs {
+		if e.notifyListing(&subs[i], event, minPrice, messages) {
+			e.countNotification(matches[i])
+		}
+	}
+}
+
+// @return the active subscriptions matching the listing of the event, must hold the lock
+func (e *NotificationEmitter) matchListingSubs(event *model.ListingEvent) []*model.Subscription {
+	listing := event.Listing
+	now := time.Now()
+
+	var matches []*model.Subscription
+	// a sub can match by multiple keys, notify once
+	notified := make(map[string]bool)
+	match := func(sub *ParsedSubscription, isPriceMatch bool) {
+		if isPriceMatch && IsEventMatch(event, &sub.Subscription) && IsSubActive(&sub.Subscription, now) && !notified[GetSubKey(&sub.Subscription)] {
+			notified[GetSubKey(&sub.Subscription)] = true
+			matches = append(matches, &sub.Subscription)
+		}
+	}
+
+	// compared in the normalized currency
+	price := getNormalizedListingPrice(listing)
+
 	// find all subscriptions for this item & rarity
-	subs := e.itemRaritySubs[key]
-	var listingMessage string
-	for _, sub := range subs {
+	for _, sub := range e.itemRaritySubs[getItemRarityKey(listing.Name, listing.Rarity)] {
 		// check if price exceeds the subscription config
-		if e.IsPriceMatch(listing.Price.String(), sub) {
-			// notify user
-			if listingMessage == "" {
-				listingMessage = GetListingMessage(listing, e.itemPrices[listing.Name])
+		match(sub, e.IsPriceMatch(price, sub))
+	}
+
+	// find all subscriptions for this item & paint seed
+	for _, sub := range e.itemPaintSeedSubs[getItemPaintSeedKey(listing.Name, listing.PaintSeed)] {
+		match(sub, e.IsPriceMatch(price, sub))
+	}
+
+	// find all subscriptions for this item & phase, compared to the min price of the phase
+	phase := listing.Phase
+	if phase == "" {
+		phase = shared.GetDopplerPhase(listing.PaintIndex)
+	}
+	if phase == "" {
+		return matches
+	}
+	key := getItemPhaseKey(listing.Name, phase)
+	for _, sub := range e.itemPhaseSubs[key] {
+		match(sub, e.isPriceMatch(e.itemPhasePrices, key, price, sub))
+	}
+	return matches
+}
+
+// Set the provider of the tier premiums, e.g. analytics.PremiumEstimator
+func (e *NotificationEmitter) SetPremiumProvider(premiums PremiumProvider) {
+	e.premiums = premiums
+}
+
+// Set the message templates, e.g. to customize the layout of a notifier
+func (e *NotificationEmitter) SetTemplates(templates *MessageTemplates) {
+	e.templates = templates
+}
+
+// render the message once per notiType & locale
+func (e *NotificationEmitter) renderMessage(cache map[string]string, name string, target *NotiTarget, data interface{}) (string, error) {
+	key := target.NotiType + "/" + target.Locale
+	if message, ok := cache[key]; ok {
+		return message, nil
+	}
+
+	message, err := e.templates.Render(name, target.NotiType, target.Locale, data)
+	if err != nil {
+		return "", err
+	}
+	cache[key] = message
+	return message, nil
+}
+
+// @return true if the subscription is notified
+// @param minPrice min price of the item in the normalized currency
+func (e *NotificationEmitter) notifyListing(sub *model.Subscription, event *model.ListingEvent, minPrice float64, messages map[string]string) bool {
+	listing := event.Listing
+	target, err := e.getSubTarget(sub)
+	if err != nil {
+		log.Printf("NotificationEmitter.notifyListing: subscription %s: %v", sub.ID.Hex(), err)
+		return false
+	}
+
+	// show the min price in the currency of the listing
+	currency := shared.GetListingCurrency(listing)
+	converted, err := shared.ConvertAmount(minPrice, shared.NORMALIZED_CURRENCY, currency)
+	if err != nil {
+		converted, currency = minPrice, shared.NORMALIZED_CURRENCY
+	}
+
+	url := shared.GetListingUrl(listing)
+	data := &ListingMessageData{
+		Listing:  listing,
+		MinPrice: converted,
+		Currency: currency,
+		Url:      url,
+	}
+	if event.Type == shared.LISTING_EVENT_PRICE_DROP {
+		data.HasPriceDrop = true
+		data.PreviousPrice = event.Previous.Price
+		data.PriceChange = shared.GetPriceChange(event)
+	}
+	if e.premiums != nil && listing.Rarity != "" {
+		data.TierPremium, data.HasTierPremium = e.premiums.GetTierPremium(listing.Name, listing.Rarity)
+	}
+
+	message, err := e.renderMessage(messages, TEMPLATE_LISTING, target, data)
+	if err != nil {
+		log.Printf("NotificationEmitter.notifyListing: %v", err)
+		return false
+	}
+
+	e.notifer.NotifyAlert(target.NotiType, target.NotiId, &Alert{
+		Message: message,
+		SubId:   sub.ID,
+		Url:     url,
+	})
+	return true
+}
+
+// EmitAnomaly broadcasts the anomaly to the active subscriptions of the item, once per subscription
+func (e *NotificationEmitter) EmitAnomaly(anomaly *model.Anomaly) {
+	// only match under the lock, the targets may query the db
+	e.mu.Lock()
+	var subs []model.Subscription
+	notified := make(map[string]bool)
+	now := time.Now()
+	for _, subMap := range []map[string]map[string]*ParsedSubscription{e.itemRaritySubs, e.itemPaintSeedSubs, e.itemPhaseSubs} {
+		for _, subsByKey := range subMap {
+			for subKey, sub := range subsByKey {
+				if sub.Subscription.Name != anomaly.Name || notified[subKey] || !IsSubActive(&sub.Subscription, now) {
+					continue
+				}
+				notified[subKey] = true
+				subs = append(subs, sub.Subscription)
 			}
-			e.notifer.Notify(sub.Subscription.NotiType, sub.Subscription.NotiId, listingMessage)
 		}
 	}
+	e.mu.Unlock()
 
-	// find all subscriptions for this item & paint seed
-	key = getItemPaintSeedKey(listing.Name, listing.PaintSeed)
-	subs = e.itemPaintSeedSubs[key]
-	for _, sub := range subs {
-		if e.IsPriceMatch(listing.Price.String(), sub) {
-			if listingMessage == "" {
-				listingMessage = GetListingMessage(listing, e.itemPrices[listing.Name])
+	// notiType/locale -> rendered message
+	messages := make(map[string]string)
+	data := &AnomalyMessageData{
+		Anomaly:  anomaly,
+		Currency: shared.NORMALIZED_CURRENCY,
+	}
+	for i := range subs {
+		sub := &subs[i]
+		target, err := e.getSubTarget(sub)
+		if err != nil {
+			log.Printf("NotificationEmitter.EmitAnomaly: subscription %s: %v", sub.ID.Hex(), err)
+			continue
+		}
+		message, err := e.renderMessage(messages, TEMPLATE_ANOMALY, target, data)
+		if err != nil {
+			log.Printf("NotificationEmitter.EmitAnomaly: %v", err)
+			continue
+		}
+		// anomalies are not counted towards the max notifications
+		e.notifer.NotifyAlert(target.NotiType, target.NotiId, &Alert{
+			Message: message,
+			SubId:   sub.ID,
+		})
+	}
+}
+
+// count the notification, remove the subscription once reached the max notifications
+// @param sub the indexed subscription, must not hold the lock
+func (e *NotificationEmitter) countNotification(sub *model.Subscription) {
+	e.mu.Lock()
+	sub.NotificationCount++
+	id, maxNotifications := sub.ID, sub.MaxNotifications
+	e.mu.Unlock()
+
+	if e.subRepo == nil || maxNotifications <= 0 {
+		return
+	}
+
+	updatedSub, err := e.subRepo.IncrementNotificationCount(id)
+	if err != nil {
+		log.Printf("NotificationEmitter.countNotification: %v", err)
+		return
+	}
+
+	if !IsSubActive(updatedSub, time.Now()) {
+		e.mu.Lock()
+		e.DelSub(updatedSub)
+		e.mu.Unlock()
+	}
+}
+
+// Delete the expired subscriptions and notify their owners
+func (e *NotificationEmitter) CleanupExpiredSubs() {
+	if e.subRepo == nil {
+		return
+	}
+
+	// the repo triggers the delete handler of each sub, so no lock here
+	subs, err := e.subRepo.DeleteExpiredSubscriptions()
+	if err != nil {
+		log.Printf("NotificationEmitter.CleanupExpiredSubs: %v", err)
+		return
+	}
+
+	e.mu.Lock()
+	for i := range subs {
+		e.DelSub(&subs[i])
+	}
+	e.mu.Unlock()
+
+	for i := range subs {
+		target, err := e.getSubTarget(&subs[i])
+		if err != nil {
+			log.Printf("NotificationEmitter.CleanupExpiredSubs: subscription %s: %v", subs[i].ID.Hex(), err)
+			continue
+		}
+		message, err := e.templates.Render(TEMPLATE_SUB_EXPIRED, target.NotiType, target.Locale, &SubExpiredMessageData{
+			Subscription: &subs[i],
+		})
+		if err != nil {
+			log.Printf("NotificationEmitter.CleanupExpiredSubs: %v", err)
+			continue
+		}
+		e.notifer.Notify(target.NotiType, target.NotiId, message)
+	}
+}
+
+// Periodically clean up expired subscriptions until stop is called
+func (e *NotificationEmitter) StartCleanup(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				e.CleanupExpiredSubs()
+			case <-done:
+				ticker.Stop()
+				return
 			}
-			e.notifer.Notify(sub.Subscription.NotiType, sub.Subscription.NotiId, listingMessage)
 		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Where and how to notify a subscription
+type NotiTarget struct {
+	NotiType string
+	NotiId   string
+	Locale   string
+}
+
+// @return target of the subscription, resolving the linked channel and locale of the owner
+func (e *NotificationEmitter) getSubTarget(sub *model.Subscription) (*NotiTarget, error) {
+	return e.getNotiTarget(sub.NotiType, sub.NotiId, sub.OwnerId, sub.ChannelId)
+}
+
+// resolve the linked channel & locale of the owner
+func (e *NotificationEmitter) getNotiTarget(notiType, notiId string, ownerId, channelId primitive.ObjectID) (*NotiTarget, error) {
+	target := &NotiTarget{
+		NotiType: notiType,
+		NotiId:   notiId,
+		Locale:   shared.LOCALE_EN,
 	}
+	if e.userRepo == nil || ownerId.IsZero() {
+		return target, nil
+	}
+
+	owner, err := e.userRepo.GetUserById(ownerId)
+	if err != nil {
+		// the raw noti id still works without the owner
+		if channelId.IsZero() {
+			return target, nil
+		}
+		return nil, err
+	}
+
+	if owner.Locale != "" {
+		target.Locale = owner.Locale
+	}
+
+	if !channelId.IsZero() {
+		channel := getLinkedChannel(owner, channelId)
+		if channel == nil {
+			return nil, fmt.Errorf("linked channel %s not found", channelId.Hex())
+		}
+		target.NotiType, target.NotiId = channel.Type, channel.NotiId
+	}
+	return target, nil
+}
+
+func getLinkedChannel(user *model.User, channelId primitive.ObjectID) *model.LinkedChannel {
+	for i := range user.LinkedChannels {
+		if user.LinkedChannels[i].ID == channelId {
+			return &user.LinkedChannels[i]
+		}
+	}
+	return nil
 }
 
 func (e *NotificationEmitter) EmitListings(listings []model.Listing) {
@@ -101,8 +488,16 @@ func (e *NotificationEmitter) EmitListings(listings []model.Listing) {
 // when I create a parsed sub, the sub pointer is from the & of a range result, which got overwritten, so the pointer points to the same sub always
 
 func (e *NotificationEmitter) addSub(sub *model.Subscription) {
+	// paused or expired subscriptions are not indexed
+	if !IsSubActive(sub, time.Now()) {
+		return
+	}
 	subKey := GetSubKey(sub)
-	parsedSub := GetParsedSubscription(sub)
+	parsedSub, err := GetParsedSubscription(sub)
+	if err != nil {
+		log.Printf("NotificationEmitter.addSub: %v", err)
+		return
+	}
 	// add rarities
 	for _, rarity := range sub.Rarities {
 		key := getItemRarityKey(sub.Name, rarity)
@@ -123,6 +518,14 @@ func (e *NotificationEmitter) addSub(sub *model.Subscription) {
 		// add sub to the maps
 		e.itemPaintSeedSubs[key][subKey] = parsedSub
 	}
+	// add phases
+	for _, phase := range sub.Phases {
+		key := getItemPhaseKey(sub.Name, phase)
+		if _, ok := e.itemPhaseSubs[key]; !ok {
+			e.itemPhaseSubs[key] = make(map[string]*ParsedSubscription)
+		}
+		e.itemPhaseSubs[key][subKey] = parsedSub
+	}
 }
 
 func (e *NotificationEmitter) DelSub(sub *model.Subscription) {
@@ -136,6 +539,11 @@ func (e *NotificationEmitter) DelSub(sub *model.Subscription) {
 		subKey := GetSubKey(sub)
 		delete(e.itemPaintSeedSubs[key], subKey)
 	}
+	for _, phase := range sub.Phases {
+		key := getItemPhaseKey(sub.Name, phase)
+		subKey := GetSubKey(sub)
+		delete(e.itemPhaseSubs[key], subKey)
+	}
 }
 
 func (e *NotificationEmitter) UpdateSub(sub *model.Subscription) {
@@ -145,6 +553,10 @@ func (e *NotificationEmitter) UpdateSub(sub *model.Subscription) {
 
 func (e *NotificationEmitter) SubChangeStreamHandler(data interface{}, operationType string) {
 	sub, _ := data.(*model.Subscription)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	// Find the sub in the map
 	switch operationType {
 	case "insert":
@@ -158,26 +570,53 @@ func (e *NotificationEmitter) SubChangeStreamHandler(data interface{}, operation
 	}
 }
 
+// ListingChangeStreamHandler notifies the inserted & updated listings as new listings
+// Use either this or ListingEventHandler, both notify the same upserts
 func (e *NotificationEmitter) ListingChangeStreamHandler(data interface{}, operationType string) {
-	listing, _ := data.(*model.Listing)
+	listing, ok := data.(*model.Listing)
+	if !ok {
+		log.Printf("NotificationEmitter.ListingChangeStreamHandler: unknown data %T of %s", data, operationType)
+		return
+	}
 	switch operationType {
-	case "insert":
+	case "insert", "update":
 		e.EmitListing(listing)
 	case "delete":
 		// do nothing
-	case "update":
-		e.EmitListing(listing)
 	default:
-		log.Fatalf("NotificationEmitter.EmitListing: invalid operation type")
+		log.Printf("NotificationEmitter.ListingChangeStreamHandler: invalid operation type %s", operationType)
 	}
 }
+
+// ListingEventHandler notifies the listing events of the upserts, used as the listing event callback
+func (e *NotificationEmitter) ListingEventHandler(data interface{}, operationType string) {
+	event, ok := data.(*model.ListingEvent)
+	if !ok {
+		log.Printf("NotificationEmitter.ListingEventHandler: unknown data %T of %s", data, operationType)
+		return
+	}
+	e.EmitListingEvent(event)
+}
+func (e *NotificationEmitter) AnomalyChangeStreamHandler(data interface{}, operationType string) {
+	anomaly, ok := data.(*model.Anomaly)
+	if !ok || operationType != "insert" {
+		return
+	}
+	e.EmitAnomaly(anomaly)
+}
+
 func (e *NotificationEmitter) IsPriceMatch(price string, sub *ParsedSubscription) bool {
-	minPrice, ok := e.itemPrices[sub.Subscription.Name]
+	return e.isPriceMatch(e.itemPrices, sub.Subscription.Name, price, sub)
+}
+
+// check the price against the min price of the key in prices
+func (e *NotificationEmitter) isPriceMatch(prices map[string]float64, key string, price string, sub *ParsedSubscription) bool {
+	minPrice, ok := prices[key]
 	priceFloat, _ := strconv.ParseFloat(price, 64)
 
 	// if price is less than current min price, update item price
 	if priceFloat < minPrice || !ok {
-		e.itemPrices[sub.Subscription.Name] = priceFloat
+		prices[key] = priceFloat
 		return true
 	}
 
@@ -0,0 +1,345 @@
+package subscription
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Min time between two price move alerts, or two watchlist notifications of an item
+const ITEM_ALERT_COOLDOWN = 24 * time.Hour
+
+// Watchlist users are notified when the best price of their favorite items moves by this percentage in 24h
+const DEFAULT_WATCHLIST_CHANGE_PERC = 10
+
+// Best price of an item across markets, in the normalized currency
+type ItemPriceState struct {
+	Price  float64
+	Market string
+	// best price 24h ago, 0 if unknown
+	PriceAgo float64
+}
+
+// @return the price change in 24h, e.g. -0.1 for -10%, 0 if unknown
+func (s *ItemPriceState) GetChange() float64 {
+	if s.PriceAgo <= 0 {
+		return 0
+	}
+	return (s.Price - s.PriceAgo) / s.PriceAgo
+}
+
+// GetItemPriceState returns the fresh best price of the item, nil if none
+func GetItemPriceState(item *model.Item) *ItemPriceState {
+	bestPrice := shared.GetFreshBestPrice(item, shared.FRESH_PRICE_DURATION)
+	if bestPrice == nil {
+		return nil
+	}
+	price, err := shared.NormalizePrice(bestPrice.Price, shared.GetItemPriceCurrency(item, bestPrice))
+	if err != nil {
+		log.Printf("GetItemPriceState: %s: %v", item.Name, err)
+		return nil
+	}
+
+	state := &ItemPriceState{Price: price}
+	for _, market := range shared.ITEM_MARKET_NAMES {
+		if shared.GetMarketPrice(item, market) == bestPrice {
+			state.Market = market
+		}
+	}
+	return state
+}
+
+// IsItemAlertTriggered checks if the state crosses the condition of the alert since its last check
+// The first check triggers if the condition holds
+func IsItemAlertTriggered(alert *model.ItemAlert, state *ItemPriceState, now time.Time) bool {
+	switch alert.Type {
+	case shared.ITEM_ALERT_TYPE_PRICE_BELOW:
+		return state.Price <= alert.Threshold && (alert.LastPrice == 0 || alert.LastPrice > alert.Threshold)
+	case shared.ITEM_ALERT_TYPE_PRICE_ABOVE:
+		return state.Price >= alert.Threshold && (alert.LastPrice == 0 || alert.LastPrice < alert.Threshold)
+	case shared.ITEM_ALERT_TYPE_PRICE_MOVE:
+		if state.PriceAgo <= 0 || alert.ChangePerc <= 0 {
+			return false
+		}
+		if alert.LastTriggeredAt != nil && now.Sub(*alert.LastTriggeredAt) < ITEM_ALERT_COOLDOWN {
+			return false
+		}
+		return math.Abs(state.GetChange())*100 >= alert.ChangePerc
+	case shared.ITEM_ALERT_TYPE_CHEAPEST_MARKET:
+		return state.Market == alert.Market && alert.LastMarket != alert.Market
+	}
+	return false
+}
+
+// checks the item alerts & the watchlist of the updated item
+func (e *NotificationEmitter) EmitItem(item *model.Item) {
+	state := GetItemPriceState(item)
+	if state == nil {
+		return
+	}
+
+	e.mu.Lock()
+	alerts := make([]*model.ItemAlert, 0, len(e.itemAlerts[item.ID]))
+	watched := e.watchedItems[item.ID]
+	needsPriceAgo := watched
+	for _, alert := range e.itemAlerts[item.ID] {
+		alerts = append(alerts, alert)
+		needsPriceAgo = needsPriceAgo || alert.Type == shared.ITEM_ALERT_TYPE_PRICE_MOVE
+	}
+	e.mu.Unlock()
+
+	if len(alerts) == 0 && !watched {
+		return
+	}
+	if needsPriceAgo {
+		state.PriceAgo = e.getBestPriceAgo(item.Name)
+	}
+
+	now := time.Now()
+	for _, alert := range alerts {
+		e.checkItemAlert(alert, item, state, now)
+	}
+	if watched {
+		e.notifyWatchlist(item, state, now)
+	}
+}
+
+// @return best price of the item 24h ago in the normalized currency, 0 if unknown
+func (e *NotificationEmitter) getBestPriceAgo(name string) float64 {
+	if e.priceHistoryRepo == nil {
+		return 0
+	}
+
+	best := 0.0
+	for _, market := range shared.ITEM_MARKET_NAMES {
+		snapshot, err := e.priceHistoryRepo.GetPriceHoursAgo(name, market, 24)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			log.Printf("NotificationEmitter.getBestPriceAgo: %s: %v", name, err)
+			continue
+		}
+		currency := snapshot.Currency
+		if currency == "" {
+			currency = shared.GetMarketCurrency(market)
+		}
+		price, err := shared.NormalizePrice(snapshot.Price, currency)
+		if err != nil {
+			continue
+		}
+		if best == 0 || price < best {
+			best = price
+		}
+	}
+	return best
+}
+
+func (e *NotificationEmitter) checkItemAlert(alert *model.ItemAlert, item *model.Item, state *ItemPriceState, now time.Time) {
+	e.mu.Lock()
+	triggered := IsItemAlertTriggered(alert, state, now)
+	alert.LastPrice, alert.LastMarket = state.Price, state.Market
+	if triggered {
+		alert.LastTriggeredAt = &now
+	}
+	saved := *alert
+	e.mu.Unlock()
+
+	if e.itemAlertRepo != nil {
+		if err := e.itemAlertRepo.UpdateItemAlertState(&saved); err != nil {
+			log.Printf("NotificationEmitter.checkItemAlert: alert %s: %v", saved.ID.Hex(), err)
+		}
+	}
+	if !triggered {
+		return
+	}
+
+	target, err := e.getNotiTarget(saved.NotiType, saved.NotiId, saved.OwnerId, saved.ChannelId)
+	if err != nil {
+		log.Printf("NotificationEmitter.checkItemAlert: alert %s: %v", saved.ID.Hex(), err)
+		return
+	}
+	data := &ItemAlertMessageData{
+		Item:     item,
+		Alert:    &saved,
+		Price:    state.Price,
+		Market:   state.Market,
+		Change:   state.GetChange(),
+		Currency: shared.NORMALIZED_CURRENCY,
+	}
+	message, err := e.templates.Render(TEMPLATE_ITEM_ALERT, target.NotiType, target.Locale, data)
+	if err != nil {
+		log.Printf("NotificationEmitter.checkItemAlert: %v", err)
+		return
+	}
+	e.notifer.Notify(target.NotiType, target.NotiId, message)
+}
+
+// notify the users with the item in their favorites if the best price moved enough in 24h
+func (e *NotificationEmitter) notifyWatchlist(item *model.Item, state *ItemPriceState, now time.Time) {
+	if math.Abs(state.GetChange())*100 < e.WatchlistChangePerc || e.userRepo == nil {
+		return
+	}
+
+	e.mu.Lock()
+	notifiedAt, ok := e.watchlistNotifiedAt[item.ID]
+	e.mu.Unlock()
+	if ok && now.Sub(notifiedAt) < ITEM_ALERT_COOLDOWN {
+		return
+	}
+
+	users, err := e.userRepo.GetUsersByFavItemId(item.ID)
+	if err != nil {
+		log.Printf("NotificationEmitter.notifyWatchlist: %s: %v", item.Name, err)
+		return
+	}
+
+	// notiType/locale -> rendered message
+	messages := make(map[string]string)
+	data := &ItemAlertMessageData{
+		Item:     item,
+		Price:    state.Price,
+		Market:   state.Market,
+		Change:   state.GetChange(),
+		Currency: shared.NORMALIZED_CURRENCY,
+	}
+	sent := 0
+	for i := range users {
+		user := &users[i]
+		// users are notified on their first linked channel
+		if len(user.LinkedChannels) == 0 {
+			continue
+		}
+		target := &NotiTarget{
+			NotiType: user.LinkedChannels[0].Type,
+			NotiId:   user.LinkedChannels[0].NotiId,
+			Locale:   shared.LOCALE_EN,
+		}
+		if user.Locale != "" {
+			target.Locale = user.Locale
+		}
+
+		message, err := e.renderMessage(messages, TEMPLATE_WATCHLIST, target, data)
+		if err != nil {
+			log.Printf("NotificationEmitter.notifyWatchlist: %v", err)
+			continue
+		}
+		e.notifer.Notify(target.NotiType, target.NotiId, message)
+		sent++
+	}
+
+	// the cooldown starts once notified
+	if sent > 0 {
+		e.mu.Lock()
+		e.watchlistNotifiedAt[item.ID] = now
+		e.mu.Unlock()
+	}
+}
+
+func (e *NotificationEmitter) addItemAlert(alert *model.ItemAlert) {
+	if alert.Disabled {
+		return
+	}
+	if _, ok := e.itemAlerts[alert.ItemId]; !ok {
+		e.itemAlerts[alert.ItemId] = make(map[string]*model.ItemAlert)
+	}
+	e.itemAlerts[alert.ItemId][alert.ID.Hex()] = alert
+}
+
+func (e *NotificationEmitter) delItemAlert(alert *model.ItemAlert) {
+	delete(e.itemAlerts[alert.ItemId], alert.ID.Hex())
+	if len(e.itemAlerts[alert.ItemId]) == 0 {
+		delete(e.itemAlerts, alert.ItemId)
+	}
+}
+
+// RefreshWatchlist reloads the items in the favorites of the users
+func (e *NotificationEmitter) RefreshWatchlist() error {
+	if e.userRepo == nil {
+		return nil
+	}
+	itemIds, err := e.userRepo.GetAllFavItemIds()
+	if err != nil {
+		return err
+	}
+
+	watchedItems := make(map[string]bool, len(itemIds))
+	for _, itemId := range itemIds {
+		watchedItems[itemId] = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.watchedItems = watchedItems
+	return nil
+}
+
+// UserChangeStreamHandler keeps the watchlist in sync with the favorites, used as the user repository callback
+func (e *NotificationEmitter) UserChangeStreamHandler(data interface{}, operationType string) {
+	change, ok := data.(*model.FavItemChange)
+	if !ok {
+		return
+	}
+
+	switch operationType {
+	case "insert":
+		e.mu.Lock()
+		e.watchedItems[change.ItemId] = true
+		e.mu.Unlock()
+	case "delete":
+		// other users may still watch the item
+		if e.userRepo == nil {
+			return
+		}
+		users, err := e.userRepo.GetUsersByFavItemId(change.ItemId)
+		if err != nil {
+			log.Printf("NotificationEmitter.UserChangeStreamHandler: %s: %v", change.ItemId, err)
+			return
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if len(users) == 0 {
+			delete(e.watchedItems, change.ItemId)
+		} else {
+			e.watchedItems[change.ItemId] = true
+		}
+	default:
+		log.Printf("NotificationEmitter.UserChangeStreamHandler: invalid operation type %s", operationType)
+	}
+}
+
+func (e *NotificationEmitter) ItemAlertChangeStreamHandler(data interface{}, operationType string) {
+	alert, ok := data.(*model.ItemAlert)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch operationType {
+	case "insert":
+		e.addItemAlert(alert)
+	case "delete":
+		e.delItemAlert(alert)
+	case "update":
+		e.delItemAlert(alert)
+		e.addItemAlert(alert)
+	default:
+		log.Printf("NotificationEmitter.ItemAlertChangeStreamHandler: invalid operation type %s", operationType)
+	}
+}
+
+// ItemChangeStreamHandler checks the updated item, used as the item repository callback
+func (e *NotificationEmitter) ItemChangeStreamHandler(data interface{}, operationType string) {
+	item, ok := data.(*model.Item)
+	if !ok || operationType == "delete" {
+		return
+	}
+	e.EmitItem(item)
+}
@@ -0,0 +1,106 @@
+package subscription_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/subscription"
+)
+
+func TestIsItemAlertTriggered(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Hour)
+
+	below := model.ItemAlert{Type: shared.ITEM_ALERT_TYPE_PRICE_BELOW, Threshold: 100}
+	above := model.ItemAlert{Type: shared.ITEM_ALERT_TYPE_PRICE_ABOVE, Threshold: 100}
+	move := model.ItemAlert{Type: shared.ITEM_ALERT_TYPE_PRICE_MOVE, ChangePerc: 10}
+	cheapest := model.ItemAlert{Type: shared.ITEM_ALERT_TYPE_CHEAPEST_MARKET, Market: shared.MARKET_NAME_UU}
+
+	withLast := func(alert model.ItemAlert, price float64, market string) model.ItemAlert {
+		alert.LastPrice, alert.LastMarket = price, market
+		return alert
+	}
+	withTriggered := func(alert model.ItemAlert, at *time.Time) model.ItemAlert {
+		alert.LastTriggeredAt = at
+		return alert
+	}
+
+	tests := []struct {
+		name  string
+		alert model.ItemAlert
+		state subscription.ItemPriceState
+		want  bool
+	}{
+		{"Below on first check", below, subscription.ItemPriceState{Price: 90}, true},
+		{"Crosses below", withLast(below, 110, ""), subscription.ItemPriceState{Price: 90}, true},
+		{"Stays below", withLast(below, 95, ""), subscription.ItemPriceState{Price: 90}, false},
+		{"Above threshold of below", withLast(below, 110, ""), subscription.ItemPriceState{Price: 105}, false},
+		{"Crosses above", withLast(above, 90, ""), subscription.ItemPriceState{Price: 110}, true},
+		{"Moves down", move, subscription.ItemPriceState{Price: 85, PriceAgo: 100}, true},
+		{"Moves up", move, subscription.ItemPriceState{Price: 112, PriceAgo: 100}, true},
+		{"Moves little", move, subscription.ItemPriceState{Price: 95, PriceAgo: 100}, false},
+		{"Move unknown", move, subscription.ItemPriceState{Price: 85}, false},
+		{"Move in cooldown", withTriggered(move, &recent), subscription.ItemPriceState{Price: 85, PriceAgo: 100}, false},
+		{"Becomes cheapest", withLast(cheapest, 100, shared.MARKET_NAME_BUFF), subscription.ItemPriceState{Price: 90, Market: shared.MARKET_NAME_UU}, true},
+		{"Stays cheapest", withLast(cheapest, 100, shared.MARKET_NAME_UU), subscription.ItemPriceState{Price: 90, Market: shared.MARKET_NAME_UU}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subscription.IsItemAlertTriggered(&tt.alert, &tt.state, now); got != tt.want {
+				t.Errorf("IsItemAlertTriggered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetItemPriceState(t *testing.T) {
+	now := time.Now()
+	item := &model.Item{
+		Name:      "AK-47 | Redline (Field-Tested)",
+		BuffPrice: &model.MarketPrice{Price: shared.GetDecimal128("100"), UpdatedAt: now},
+		UUPrice:   &model.MarketPrice{Price: shared.GetDecimal128("95"), UpdatedAt: now},
+		// stale prices are ignored
+		IgxePrice: &model.MarketPrice{Price: shared.GetDecimal128("50"), UpdatedAt: now.Add(-2 * shared.FRESH_PRICE_DURATION)},
+	}
+
+	state := subscription.GetItemPriceState(item)
+	if state == nil || state.Price != 95 || state.Market != shared.MARKET_NAME_UU {
+		t.Errorf("Expected the uu price, got %v", state)
+	}
+	if subscription.GetItemPriceState(&model.Item{}) != nil {
+		t.Error("Expected no state without prices")
+	}
+}
+
+func TestMessageTemplates_ItemAlert(t *testing.T) {
+	templates := subscription.NewMessageTemplates()
+	data := &subscription.ItemAlertMessageData{
+		Item:     &model.Item{Name: "AK-47 | Redline (Field-Tested)"},
+		Alert:    &model.ItemAlert{Type: shared.ITEM_ALERT_TYPE_PRICE_BELOW, Threshold: 100},
+		Price:    95,
+		Market:   shared.MARKET_NAME_UU,
+		Change:   -0.12,
+		Currency: shared.CURRENCY_CNY,
+	}
+
+	actual, err := templates.Render(subscription.TEMPLATE_ITEM_ALERT, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(actual, "\nBest price ¥95.00 on uu is below ¥100.00") {
+		t.Errorf("Unexpected item alert: %q", actual)
+	}
+
+	data.Alert = nil
+	actual, err = templates.Render(subscription.TEMPLATE_WATCHLIST, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(actual, "\nBest price moved -12% in 24h to ¥95.00 on uu") {
+		t.Errorf("Unexpected watchlist message: %q", actual)
+	}
+}
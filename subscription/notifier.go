@@ -1,11 +1,30 @@
 package subscription
 
-import "log"
+import (
+	"log"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type BaseNotifier interface {
 	Notify(notiId string, message string)
 }
 
+// Alert of a subscription, notifiers may render actions on it
+type Alert struct {
+	Message string
+	// subscription that triggers the alert
+	SubId primitive.ObjectID
+	// Optional, link to the listing
+	Url string
+}
+
+// Notifiers that can render actions on alerts, e.g. buttons
+type AlertNotifier interface {
+	NotifyAlert(notiId string, alert *Alert)
+}
+
 type Notifier struct {
 	// notiType -> Notifier
 	notifiers map[string]BaseNotifier
@@ -20,13 +39,32 @@ func (n *Notifier) Notify(notiType, notiId string, message string) {
 	notifier.Notify(notiId, message)
 }
 
+// Notify an alert, fallback to plain message if the notifier cannot render alerts
+func (n *Notifier) NotifyAlert(notiType, notiId string, alert *Alert) {
+	log.Printf("Notifier.NotifyAlert: %s %s %s", notiType, notiId, alert.Message)
+	notifier, ok := n.notifiers[notiType]
+	if !ok {
+		return
+	}
+	if alertNotifier, ok := notifier.(AlertNotifier); ok {
+		alertNotifier.NotifyAlert(notiId, alert)
+		return
+	}
+	notifier.Notify(notiId, alert.Message)
+}
+
+// @return the notifier of notiType, nil if not configured
+func (n *Notifier) GetNotifier(notiType string) BaseNotifier {
+	return n.notifiers[notiType]
+}
+
 type NotifierConfig struct {
 	TelegramToken string
 }
 
 func NewNotifier(config *NotifierConfig) *Notifier {
 	notifiers := make(map[string]BaseNotifier)
-	notifiers["telegram"] = NewTelegramNotifier(config.TelegramToken)
+	notifiers[shared.NOTI_TYPE_TELEGRAM] = NewTelegramNotifier(config.TelegramToken)
 	return &Notifier{
 		notifiers: notifiers,
 	}
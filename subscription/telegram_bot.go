@@ -0,0 +1,329 @@
+package subscription
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const TELEGRAM_BOT_HELP = `Commands:
+/subs - list your subscriptions
+/add <item> <tier|seed|phase> <premium> - subscribe, e.g. /add "★ Bayonet | Marble Fade (Factory New)" FFI 5%
+/pause <#|id> - pause a subscription
+/resume <#|id> - resume a subscription
+/del <#|id> - delete a subscription
+/price <item> - show the market prices of an item`
+
+// Manages the subscriptions of linked users from Telegram chats
+type TelegramBot struct {
+	notifier *TelegramNotifier
+	userRepo *repository.UserRepository
+	subRepo  *repository.SubscriptionRepository
+	itemRepo *repository.ItemRepository
+}
+
+func NewTelegramBot(notifier *TelegramNotifier, repos repository.RepoFactory) *TelegramBot {
+	return &TelegramBot{
+		notifier: notifier,
+		userRepo: repos.GetUserRepository(),
+		subRepo:  repos.GetSubscriptionRepository(),
+		itemRepo: repos.GetItemRepository(),
+	}
+}
+
+// SplitCommand splits a message into the command and its arguments, double quoted arguments can contain spaces
+func SplitCommand(text string) (string, []string) {
+	var args []string
+	var current strings.Builder
+	inQuote, hasArg := false, false
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasArg = true
+		case r == ' ' && !inQuote:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+
+	if len(args) == 0 || !strings.HasPrefix(args[0], "/") {
+		return "", args
+	}
+	// in groups, the command can be suffixed with the bot name, e.g. /subs@bot
+	command, _, _ := strings.Cut(args[0], "@")
+	return command, args[1:]
+}
+
+// ParseAddArgs parses the arguments of /add, the item name is everything before the tier and premium
+// @return item name, tier, premium, error
+func ParseAddArgs(args []string) (string, string, string, error) {
+	if len(args) < 3 {
+		return "", "", "", fmt.Errorf("usage: /add <item> <tier|seed> <premium>")
+	}
+
+	n := len(args)
+	name := strings.Join(args[:n-2], " ")
+	tier, premium := args[n-2], args[n-1]
+
+	if _, _, err := ParsePremium(premium); err != nil {
+		return "", "", "", fmt.Errorf("invalid premium %q, e.g. 5%% or 100", premium)
+	}
+	return name, tier, premium, nil
+}
+
+func (b *TelegramBot) HandleUpdate(update *tgbotapi.Update) bool {
+	if update.CallbackQuery != nil {
+		return b.handleCallback(update.CallbackQuery)
+	}
+
+	if update.Message == nil {
+		return false
+	}
+
+	command, args := SplitCommand(update.Message.Text)
+	if command == "" {
+		return false
+	}
+
+	chatId := update.Message.Chat.ID
+	user, err := b.userRepo.GetUserByLinkedChannel(shared.NOTI_TYPE_TELEGRAM, strconv.FormatInt(chatId, 10))
+	if err != nil {
+		b.notifier.Reply(chatId, "Please link this chat to your account first.")
+		return true
+	}
+
+	var reply string
+	switch command {
+	case "/subs":
+		reply, err = b.listSubs(user)
+	case "/add":
+		reply, err = b.addSub(user, chatId, args)
+	case "/pause":
+		reply, err = b.setSubDisabled(user, args, true)
+	case "/resume":
+		reply, err = b.setSubDisabled(user, args, false)
+	case "/del":
+		reply, err = b.delSub(user, args)
+	case "/price":
+		reply, err = b.getPrice(args)
+	default:
+		reply = TELEGRAM_BOT_HELP
+	}
+
+	if err != nil {
+		log.Printf("TelegramBot.HandleUpdate: %s: %v", command, err)
+		reply = "❌ " + err.Error()
+	}
+	b.notifier.Reply(chatId, reply)
+	return true
+}
+
+func (b *TelegramBot) handleCallback(query *tgbotapi.CallbackQuery) bool {
+	hexId, ok := strings.CutPrefix(query.Data, TELEGRAM_CALLBACK_MUTE)
+	if !ok || query.Message == nil {
+		return false
+	}
+
+	subId, err := primitive.ObjectIDFromHex(hexId)
+	if err != nil {
+		b.notifier.AnswerCallback(query.ID, "Invalid subscription")
+		return true
+	}
+
+	user, err := b.userRepo.GetUserByLinkedChannel(shared.NOTI_TYPE_TELEGRAM, strconv.FormatInt(query.Message.Chat.ID, 10))
+	if err != nil {
+		b.notifier.AnswerCallback(query.ID, "Please link this chat to your account first")
+		return true
+	}
+
+	if _, err := b.subRepo.SetSubscriptionDisabled(subId, user.ID, true); err != nil {
+		log.Printf("TelegramBot.handleCallback: %v", err)
+		b.notifier.AnswerCallback(query.ID, "Subscription not found")
+		return true
+	}
+
+	b.notifier.AnswerCallback(query.ID, "🔕 Muted, /resume to enable again")
+	return true
+}
+
+func (b *TelegramBot) listSubs(user *model.User) (string, error) {
+	subs, err := b.subRepo.GetAllByOwnerId(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(subs) == 0 {
+		return "No subscriptions yet, /add to subscribe.", nil
+	}
+
+	var sb strings.Builder
+	for i, sub := range subs {
+		status := "🔔"
+		if sub.Disabled {
+			status = "⏸"
+		}
+		fmt.Fprintf(&sb, "%d. %s %s\n", i+1, status, sub.Name)
+		if len(sub.Rarities) > 0 {
+			fmt.Fprintf(&sb, "   Tiers: %s\n", strings.Join(sub.Rarities, ", "))
+		}
+		if len(sub.PaintSeeds) > 0 {
+			fmt.Fprintf(&sb, "   Seeds: %v\n", sub.PaintSeeds)
+		}
+		if sub.ExpiresAt != nil {
+			fmt.Fprintf(&sb, "   Expires: %s\n", sub.ExpiresAt.Format("2006-01-02 15:04"))
+		}
+		if sub.MaxNotifications > 0 {
+			fmt.Fprintf(&sb, "   Notified: %d/%d\n", sub.NotificationCount, sub.MaxNotifications)
+		}
+		fmt.Fprintf(&sb, "   Premium: %s\n   ID: %s\n", sub.MaxPremium, sub.ID.Hex())
+	}
+	return sb.String(), nil
+}
+
+func (b *TelegramBot) addSub(user *model.User, chatId int64, args []string) (string, error) {
+	name, tier, premium, err := ParseAddArgs(args)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := b.itemRepo.FindItemByName(name); err != nil {
+		return "", fmt.Errorf("item %q not found", name)
+	}
+
+	notiId := strconv.FormatInt(chatId, 10)
+	sub := &model.Subscription{
+		Name:       name,
+		MaxPremium: premium,
+		NotiType:   shared.NOTI_TYPE_TELEGRAM,
+		NotiId:     notiId,
+		OwnerId:    user.ID,
+	}
+
+	// reference the linked channel of this chat
+	for _, channel := range user.LinkedChannels {
+		if channel.Type == shared.NOTI_TYPE_TELEGRAM && channel.NotiId == notiId {
+			sub.ChannelId = channel.ID
+			break
+		}
+	}
+
+	// numeric tier is a paint seed, Doppler phases are matched by phase
+	if seed, err := strconv.Atoi(tier); err == nil {
+		sub.PaintSeeds = []int{seed}
+	} else if slices.Contains(shared.DOPPLER_PHASES, tier) {
+		sub.Phases = []string{tier}
+	} else if tiers := shared.GetItemTiers(name); slices.Contains(tiers, tier) {
+		sub.Rarities = []string{tier}
+	} else if len(tiers) == 0 {
+		return "", fmt.Errorf("%s has no tiers, subscribe by seed or phase", name)
+	} else {
+		return "", fmt.Errorf("unknown tier %q of %s, tiers: %s", tier, name, strings.Join(tiers, ", "))
+	}
+
+	id, err := b.subRepo.InsertSubscription(sub)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✅ Subscribed to %s (%s, max premium %s)\nID: %s", name, tier, premium, id.Hex()), nil
+}
+
+func (b *TelegramBot) setSubDisabled(user *model.User, args []string, disabled bool) (string, error) {
+	sub, err := b.findUserSub(user, args)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := b.subRepo.SetSubscriptionDisabled(sub.ID, user.ID, disabled); err != nil {
+		return "", err
+	}
+
+	if disabled {
+		return "⏸ Paused " + sub.Name, nil
+	}
+	return "🔔 Resumed " + sub.Name, nil
+}
+
+func (b *TelegramBot) delSub(user *model.User, args []string) (string, error) {
+	sub, err := b.findUserSub(user, args)
+	if err != nil {
+		return "", err
+	}
+
+	if err := b.subRepo.DeleteSubscriptionById(sub.ID, user.ID); err != nil {
+		return "", err
+	}
+	return "🗑 Deleted " + sub.Name, nil
+}
+
+// find the subscription of the user by the # in /subs or its id
+func (b *TelegramBot) findUserSub(user *model.User, args []string) (*model.Subscription, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("please specify the # or id of the subscription, see /subs")
+	}
+
+	subs, err := b.subRepo.GetAllByOwnerId(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if index, err := strconv.Atoi(args[0]); err == nil {
+		if index < 1 || index > len(subs) {
+			return nil, fmt.Errorf("subscription #%d not found", index)
+		}
+		return &subs[index-1], nil
+	}
+
+	for i := range subs {
+		if subs[i].ID.Hex() == args[0] {
+			return &subs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("subscription %s not found", args[0])
+}
+
+func (b *TelegramBot) getPrice(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /price <item>")
+	}
+
+	name := strings.Join(args, " ")
+	item, err := b.itemRepo.FindItemByName(name)
+	if err != nil {
+		return "", fmt.Errorf("item %q not found", name)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "💰 %s\n", item.Name)
+	for _, marketName := range shared.ITEM_MARKET_NAMES {
+		price := shared.GetMarketPrice(item, marketName)
+		if price == nil {
+			continue
+		}
+		formatted := shared.FormatPrice(shared.DecToFloat(price.Price), shared.GetMarketPriceCurrency(price, marketName))
+		fmt.Fprintf(&sb, "%s: %s (%s)\n", marketName, formatted, price.UpdatedAt.Format("2006-01-02 15:04"))
+	}
+
+	if bestPrice := shared.GetFreshBestPrice(item, shared.FRESH_PRICE_DURATION); bestPrice != nil {
+		fmt.Fprintf(&sb, "Best: %s", shared.FormatPrice(shared.DecToFloat(bestPrice.Price), shared.GetItemPriceCurrency(item, bestPrice)))
+	}
+	return sb.String(), nil
+}
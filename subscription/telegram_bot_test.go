@@ -0,0 +1,57 @@
+package subscription_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mikezzb/steam-trading-shared/subscription"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		input       string
+		wantCommand string
+		wantArgs    []string
+	}{
+		{"/subs", "/subs", []string{}},
+		{"/pause@steam_bot 2", "/pause", []string{"2"}},
+		{
+			`/add "★ Bayonet | Marble Fade (Factory New)" FFI 5%`,
+			"/add",
+			[]string{"★ Bayonet | Marble Fade (Factory New)", "FFI", "5%"},
+		},
+		{
+			`/add ★ Karambit | Doppler (Factory New) "Good Phase 2" 100`,
+			"/add",
+			[]string{"★", "Karambit", "|", "Doppler", "(Factory", "New)", "Good Phase 2", "100"},
+		},
+		{"hello world", "", []string{"hello", "world"}},
+	}
+
+	for _, tt := range tests {
+		command, args := subscription.SplitCommand(tt.input)
+		if command != tt.wantCommand || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("SplitCommand(%q) = %q, %q; want %q, %q", tt.input, command, args, tt.wantCommand, tt.wantArgs)
+		}
+	}
+}
+
+func TestParseAddArgs(t *testing.T) {
+	_, args := subscription.SplitCommand(`/add ★ Karambit | Doppler (Factory New) "Good Phase 2" 100`)
+	name, tier, premium, err := subscription.ParseAddArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "★ Karambit | Doppler (Factory New)" || tier != "Good Phase 2" || premium != "100" {
+		t.Errorf("Unexpected parsed args: %q, %q, %q", name, tier, premium)
+	}
+
+	if _, _, _, err := subscription.ParseAddArgs([]string{"AK-47 | Redline (Field-Tested)", "FFI", "abc"}); err == nil {
+		t.Errorf("Expected invalid premium error")
+	}
+
+	if _, _, _, err := subscription.ParseAddArgs([]string{"FFI", "5%"}); err == nil {
+		t.Errorf("Expected usage error")
+	}
+}
@@ -0,0 +1,93 @@
+package subscription
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/database/repository"
+)
+
+// Links Telegram chats to users by consuming the `/start <code>` deep links
+type TelegramLinker struct {
+	notifier     *TelegramNotifier
+	userRepo     *repository.UserRepository
+	linkCodeRepo *repository.LinkCodeRepository
+}
+
+func NewTelegramLinker(notifier *TelegramNotifier, repos repository.RepoFactory) *TelegramLinker {
+	return &TelegramLinker{
+		notifier:     notifier,
+		userRepo:     repos.GetUserRepository(),
+		linkCodeRepo: repos.GetLinkCodeRepository(),
+	}
+}
+
+// ParseStartCode extracts the link code from a `/start <code>` message
+func ParseStartCode(text string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return "", false
+	}
+	// in groups, the command can be suffixed with the bot name, e.g. /start@bot
+	command, _, _ := strings.Cut(fields[0], "@")
+	if command != "/start" {
+		return "", false
+	}
+	return strings.ToUpper(fields[1]), true
+}
+
+func (l *TelegramLinker) HandleUpdate(update *tgbotapi.Update) bool {
+	if update.Message == nil {
+		return false
+	}
+
+	code, ok := ParseStartCode(update.Message.Text)
+	if !ok {
+		return false
+	}
+
+	chatId := update.Message.Chat.ID
+	channel, err := l.Link(code, chatId, getTelegramChatName(update.Message.Chat))
+	if err != nil {
+		log.Printf("TelegramLinker.HandleUpdate: %v", err)
+		if err == repository.ErrInvalidLinkCode {
+			l.notifier.Reply(chatId, "❌ Invalid or expired link code, please generate a new one.")
+		} else {
+			l.notifier.Reply(chatId, "❌ Failed to link this chat, please try again later.")
+		}
+		return true
+	}
+
+	l.notifier.Reply(chatId, "✅ This chat is linked to your account, alerts of subscriptions on this channel will be sent here.")
+	log.Printf("TelegramLinker: linked chat %s to channel %s", channel.NotiId, channel.ID.Hex())
+	return true
+}
+
+// Consume the code and link the chat to its user
+func (l *TelegramLinker) Link(code string, chatId int64, name string) (*model.LinkedChannel, error) {
+	linkCode, err := l.linkCodeRepo.ConsumeLinkCode(code, shared.NOTI_TYPE_TELEGRAM)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := &model.LinkedChannel{
+		Type:   shared.NOTI_TYPE_TELEGRAM,
+		NotiId: strconv.FormatInt(chatId, 10),
+		Name:   name,
+	}
+	if err := l.userRepo.AddLinkedChannel(linkCode.UserId, channel); err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+func getTelegramChatName(chat *tgbotapi.Chat) string {
+	if chat.UserName != "" {
+		return chat.UserName
+	}
+	return chat.Title
+}
@@ -0,0 +1,29 @@
+package subscription_test
+
+import (
+	"testing"
+
+	"github.com/mikezzb/steam-trading-shared/subscription"
+)
+
+func TestParseStartCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantCode string
+		wantOk   bool
+	}{
+		{"/start ABCD2345", "ABCD2345", true},
+		{"/start abcd2345", "ABCD2345", true},
+		{"/start@steam_bot ABCD2345", "ABCD2345", true},
+		{"/start", "", false},
+		{"/subs ABCD2345", "", false},
+		{"hello", "", false},
+	}
+
+	for _, tt := range tests {
+		code, ok := subscription.ParseStartCode(tt.input)
+		if code != tt.wantCode || ok != tt.wantOk {
+			t.Errorf("ParseStartCode(%q) = %q, %v; want %q, %v", tt.input, code, ok, tt.wantCode, tt.wantOk)
+		}
+	}
+}
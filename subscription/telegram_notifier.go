@@ -22,8 +22,13 @@ type TelegramNotifier struct {
 type NotiReq struct {
 	ChatId  int64
 	Message string
+	// Optional, e.g. inline keyboard
+	ReplyMarkup interface{}
 }
 
+// callback data prefix of the mute button on alerts
+const TELEGRAM_CALLBACK_MUTE = "mute:"
+
 func NewTelegramNotifier(token string) *TelegramNotifier {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
@@ -46,20 +51,23 @@ func (t *TelegramNotifier) processNotifications() {
 	for range limiter.C {
 		select {
 		case req := <-t.notiCh:
-			t.sendMessage(req.ChatId, req.Message)
+			t.sendMessage(&req)
 		default:
 		}
 	}
 }
 
-func (t *TelegramNotifier) sendMessage(chatId int64, message string) {
+func (t *TelegramNotifier) sendMessage(req *NotiReq) {
 	msg := tgbotapi.NewMessage(
-		chatId,
-		message,
+		req.ChatId,
+		req.Message,
 	)
+	if req.ReplyMarkup != nil {
+		msg.ReplyMarkup = req.ReplyMarkup
+	}
 	_, err := t.bot.Send(msg)
 	if err != nil {
-		log.Fatalf("sendMessage: %v", err)
+		log.Printf("sendMessage: %v", err)
 	}
 }
 
@@ -68,15 +76,78 @@ func (t *TelegramNotifier) Notify(chatId, message string) {
 	chatIdInt, err := strconv.ParseInt(chatId, 10, 64)
 
 	if err != nil {
-		log.Fatalf("Notify: %v", err)
+		// invalid chat id shall not take down the notifier
+		log.Printf("Notify: invalid chat id %q: %v", chatId, err)
+		return
 	}
 
-	t.notiCh <- NotiReq{
+	t.Reply(chatIdInt, message)
+}
+
+// Notify with buttons to mute the subscription and open the listing
+func (t *TelegramNotifier) NotifyAlert(chatId string, alert *Alert) {
+	chatIdInt, err := strconv.ParseInt(chatId, 10, 64)
+
+	if err != nil {
+		log.Printf("NotifyAlert: invalid chat id %q: %v", chatId, err)
+		return
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if !alert.SubId.IsZero() {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("🔕 Mute", TELEGRAM_CALLBACK_MUTE+alert.SubId.Hex()))
+	}
+	if alert.Url != "" {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL("🔗 Open", alert.Url))
+	}
+
+	req := NotiReq{
 		ChatId:  chatIdInt,
+		Message: alert.Message,
+	}
+	if len(buttons) > 0 {
+		req.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+	}
+	t.notiCh <- req
+}
+
+// Answer the callback query of an inline button
+func (t *TelegramNotifier) AnswerCallback(callbackId, text string) {
+	if _, err := t.bot.Request(tgbotapi.NewCallback(callbackId, text)); err != nil {
+		log.Printf("AnswerCallback: %v", err)
+	}
+}
+
+// Queue a message to the chat
+func (t *TelegramNotifier) Reply(chatId int64, message string) {
+	t.notiCh <- NotiReq{
+		ChatId:  chatId,
 		Message: message,
 	}
 }
 
+type TelegramUpdateHandler interface {
+	// @return true if the update is handled
+	HandleUpdate(update *tgbotapi.Update) bool
+}
+
+// Listen to bot updates, each update is passed to the handlers in order until handled
+func (t *TelegramNotifier) ListenUpdates(handlers ...TelegramUpdateHandler) {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	updates := t.bot.GetUpdatesChan(u)
+	go func() {
+		for update := range updates {
+			for _, handler := range handlers {
+				if handler.HandleUpdate(&update) {
+					break
+				}
+			}
+		}
+	}()
+}
+
 func (t *TelegramNotifier) Close() {
 	close(t.notiCh)
 }
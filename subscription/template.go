@@ -0,0 +1,199 @@
+package subscription
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// template names
+const (
+	TEMPLATE_LISTING     = "listing"
+	TEMPLATE_SUB_EXPIRED = "subExpired"
+	TEMPLATE_ANOMALY     = "anomaly"
+	TEMPLATE_ITEM_ALERT  = "itemAlert"
+	TEMPLATE_WATCHLIST   = "watchlist"
+	TEMPLATE_ARBITRAGE   = "arbitrage"
+)
+
+// notiType of the templates used by all notifiers
+const DEFAULT_NOTI_TYPE = ""
+
+// Data of TEMPLATE_LISTING
+type ListingMessageData struct {
+	Listing *model.Listing
+	// min price of the item
+	MinPrice float64
+	Currency string
+	Url      string
+	// typical premium of the tier of the listing, e.g. 0.85 for +85%
+	TierPremium    float64
+	HasTierPremium bool
+	// price before the drop, and the change, e.g. -0.1 for -10%
+	PreviousPrice primitive.Decimal128
+	PriceChange   float64
+	HasPriceDrop  bool
+}
+
+// Data of TEMPLATE_SUB_EXPIRED
+type SubExpiredMessageData struct {
+	Subscription *model.Subscription
+}
+
+// Data of TEMPLATE_ANOMALY
+type AnomalyMessageData struct {
+	Anomaly *model.Anomaly
+	// currency of the anomaly prices
+	Currency string
+}
+
+// Data of TEMPLATE_ITEM_ALERT & TEMPLATE_WATCHLIST
+type ItemAlertMessageData struct {
+	Item *model.Item
+	// nil for the watchlist
+	Alert *model.ItemAlert
+	// best price across markets & its market
+	Price  float64
+	Market string
+	// change of the best price in 24h, e.g. -0.1 for -10%
+	Change   float64
+	Currency string
+}
+
+// Data of TEMPLATE_ARBITRAGE
+type ArbitrageMessageData struct {
+	Name         string
+	BuyMarket    string
+	BuyPrice     float64
+	BuyCurrency  string
+	SellMarket   string
+	SellPrice    float64
+	SellCurrency string
+	// net profit & its ratio to the cost, e.g. 0.1 for +10%
+	Profit float64
+	ROI    float64
+	// sales on the sell market
+	Sales int64
+	// currency of the profit
+	Currency string
+}
+
+// The default listing template preserves the original message layout
+var defaultTemplates = map[string]map[string]string{
+	TEMPLATE_LISTING: {
+		shared.LOCALE_EN:    "🌸 NEW LISTING 🌸\nName: {{.Listing.Name}}\nTier: {{.Listing.Rarity}} (#{{.Listing.PaintSeed}})\nPrice: {{.Listing.Price}} (Min: {{printf \"%.1f\" .MinPrice}})\nLink: {{.Url}}{{if .HasPriceDrop}}\nPrice drop: {{percent .PriceChange}} (was {{.PreviousPrice}}){{end}}{{if .HasTierPremium}}\nTier {{.Listing.Rarity}} typically sells at {{percent .TierPremium}}{{end}}",
+		shared.LOCALE_ZH_CN: "🌸 新上架 🌸\n名称: {{.Listing.Name}}\n稀有度: {{.Listing.Rarity}} (#{{.Listing.PaintSeed}})\n价格: {{price .Listing.Price .Currency}} (最低: {{money .MinPrice .Currency}})\n链接: {{.Url}}{{if .HasPriceDrop}}\n降价: {{percent .PriceChange}} (原价 {{price .PreviousPrice .Currency}}){{end}}{{if .HasTierPremium}}\n{{.Listing.Rarity}} 通常溢价 {{percent .TierPremium}}{{end}}",
+	},
+	TEMPLATE_ANOMALY: {
+		shared.LOCALE_EN: "⚠️ ANOMALY ⚠️\nName: {{.Anomaly.Name}}\nMarket: {{.Anomaly.Market}}\n" +
+			"{{if eq .Anomaly.Type \"priceSpike\"}}Price spike: {{money .Anomaly.Value .Currency}} (usually {{money .Anomaly.Baseline .Currency}})" +
+			"{{else if eq .Anomaly.Type \"priceDrop\"}}Price drop: {{money .Anomaly.Value .Currency}} (usually {{money .Anomaly.Baseline .Currency}})" +
+			"{{else if eq .Anomaly.Type \"volumeSpike\"}}Volume spike: {{printf \"%.0f\" .Anomaly.Value}} sales in 24h (usually {{printf \"%.0f\" .Anomaly.Baseline}} per day)" +
+			"{{else if eq .Anomaly.Type \"washTrade\"}}Wash trades: asset {{.Anomaly.AssetId}} sold {{printf \"%.0f\" .Anomaly.Score}} times{{end}}",
+		shared.LOCALE_ZH_CN: "⚠️ 异常 ⚠️\n名称: {{.Anomaly.Name}}\n市场: {{.Anomaly.Market}}\n" +
+			"{{if eq .Anomaly.Type \"priceSpike\"}}价格飙升: {{money .Anomaly.Value .Currency}} (通常 {{money .Anomaly.Baseline .Currency}})" +
+			"{{else if eq .Anomaly.Type \"priceDrop\"}}价格骤降: {{money .Anomaly.Value .Currency}} (通常 {{money .Anomaly.Baseline .Currency}})" +
+			"{{else if eq .Anomaly.Type \"volumeSpike\"}}成交量激增: 24小时内成交 {{printf \"%.0f\" .Anomaly.Value}} 笔 (通常每天 {{printf \"%.0f\" .Anomaly.Baseline}} 笔)" +
+			"{{else if eq .Anomaly.Type \"washTrade\"}}疑似对敲: 资产 {{.Anomaly.AssetId}} 被成交 {{printf \"%.0f\" .Anomaly.Score}} 次{{end}}",
+	},
+	TEMPLATE_ITEM_ALERT: {
+		shared.LOCALE_EN: "🔔 ITEM ALERT 🔔\nName: {{.Item.Name}}\n" +
+			"{{if eq .Alert.Type \"priceBelow\"}}Best price {{money .Price .Currency}} on {{.Market}} is below {{money .Alert.Threshold .Currency}}" +
+			"{{else if eq .Alert.Type \"priceAbove\"}}Best price {{money .Price .Currency}} on {{.Market}} is above {{money .Alert.Threshold .Currency}}" +
+			"{{else if eq .Alert.Type \"priceMove\"}}Best price moved {{percent .Change}} in 24h to {{money .Price .Currency}} on {{.Market}}" +
+			"{{else if eq .Alert.Type \"cheapestMarket\"}}{{.Market}} is now the cheapest at {{money .Price .Currency}}{{end}}",
+		shared.LOCALE_ZH_CN: "🔔 饰品提醒 🔔\n名称: {{.Item.Name}}\n" +
+			"{{if eq .Alert.Type \"priceBelow\"}}{{.Market}} 最低价 {{money .Price .Currency}} 低于 {{money .Alert.Threshold .Currency}}" +
+			"{{else if eq .Alert.Type \"priceAbove\"}}{{.Market}} 最低价 {{money .Price .Currency}} 高于 {{money .Alert.Threshold .Currency}}" +
+			"{{else if eq .Alert.Type \"priceMove\"}}最低价24小时内变动 {{percent .Change}}，现为 {{.Market}} {{money .Price .Currency}}" +
+			"{{else if eq .Alert.Type \"cheapestMarket\"}}{{.Market}} 现为最低价市场: {{money .Price .Currency}}{{end}}",
+	},
+	TEMPLATE_WATCHLIST: {
+		shared.LOCALE_EN:    "👀 WATCHLIST 👀\nName: {{.Item.Name}}\nBest price moved {{percent .Change}} in 24h to {{money .Price .Currency}} on {{.Market}}",
+		shared.LOCALE_ZH_CN: "👀 收藏提醒 👀\n名称: {{.Item.Name}}\n最低价24小时内变动 {{percent .Change}}，现为 {{.Market}} {{money .Price .Currency}}",
+	},
+	TEMPLATE_ARBITRAGE: {
+		shared.LOCALE_EN:    "💹 ARBITRAGE 💹\nName: {{.Name}}\nBuy: {{.BuyMarket}} {{money .BuyPrice .BuyCurrency}}\nSell: {{.SellMarket}} {{money .SellPrice .SellCurrency}}\nProfit: {{money .Profit .Currency}} (ROI {{percent .ROI}})\nSales: {{.Sales}}",
+		shared.LOCALE_ZH_CN: "💹 搬砖机会 💹\n名称: {{.Name}}\n买入: {{.BuyMarket}} {{money .BuyPrice .BuyCurrency}}\n卖出: {{.SellMarket}} {{money .SellPrice .SellCurrency}}\n利润: {{money .Profit .Currency}} (回报率 {{percent .ROI}})\n销量: {{.Sales}}",
+	},
+	TEMPLATE_SUB_EXPIRED: {
+		shared.LOCALE_EN:    "⌛ SUBSCRIPTION EXPIRED ⌛\nName: {{.Subscription.Name}}\nNotified: {{.Subscription.NotificationCount}} times\nThe subscription is removed, subscribe again to keep receiving alerts.",
+		shared.LOCALE_ZH_CN: "⌛ 订阅已过期 ⌛\n名称: {{.Subscription.Name}}\n已通知: {{.Subscription.NotificationCount}} 次\n订阅已移除，如需继续接收提醒请重新订阅。",
+	},
+}
+
+var templateFuncs = template.FuncMap{
+	// Decimal128 price with currency, e.g. ¥1,234.50
+	"price": func(price primitive.Decimal128, currency string) string {
+		return shared.FormatPrice(shared.DecToFloat(price), currency)
+	},
+	// float amount with currency
+	"money": shared.FormatPrice,
+	// signed percentage of a ratio, e.g. 0.85 -> +85%
+	"percent": func(ratio float64) string {
+		return fmt.Sprintf("%+.0f%%", ratio*100)
+	},
+}
+
+// Message templates by name, notifier type and locale
+type MessageTemplates struct {
+	// name/notiType/locale -> template
+	templates map[string]*template.Template
+}
+
+func getTemplateKey(name, notiType, locale string) string {
+	return name + "/" + notiType + "/" + locale
+}
+
+// NewMessageTemplates returns the default templates for all notifiers
+func NewMessageTemplates() *MessageTemplates {
+	m := &MessageTemplates{
+		templates: make(map[string]*template.Template),
+	}
+	for name, locales := range defaultTemplates {
+		for locale, text := range locales {
+			if err := m.Register(name, DEFAULT_NOTI_TYPE, locale, text); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return m
+}
+
+// Register a template, overrides the existing one
+func (m *MessageTemplates) Register(name, notiType, locale, text string) error {
+	key := getTemplateKey(name, notiType, locale)
+	tmpl, err := template.New(key).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+	m.templates[key] = tmpl
+	return nil
+}
+
+// Render the template, falls back to the default notifier type, then the default locale
+func (m *MessageTemplates) Render(name, notiType, locale string, data interface{}) (string, error) {
+	candidates := []string{
+		getTemplateKey(name, notiType, locale),
+		getTemplateKey(name, DEFAULT_NOTI_TYPE, locale),
+		getTemplateKey(name, notiType, shared.LOCALE_EN),
+		getTemplateKey(name, DEFAULT_NOTI_TYPE, shared.LOCALE_EN),
+	}
+
+	for _, key := range candidates {
+		tmpl, ok := m.templates[key]
+		if !ok {
+			continue
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	}
+	return "", fmt.Errorf("template %s not found", name)
+}
@@ -0,0 +1,137 @@
+package subscription_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/subscription"
+)
+
+func TestMessageTemplates(t *testing.T) {
+	listing := &model.Listing{
+		Name:      "★ Bayonet | Marble Fade (Factory New)",
+		Market:    shared.MARKET_NAME_IGXE,
+		Rarity:    "FFI",
+		PaintSeed: 412,
+		Price:     shared.GetDecimal128("1234.5"),
+		// igxe url does not need the buff ids
+		InstanceId: "123",
+	}
+	data := &subscription.ListingMessageData{
+		Listing:  listing,
+		MinPrice: 1000,
+		Currency: shared.CURRENCY_CNY,
+		Url:      shared.GetListingUrl(listing),
+	}
+	templates := subscription.NewMessageTemplates()
+
+	t.Run("DefaultLayout", func(t *testing.T) {
+		// the layout before templates were introduced
+		expected := fmt.Sprintf(
+			"🌸 NEW LISTING 🌸\nName: %s\nTier: %s (#%d)\nPrice: %s (Min: %.1f)\nLink: %s",
+			listing.Name,
+			listing.Rarity,
+			listing.PaintSeed,
+			listing.Price,
+			1000.0,
+			data.Url,
+		)
+
+		actual, err := templates.Render(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("Expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("Localized", func(t *testing.T) {
+		expected := "🌸 新上架 🌸\n名称: ★ Bayonet | Marble Fade (Factory New)\n稀有度: FFI (#412)\n价格: ¥1,234.50 (最低: ¥1,000.00)\n链接: https://www.igxe.cn/product-123"
+
+		actual, err := templates.Render(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_ZH_CN, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("Expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("TierPremium", func(t *testing.T) {
+		premiumData := *data
+		premiumData.TierPremium, premiumData.HasTierPremium = 0.85, true
+
+		actual, err := templates.Render(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, &premiumData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(actual, "\nTier FFI typically sells at +85%") {
+			t.Errorf("Expected the tier premium line, got %q", actual)
+		}
+	})
+
+	t.Run("PriceDrop", func(t *testing.T) {
+		dropData := *data
+		dropData.PreviousPrice, dropData.PriceChange, dropData.HasPriceDrop = shared.GetDecimal128("1371.67"), -0.1, true
+
+		actual, err := templates.Render(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, &dropData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(actual, "\nPrice drop: -10% (was 1371.67)") {
+			t.Errorf("Expected the price drop line, got %q", actual)
+		}
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		if err := templates.Register(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, "{{.Listing.Name}} {{price .Listing.Price .Currency}}"); err != nil {
+			t.Fatal(err)
+		}
+
+		actual, _ := templates.Render(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, data)
+		if actual != "★ Bayonet | Marble Fade (Factory New) ¥1,234.50" {
+			t.Errorf("Unexpected override output: %q", actual)
+		}
+
+		// unknown locale falls back to english
+		actual, _ = templates.Render(subscription.TEMPLATE_LISTING, shared.NOTI_TYPE_TELEGRAM, "fr", data)
+		if actual != "★ Bayonet | Marble Fade (Factory New) ¥1,234.50" {
+			t.Errorf("Unexpected fallback output: %q", actual)
+		}
+	})
+}
+
+func TestMessageTemplates_Anomaly(t *testing.T) {
+	templates := subscription.NewMessageTemplates()
+	data := &subscription.AnomalyMessageData{
+		Anomaly: &model.Anomaly{
+			Name:     "AK-47 | Redline (Field-Tested)",
+			Market:   shared.MARKET_NAME_BUFF,
+			Type:     shared.ANOMALY_TYPE_PRICE_SPIKE,
+			Value:    150,
+			Baseline: 100,
+		},
+		Currency: shared.CURRENCY_CNY,
+	}
+
+	expected := "⚠️ ANOMALY ⚠️\nName: AK-47 | Redline (Field-Tested)\nMarket: buff\nPrice spike: ¥150.00 (usually ¥100.00)"
+	actual, err := templates.Render(subscription.TEMPLATE_ANOMALY, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	data.Anomaly.Type = shared.ANOMALY_TYPE_WASH_TRADE
+	data.Anomaly.AssetId = "123"
+	data.Anomaly.Score = 3
+	actual, _ = templates.Render(subscription.TEMPLATE_ANOMALY, shared.NOTI_TYPE_TELEGRAM, shared.LOCALE_EN, data)
+	if !strings.HasSuffix(actual, "Wash trades: asset 123 sold 3 times") {
+		t.Errorf("Unexpected wash trade message: %q", actual)
+	}
+}
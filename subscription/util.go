@@ -3,7 +3,9 @@ package subscription
 import (
 	"fmt"
 	"log"
+	"math"
 	"strconv"
+	"time"
 
 	shared "github.com/mikezzb/steam-trading-shared"
 	"github.com/mikezzb/steam-trading-shared/database/model"
@@ -17,50 +19,107 @@ func getItemPaintSeedKey(itemName string, paintSeed int) string {
 	return fmt.Sprintf("%s_%d", itemName, paintSeed)
 }
 
+func getItemPhaseKey(itemName, phase string) string {
+	return itemName + "_phase_" + phase
+}
+
 func GetSubKey(sub *model.Subscription) string {
 	return sub.ID.Hex()
 }
 
+var DefaultMessageTemplates = NewMessageTemplates()
+
+// @return the listing message in the default template
 func GetListingMessage(listing *model.Listing, minPrice float64) string {
-	return fmt.Sprintf(
-		"🌸 NEW LISTING 🌸\nName: %s\nTier: %s (#%d)\nPrice: %s (Min: %.1f)\nLink: %s",
-		listing.Name,
-		listing.Rarity,
-		listing.PaintSeed,
-		listing.Price,
-		minPrice,
-		shared.GetListingUrl(listing),
-	)
+	message, _ := DefaultMessageTemplates.Render(TEMPLATE_LISTING, DEFAULT_NOTI_TYPE, shared.LOCALE_EN, &ListingMessageData{
+		Listing:  listing,
+		MinPrice: minPrice,
+		Currency: shared.GetMarketCurrency(listing.Market),
+		Url:      shared.GetListingUrl(listing),
+	})
+	return message
+}
+
+// Same conditions as repository.GetActiveSubscriptionFilter
+func IsSubActive(sub *model.Subscription, now time.Time) bool {
+	if sub.Disabled {
+		return false
+	}
+	if sub.ExpiresAt != nil && !sub.ExpiresAt.After(now) {
+		return false
+	}
+	return sub.MaxNotifications <= 0 || sub.NotificationCount < sub.MaxNotifications
 }
 
 type ParsedSubscription struct {
+	// +Inf if the subscription has no max premium
 	Premium      float64
 	PremiumPerc  float64
 	Subscription model.Subscription
 }
 
-func GetParsedSubscription(sub *model.Subscription) *ParsedSubscription {
+// GetParsedSubscription parses the max premium of the subscription, an empty max premium has no cap
+func GetParsedSubscription(sub *model.Subscription) (*ParsedSubscription, error) {
 	pSub := &ParsedSubscription{
 		Subscription: *sub,
-		Premium:      -1,
+		Premium:      math.Inf(1),
 		PremiumPerc:  -1,
 	}
+	if sub.MaxPremium == "" {
+		return pSub, nil
+	}
+
+	premium, premiumPerc, err := ParsePremium(sub.MaxPremium)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max premium %q of subscription %s: %v", sub.MaxPremium, sub.ID.Hex(), err)
+	}
+	pSub.Premium = premium
+	pSub.PremiumPerc = premiumPerc
+
+	return pSub, nil
+}
+
+// Parse the max premium, either a percentage (e.g. 5%) or an absolute value (e.g. 100)
+// @return premium, premium percentage (-1 if not applicable), error
+func ParsePremium(maxPremium string) (float64, float64, error) {
+	if maxPremium == "" {
+		return -1, -1, fmt.Errorf("empty premium")
+	}
 
 	// check if the subscription premium is a percentage
-	if sub.MaxPremium[len(sub.MaxPremium)-1] == '%' {
+	if maxPremium[len(maxPremium)-1] == '%' {
 		// convert to float
-		perc, err := strconv.ParseFloat(sub.MaxPremium[:len(sub.MaxPremium)-1], 64)
-		if err != nil {
-			log.Fatalf("GetParsedSubscription: %v", err)
-		}
-		pSub.PremiumPerc = perc / 100
-	} else {
-		permium, err := strconv.ParseFloat(sub.MaxPremium, 64)
+		perc, err := strconv.ParseFloat(maxPremium[:len(maxPremium)-1], 64)
 		if err != nil {
-			log.Fatalf("GetParsedSubscription: %v", err)
+			return -1, -1, err
 		}
-		pSub.Premium = permium
+		return -1, perc / 100, nil
+	}
+
+	premium, err := strconv.ParseFloat(maxPremium, 64)
+	if err != nil {
+		return -1, -1, err
 	}
+	return premium, -1, nil
+}
+
+// listing price in the normalized currency, falls back to the raw price if no exchange rate
+func getNormalizedListingPrice(listing *model.Listing) string {
+	price, err := shared.NormalizePrice(listing.Price, shared.GetListingCurrency(listing))
+	if err != nil {
+		log.Printf("getNormalizedListingPrice: %s: %v", listing.Name, err)
+		return listing.Price.String()
+	}
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
 
-	return pSub
+// IsEventMatch checks the opt-in min price drop of the subscription, other subscriptions match all events
+func IsEventMatch(event *model.ListingEvent, sub *model.Subscription) bool {
+	if sub.MinPriceDrop <= 0 {
+		return true
+	}
+	if event.Type != shared.LISTING_EVENT_PRICE_DROP {
+		return false
+	}
+	return -shared.GetPriceChange(event)*100 >= sub.MinPriceDrop
 }
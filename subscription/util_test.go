@@ -0,0 +1,104 @@
+package subscription_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	shared "github.com/mikezzb/steam-trading-shared"
+	"github.com/mikezzb/steam-trading-shared/database/model"
+	"github.com/mikezzb/steam-trading-shared/subscription"
+)
+
+func TestIsSubActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		sub  model.Subscription
+		want bool
+	}{
+		{"Default", model.Subscription{}, true},
+		{"Paused", model.Subscription{Disabled: true}, false},
+		{"Expired", model.Subscription{ExpiresAt: &past}, false},
+		{"Not expired", model.Subscription{ExpiresAt: &future}, true},
+		{"Below max notifications", model.Subscription{MaxNotifications: 3, NotificationCount: 2}, true},
+		{"Reached max notifications", model.Subscription{MaxNotifications: 3, NotificationCount: 3}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subscription.IsSubActive(&tt.sub, now); got != tt.want {
+				t.Errorf("IsSubActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePremium(t *testing.T) {
+	tests := []struct {
+		input       string
+		wantPremium float64
+		wantPerc    float64
+		wantErr     bool
+	}{
+		{"5%", -1, 0.05, false},
+		{"100", 100, -1, false},
+		{"", -1, -1, true},
+		{"abc%", -1, -1, true},
+	}
+
+	for _, tt := range tests {
+		premium, perc, err := subscription.ParsePremium(tt.input)
+		if premium != tt.wantPremium || perc != tt.wantPerc || (err != nil) != tt.wantErr {
+			t.Errorf("ParsePremium(%q) = %v, %v, %v; want %v, %v, err %v", tt.input, premium, perc, err, tt.wantPremium, tt.wantPerc, tt.wantErr)
+		}
+	}
+}
+
+func TestGetParsedSubscription(t *testing.T) {
+	parsedSub, err := subscription.GetParsedSubscription(&model.Subscription{MaxPremium: "5%"})
+	if err != nil || parsedSub.PremiumPerc != 0.05 {
+		t.Errorf("Expected 5%% premium, got %+v, %v", parsedSub, err)
+	}
+
+	// no max premium has no cap
+	parsedSub, err = subscription.GetParsedSubscription(&model.Subscription{})
+	if err != nil || parsedSub.PremiumPerc != -1 || !math.IsInf(parsedSub.Premium, 1) {
+		t.Errorf("Expected no premium cap, got %+v, %v", parsedSub, err)
+	}
+
+	if _, err := subscription.GetParsedSubscription(&model.Subscription{MaxPremium: "abc"}); err == nil {
+		t.Errorf("Expected an error for a malformed premium")
+	}
+}
+
+func TestIsEventMatch(t *testing.T) {
+	previous := &model.Listing{Price: shared.GetDecimal128("100")}
+	newEvent := &model.ListingEvent{Type: shared.LISTING_EVENT_NEW, Listing: &model.Listing{Price: shared.GetDecimal128("100")}}
+	smallDrop := &model.ListingEvent{Type: shared.LISTING_EVENT_PRICE_DROP, Listing: &model.Listing{Price: shared.GetDecimal128("95")}, Previous: previous}
+	bigDrop := &model.ListingEvent{Type: shared.LISTING_EVENT_PRICE_DROP, Listing: &model.Listing{Price: shared.GetDecimal128("85")}, Previous: previous}
+
+	tests := []struct {
+		name  string
+		event *model.ListingEvent
+		sub   model.Subscription
+		want  bool
+	}{
+		{"New listing", newEvent, model.Subscription{}, true},
+		{"Price drop", smallDrop, model.Subscription{}, true},
+		{"New listing with min drop", newEvent, model.Subscription{MinPriceDrop: 10}, false},
+		{"Drop below min", smallDrop, model.Subscription{MinPriceDrop: 10}, false},
+		{"Drop above min", bigDrop, model.Subscription{MinPriceDrop: 10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subscription.IsEventMatch(tt.event, &tt.sub); got != tt.want {
+				t.Errorf("IsEventMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
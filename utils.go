@@ -6,7 +6,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
-	"regexp"
+	"slices"
 	"strconv"
 	"time"
 
@@ -43,41 +43,20 @@ func GetItemId(name string) string {
 	return strconv.Itoa(GetBuffIds()[name])
 }
 
+// DecodeItemFullName decodes the name into category (weapon with labels), skin and exterior.
+// Names without skin are returned as the category.
 func DecodeItemFullName(fullName string) (category, skin, exterior string) {
-	re := regexp.MustCompile(`(.*?) \| (.*?) \((.*?)\)`)
-	matches := re.FindStringSubmatch(fullName)
-
-	if matches == nil {
+	itemName := ParseItemName(fullName)
+	if itemName.Skin == "" {
 		return fullName, "", ""
 	}
 
-	return matches[1], matches[2], matches[3]
+	return itemName.Prefix() + itemName.Weapon, itemName.Skin, itemName.Exterior
 }
 
 // ExtractBaseItemName extracts the base item name from the formatted name
 func ExtractBaseItemName(name string) (baseName string) {
-	baseName = name
-	// remove star label if exists
-	if len(baseName) > STAR_LABEL_LEN && baseName[:STAR_LABEL_LEN] == STAR_LEBEL {
-		baseName = baseName[STAR_LABEL_LEN:]
-	}
-	// remove StatTrak label if exists
-	if len(baseName) > STAT_TRAK_LABEL_LEN && baseName[:STAT_TRAK_LABEL_LEN] == STAT_TRAK_LABEL {
-		baseName = baseName[STAT_TRAK_LABEL_LEN:]
-	}
-	// remove the wear level in the ending ()
-	if baseName[len(baseName)-1] == ')' {
-		// find the last (
-		i := len(baseName) - 1
-		for ; i >= 0; i-- {
-			if baseName[i] == '(' {
-				break
-			}
-		}
-		// -1 to remove the space before (
-		baseName = baseName[:i-1]
-	}
-	return
+	return ParseItemName(name).BaseName()
 }
 
 func GetListingUrl(listing *model.Listing) string {
@@ -126,6 +105,33 @@ func GetTier(name string, paintSeed int) string {
 	return tier
 }
 
+// GetItemTiers returns the sorted rare pattern tiers of the item, nil if it has none
+func GetItemTiers(name string) []string {
+	var tiers []string
+	for _, tier := range GetRarePatterns()[ExtractBaseItemName(name)] {
+		if !slices.Contains(tiers, tier) {
+			tiers = append(tiers, tier)
+		}
+	}
+	slices.Sort(tiers)
+	return tiers
+}
+
+// TokenHasScope checks if the token grants the scope, admin grants all scopes
+func TokenHasScope(token *model.Token, scope string) bool {
+	for _, s := range token.Scopes {
+		if s == scope || s == TOKEN_SCOPE_ADMIN {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDopplerPhase returns the Doppler / Gamma Doppler phase of the paint index, "" if not a Doppler
+func GetDopplerPhase(paintIndex int) string {
+	return DOPPLER_PHASE_PAINT_INDEXES[paintIndex]
+}
+
 func PrintCookies(cookies []*http.Cookie, label string) {
 	for _, cookie := range cookies {
 		log.Printf("[%s] Cookie: %v\n", label, cookie)
@@ -161,34 +167,56 @@ func GetMarketPrice(item *model.Item, marketName string) *model.MarketPrice {
 	return nil
 }
 
-// @return best price, market name
+// GetMarketPriceField returns the bson field of the market price in the item, empty if unknown
+func GetMarketPriceField(marketName string) string {
+	switch marketName {
+	case MARKET_NAME_BUFF:
+		return "buffPrice"
+	case MARKET_NAME_STEAM:
+		return "steamPrice"
+	case MARKET_NAME_IGXE:
+		return "igxePrice"
+	case MARKET_NAME_UU:
+		return "uuPrice"
+	}
+	return ""
+}
+
+// @return best price compared in NORMALIZED_CURRENCY
 func GetBestPrice(item *model.Item) *model.MarketPrice {
 	if item == nil {
 		return nil
 	}
 
 	var lowestPrice *model.MarketPrice = nil
+	var lowestNormalized float64
 
 	for _, marketName := range ITEM_MARKET_NAMES {
 		price := GetMarketPrice(item, marketName)
 		if price == nil {
 			continue
 		}
-		if lowestPrice == nil || DecCompareTo(price.Price, lowestPrice.Price) == -1 {
-			lowestPrice = price
+		normalized, err := NormalizePrice(price.Price, GetMarketPriceCurrency(price, marketName))
+		if err != nil {
+			log.Printf("GetBestPrice: %s: %v", marketName, err)
+			continue
+		}
+		if lowestPrice == nil || normalized < lowestNormalized {
+			lowestPrice, lowestNormalized = price, normalized
 		}
 	}
 
 	return lowestPrice
 }
 
-// @return fresh best price, market name
+// @return fresh best price compared in NORMALIZED_CURRENCY
 func GetFreshBestPrice(item *model.Item, expireDuration time.Duration) *model.MarketPrice {
 	if item == nil {
 		return nil
 	}
 
 	var lowestPrice *model.MarketPrice = nil
+	var lowestNormalized float64
 	now := time.Now()
 
 	for _, marketName := range ITEM_MARKET_NAMES {
@@ -203,8 +231,13 @@ func GetFreshBestPrice(item *model.Item, expireDuration time.Duration) *model.Ma
 			continue
 		}
 
-		if lowestPrice == nil || DecCompareTo(price.Price, lowestPrice.Price) == -1 {
-			lowestPrice = price
+		normalized, err := NormalizePrice(price.Price, GetMarketPriceCurrency(price, marketName))
+		if err != nil {
+			log.Printf("GetFreshBestPrice: %s: %v", marketName, err)
+			continue
+		}
+		if lowestPrice == nil || normalized < lowestNormalized {
+			lowestPrice, lowestNormalized = price, normalized
 		}
 	}
 
@@ -216,6 +249,48 @@ func GetFreshBestPrice(item *model.Item, expireDuration time.Duration) *model.Ma
 	return lowestPrice
 }
 
+// @return the default currency of the market, CNY if unknown
+func GetMarketCurrency(marketName string) string {
+	if currency, ok := MARKET_CURRENCIES[marketName]; ok {
+		return currency
+	}
+	return CURRENCY_CNY
+}
+
+// Format the amount with the currency symbol and thousands separators, e.g. ¥1,234.50
+func FormatPrice(amount float64, currency string) string {
+	symbol, ok := CURRENCY_SYMBOLS[currency]
+	if !ok {
+		symbol = currency + " "
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	str := strconv.FormatFloat(amount, 'f', 2, 64)
+	intPart, decPart := str[:len(str)-3], str[len(str)-3:]
+
+	// insert thousands separators
+	var grouped []byte
+	for i := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			grouped = append(grouped, ',')
+		}
+		grouped = append(grouped, intPart[i])
+	}
+
+	return sign + symbol + string(grouped) + decPart
+}
+
+// Convert a Decimal128 to float64, ignore error
+func DecToFloat(d primitive.Decimal128) float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
 func ConvertToUnix(timestamp string, layout string) (int64, error) {
 	t, err := time.Parse(layout, timestamp)
 	if err != nil {
@@ -328,3 +403,43 @@ func SameTime(t1, t2 time.Time) bool {
 func GetTimeBeforeDays(days int) time.Time {
 	return time.Now().AddDate(0, 0, -days)
 }
+
+// GetListingEvent diffs the upserted listing with the previous state of its asset, nil if the price is unchanged
+// @param previous the listing of the asset on the same market, nil if never listed
+// @param other the latest listing of the asset on another market, nil if none
+func GetListingEvent(listing, previous, other *model.Listing) *model.ListingEvent {
+	// removed listings are listed again
+	if previous == nil || previous.Status != "" {
+		if other != nil {
+			return &model.ListingEvent{Type: LISTING_EVENT_RELISTED, Listing: listing, Previous: other}
+		}
+		return &model.ListingEvent{Type: LISTING_EVENT_NEW, Listing: listing}
+	}
+
+	price, prevPrice := DecToFloat(listing.Price), DecToFloat(previous.Price)
+	switch {
+	case price < prevPrice:
+		return &model.ListingEvent{Type: LISTING_EVENT_PRICE_DROP, Listing: listing, Previous: previous}
+	case price > prevPrice:
+		return &model.ListingEvent{Type: LISTING_EVENT_PRICE_INCREASE, Listing: listing, Previous: previous}
+	}
+	return nil
+}
+
+// GetPriceChange returns the price change from the previous listing, e.g. -0.1 for a 10% drop, 0 without previous
+func GetPriceChange(event *model.ListingEvent) float64 {
+	if event.Previous == nil {
+		return 0
+	}
+
+	// the previous listing can be on another market
+	price, err := NormalizePrice(event.Listing.Price, GetListingCurrency(event.Listing))
+	if err != nil {
+		return 0
+	}
+	prevPrice, err := NormalizePrice(event.Previous.Price, GetListingCurrency(event.Previous))
+	if err != nil || prevPrice == 0 {
+		return 0
+	}
+	return (price - prevPrice) / prevPrice
+}
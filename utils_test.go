@@ -2,6 +2,7 @@ package shared
 
 import (
 	"log"
+	"slices"
 	"testing"
 
 	"github.com/mikezzb/steam-trading-shared/database/model"
@@ -64,6 +65,13 @@ func TestUtils_Naming(t *testing.T) {
 				wantSkin:     "Doppler",
 				wantExterior: "Factory New",
 			},
+			{
+				name:         "Item without exterior",
+				input:        "AK-47 | Redline",
+				wantName:     "AK-47",
+				wantSkin:     "Redline",
+				wantExterior: "",
+			},
 			{
 				name:         "Incorrect format missing pipe",
 				input:        "USP-S Orion (Factory New)",
@@ -120,6 +128,16 @@ func TestUtils_Tier(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("GetItemTiers", func(t *testing.T) {
+		tiers := GetItemTiers("★ Bayonet | Marble Fade (Factory New)")
+		if !slices.Contains(tiers, "FFI") || !slices.IsSorted(tiers) {
+			t.Errorf("Expected sorted tiers with FFI, got %v", tiers)
+		}
+		if tiers := GetItemTiers("AK-47 | Redline (Field-Tested)"); tiers != nil {
+			t.Errorf("Expected no tiers, got %v", tiers)
+		}
+	})
 }
 
 func TestRandSleep(t *testing.T) {
@@ -209,3 +227,98 @@ func TestGetDecimal128(t *testing.T) {
 	})
 
 }
+
+func TestFormatPrice(t *testing.T) {
+	testCases := []struct {
+		amount   float64
+		currency string
+		expected string
+	}{
+		{0, CURRENCY_CNY, "¥0.00"},
+		{12.5, CURRENCY_CNY, "¥12.50"},
+		{1234.567, CURRENCY_USD, "$1,234.57"},
+		{1234567, CURRENCY_CNY, "¥1,234,567.00"},
+		{-1000, CURRENCY_USD, "-$1,000.00"},
+		{100, "EUR", "EUR 100.00"},
+	}
+
+	for _, tc := range testCases {
+		if actual := FormatPrice(tc.amount, tc.currency); actual != tc.expected {
+			t.Errorf("FormatPrice(%v, %s): expected %s, got %s", tc.amount, tc.currency, tc.expected, actual)
+		}
+	}
+}
+
+func TestGetDopplerPhase(t *testing.T) {
+	testPairs := []struct {
+		paintIndex int
+		expected   string
+	}{
+		{415, PHASE_RUBY},
+		{416, PHASE_SAPPHIRE},
+		{417, PHASE_BLACK_PEARL},
+		{419, PHASE_2},
+		{568, PHASE_EMERALD},
+		{572, PHASE_4},
+		{1119, PHASE_EMERALD},
+		// Marble Fade is not a Doppler
+		{413, ""},
+	}
+
+	for _, pair := range testPairs {
+		if actual := GetDopplerPhase(pair.paintIndex); actual != pair.expected {
+			t.Errorf("GetDopplerPhase(%d): expected %q, got %q", pair.paintIndex, pair.expected, actual)
+		}
+	}
+}
+
+func TestGetListingEvent(t *testing.T) {
+	listing := &model.Listing{Market: MARKET_NAME_BUFF, AssetId: "1", Price: GetDecimal128("90")}
+	same := &model.Listing{Market: MARKET_NAME_BUFF, AssetId: "1", Price: GetDecimal128("90")}
+	higher := &model.Listing{Market: MARKET_NAME_BUFF, AssetId: "1", Price: GetDecimal128("100")}
+	lower := &model.Listing{Market: MARKET_NAME_BUFF, AssetId: "1", Price: GetDecimal128("80")}
+	removed := &model.Listing{Market: MARKET_NAME_BUFF, AssetId: "1", Price: GetDecimal128("100"), Status: LISTING_STATUS_SOLD}
+	other := &model.Listing{Market: MARKET_NAME_UU, AssetId: "1", Price: GetDecimal128("100")}
+
+	testCases := []struct {
+		previous *model.Listing
+		other    *model.Listing
+		expected string
+	}{
+		{nil, nil, LISTING_EVENT_NEW},
+		{nil, other, LISTING_EVENT_RELISTED},
+		{removed, nil, LISTING_EVENT_NEW},
+		{higher, nil, LISTING_EVENT_PRICE_DROP},
+		{lower, nil, LISTING_EVENT_PRICE_INCREASE},
+		{same, nil, ""},
+	}
+
+	for i, tc := range testCases {
+		event := GetListingEvent(listing, tc.previous, tc.other)
+		actual := ""
+		if event != nil {
+			actual = event.Type
+		}
+		if actual != tc.expected {
+			t.Errorf("case %d: expected event %q, got %q", i, tc.expected, actual)
+		}
+	}
+
+	// ¥90 from ¥100
+	event := GetListingEvent(listing, higher, nil)
+	if change := GetPriceChange(event); change < -0.1-1e-9 || change > -0.1+1e-9 {
+		t.Errorf("Expected a 10%% drop, got %v", change)
+	}
+}
+
+func TestGetMarketPriceField(t *testing.T) {
+	item := &model.Item{}
+	for _, market := range ITEM_MARKET_NAMES {
+		if GetMarketPriceField(market) == "" {
+			t.Errorf("Expected the price field of %s", market)
+		}
+	}
+	if GetMarketPriceField("unknown") != "" || GetMarketPrice(item, "unknown") != nil {
+		t.Error("Expected no price field of unknown market")
+	}
+}